@@ -16,14 +16,24 @@ package http
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 
 	"github.com/mendersoftware/go-lib-micro/rest.utils"
 
 	"github.com/mendersoftware/reporting/app/reporting"
 )
 
+const (
+	// defaultVerifySample and maxVerifySample bound the number of documents
+	// compared within the HTTP request; the full scans of the source
+	// services are run by the verify command
+	defaultVerifySample = 1000
+	maxVerifySample     = 10000
+)
+
 // InternalController contains internal end-points
 type InternalController struct {
 	reporting reporting.App
@@ -49,3 +59,36 @@ func (h InternalController) Health(c *gin.Context) {
 	}
 	c.Status(http.StatusNoContent)
 }
+
+// ReindexTenant responds to POST /tenants/:tenant_id/reindex
+func (h InternalController) ReindexTenant(c *gin.Context) {
+	tid := c.Param("tenant_id")
+	err := h.reporting.ReindexTenant(c.Request.Context(), tid)
+	if err != nil {
+		rest.RenderError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// VerifyTenant responds to GET /tenants/:tenant_id/verify
+func (h InternalController) VerifyTenant(c *gin.Context) {
+	tid := c.Param("tenant_id")
+	sample := defaultVerifySample
+	if value := c.Query("sample"); value != "" {
+		var err error
+		sample, err = strconv.Atoi(value)
+		if err != nil || sample <= 0 || sample > maxVerifySample {
+			rest.RenderError(c, http.StatusBadRequest,
+				errors.Errorf("sample: must be an integer between 1 and %d",
+					maxVerifySample))
+			return
+		}
+	}
+	report, err := h.reporting.VerifyTenant(c.Request.Context(), tid, sample)
+	if err != nil {
+		rest.RenderError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
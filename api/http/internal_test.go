@@ -28,6 +28,7 @@ import (
 	"github.com/mendersoftware/go-lib-micro/rest.utils"
 
 	mapp "github.com/mendersoftware/reporting/app/reporting/mocks"
+	"github.com/mendersoftware/reporting/model"
 )
 
 var contextMatcher = mock.MatchedBy(func(_ context.Context) bool { return true })
@@ -96,3 +97,152 @@ func TestHealth(t *testing.T) {
 		})
 	}
 }
+
+func TestReindexTenant(t *testing.T) {
+	t.Parallel()
+
+	const tenantID = "123456789012345678901234"
+
+	testCases := []struct {
+		Name string
+
+		Error      error
+		StatusCode int
+	}{{
+		Name: "ok",
+
+		StatusCode: http.StatusAccepted,
+	}, {
+		Name: "error, from application layer",
+
+		Error:      errors.New("reindexing is not available"),
+		StatusCode: http.StatusInternalServerError,
+	}}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			app := new(mapp.App)
+			app.On("ReindexTenant",
+				contextMatcher,
+				tenantID,
+			).Return(tc.Error)
+			defer app.AssertExpectations(t)
+			router := NewRouter(app)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost,
+				URIInternal+"/tenants/"+tenantID+"/reindex", nil)
+			req.Header.Set("X-Men-Requestid", "test")
+
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tc.StatusCode, w.Code)
+			if tc.Error != nil {
+				err := rest.Error{
+					Err:       tc.Error.Error(),
+					RequestID: "test",
+				}
+				b, _ := json.Marshal(err)
+				assert.Equal(t,
+					string(b),
+					w.Body.String(),
+				)
+			}
+		})
+	}
+}
+
+func TestVerifyTenant(t *testing.T) {
+	t.Parallel()
+
+	const tenantID = "123456789012345678901234"
+
+	report := &model.DriftReport{
+		TenantID: tenantID,
+		Devices: model.EntityDrift{
+			Checked: 2,
+			Missing: []string{"device"},
+		},
+	}
+	testCases := []struct {
+		Name string
+
+		Query  string
+		Sample int
+		Report *model.DriftReport
+		Error  error
+
+		StatusCode int
+		AppError   error
+	}{{
+		Name: "ok, default sample",
+
+		Sample:     defaultVerifySample,
+		Report:     report,
+		StatusCode: http.StatusOK,
+	}, {
+		Name: "ok, sample",
+
+		Query:      "?sample=10",
+		Sample:     10,
+		Report:     report,
+		StatusCode: http.StatusOK,
+	}, {
+		Name: "error, invalid sample",
+
+		Query:      "?sample=-1",
+		StatusCode: http.StatusBadRequest,
+		AppError:   errors.New("sample: must be an integer between 1 and 10000"),
+	}, {
+		Name: "error, full scan",
+
+		Query:      "?sample=0",
+		StatusCode: http.StatusBadRequest,
+		AppError:   errors.New("sample: must be an integer between 1 and 10000"),
+	}, {
+		Name: "error, sample too large",
+
+		Query:      "?sample=10001",
+		StatusCode: http.StatusBadRequest,
+		AppError:   errors.New("sample: must be an integer between 1 and 10000"),
+	}, {
+		Name: "error, from application layer",
+
+		Sample:     defaultVerifySample,
+		Error:      errors.New("verification is not available"),
+		StatusCode: http.StatusInternalServerError,
+		AppError:   errors.New("verification is not available"),
+	}}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			app := new(mapp.App)
+			if tc.Report != nil || tc.Error != nil {
+				app.On("VerifyTenant",
+					contextMatcher,
+					tenantID,
+					tc.Sample,
+				).Return(tc.Report, tc.Error)
+			}
+			defer app.AssertExpectations(t)
+			router := NewRouter(app)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet,
+				URIInternal+"/tenants/"+tenantID+"/verify"+tc.Query, nil)
+			req.Header.Set("X-Men-Requestid", "test")
+
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tc.StatusCode, w.Code)
+			if tc.AppError != nil {
+				var err rest.Error
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &err))
+				assert.EqualError(t, &err, tc.AppError.Error())
+			} else {
+				b, _ := json.Marshal(tc.Report)
+				assert.JSONEq(t, string(b), w.Body.String())
+			}
+		})
+	}
+}
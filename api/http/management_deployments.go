@@ -136,3 +136,56 @@ func parseDeploymentsSearchParams(ctx context.Context, c *gin.Context) (
 
 	return &searchParams, nil
 }
+
+func (mc *ManagementController) AggregateDeploymentSummaries(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	params, err := parseAggregateDeploymentsParams(ctx, c)
+	if err != nil {
+		rest.RenderError(c,
+			http.StatusBadRequest,
+			errors.Wrap(err, "malformed request body"),
+		)
+		return
+	}
+
+	res, err := mc.reporting.AggregateDeploymentSummaries(ctx, params)
+	if err != nil {
+		rest.RenderError(c,
+			http.StatusInternalServerError,
+			err,
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (mc *ManagementController) SearchDeploymentSummaries(c *gin.Context) {
+	ctx := c.Request.Context()
+	params, err := parseDeploymentsSearchParams(ctx, c)
+	if err == nil && len(params.DeviceIDs) > 0 {
+		err = errors.New("device_ids: not supported by the deployment summaries")
+	}
+	if err != nil {
+		rest.RenderError(c,
+			http.StatusBadRequest,
+			errors.Wrap(err, "malformed request body"),
+		)
+		return
+	}
+
+	res, total, err := mc.reporting.SearchDeploymentSummaries(ctx, params)
+	if err != nil {
+		rest.RenderError(c,
+			http.StatusInternalServerError,
+			err,
+		)
+		return
+	}
+
+	pageLinkHdrs(c, params.Page, params.PerPage, total)
+
+	c.Header(hdrTotalCount, strconv.Itoa(total))
+	c.JSON(http.StatusOK, res)
+}
@@ -265,6 +265,217 @@ func TestManagementAggregateDeployments(t *testing.T) {
 	}
 }
 
+func TestManagementAggregateDeploymentSummaries(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		Name string
+
+		App    func(*testing.T, testCase) *mapp.App
+		Params interface{} // *model.AggregateDeploymentsParams
+
+		Code     int
+		Response interface{}
+	}
+	testCases := []testCase{{
+		Name: "ok",
+
+		App: func(t *testing.T, self testCase) *mapp.App {
+			app := new(mapp.App)
+
+			app.On("AggregateDeploymentSummaries",
+				contextMatcher,
+				mock.MatchedBy(func(params *model.AggregateDeploymentsParams) bool {
+					return params.TenantID == "123456789012345678901234"
+				})).
+				Return(self.Response, nil)
+			return app
+		},
+		Params: &model.AggregateDeploymentsParams{
+			Aggregations: []model.DeploymentsAggregationTerm{{
+				Name:      "status",
+				Attribute: "deployment_status",
+				Limit:     10,
+			}},
+		},
+
+		Code: http.StatusOK,
+		Response: []model.DeviceAggregation{{
+			Name: "status",
+			Items: []model.DeviceAggregationItem{{
+				Key:   "finished",
+				Count: 2,
+			}},
+		}},
+	}, {
+		Name: "error, internal app error",
+
+		App: func(t *testing.T, self testCase) *mapp.App {
+			app := new(mapp.App)
+
+			app.On("AggregateDeploymentSummaries",
+				contextMatcher,
+				mock.AnythingOfType("*model.AggregateDeploymentsParams")).
+				Return(nil, errors.New("internal error"))
+			return app
+		},
+		Params: &model.AggregateDeploymentsParams{
+			Aggregations: []model.DeploymentsAggregationTerm{{
+				Name:      "status",
+				Attribute: "deployment_status",
+				Limit:     10,
+			}},
+		},
+
+		Code:     http.StatusInternalServerError,
+		Response: rest.Error{Err: "internal error"},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			app := tc.App(t, tc)
+			defer app.AssertExpectations(t)
+			router := NewRouter(app)
+
+			b, _ := json.Marshal(tc.Params)
+			req, _ := http.NewRequest(
+				http.MethodPost,
+				URIManagement+URIDeploymentSummariesAggregate,
+				bytes.NewReader(b),
+			)
+			req.Header.Set("Authorization", "Bearer "+GenerateJWT(identity.Identity{
+				Subject: "851f90b3-cee5-425e-8f6e-b36de1993e7e",
+				Tenant:  "123456789012345678901234",
+			}))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.Code, w.Code)
+
+			if res, ok := tc.Response.(rest.Error); ok {
+				var actual rest.Error
+				err := json.Unmarshal(w.Body.Bytes(), &actual)
+				if assert.NoError(t, err, "response schema did not match expected rest.Error") {
+					assert.EqualError(t, res, actual.Error())
+				}
+			} else {
+				b, _ := json.Marshal(tc.Response)
+				assert.JSONEq(t, string(b), w.Body.String())
+			}
+		})
+	}
+}
+
+func TestManagementSearchDeploymentSummaries(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		Name string
+
+		App    func(*testing.T, testCase) *mapp.App
+		Params interface{} // *model.DeploymentsSearchParams
+
+		Code     int
+		Response interface{}
+	}
+	testCases := []testCase{{
+		Name: "ok",
+
+		App: func(t *testing.T, self testCase) *mapp.App {
+			app := new(mapp.App)
+
+			app.On("SearchDeploymentSummaries",
+				contextMatcher,
+				mock.MatchedBy(func(params *model.DeploymentsSearchParams) bool {
+					return params.TenantID == "123456789012345678901234" &&
+						params.Page == ParamPageDefault &&
+						params.PerPage == ParamPerPageDefault
+				})).
+				Return(self.Response, 1, nil)
+			return app
+		},
+		Params: &model.DeploymentsSearchParams{
+			Sort: []model.DeploymentsSortCriteria{{
+				Attribute: "success_ratio",
+				Order:     model.SortOrderDesc,
+			}},
+		},
+
+		Code: http.StatusOK,
+		Response: []model.DeploymentSummary{{
+			ID:           "5975e1e6-49a6-4218-a46d-f181154a98cc",
+			DeploymentID: "5975e1e6-49a6-4218-a46d-f181154a98cc",
+			DeviceCounts: map[string]int{"success": 1, "failure": 1},
+			SuccessRatio: 0.5,
+		}},
+	}, {
+		Name: "error, device_ids not supported",
+
+		App: func(t *testing.T, self testCase) *mapp.App {
+			return new(mapp.App)
+		},
+		Params: &model.DeploymentsSearchParams{
+			DeviceIDs: []string{"5975e1e6-49a6-4218-a46d-f181154a98cc"},
+		},
+
+		Code: http.StatusBadRequest,
+		Response: rest.Error{
+			Err: "malformed request body: " +
+				"device_ids: not supported by the deployment summaries",
+		},
+	}, {
+		Name: "error, internal app error",
+
+		App: func(t *testing.T, self testCase) *mapp.App {
+			app := new(mapp.App)
+
+			app.On("SearchDeploymentSummaries",
+				contextMatcher,
+				mock.AnythingOfType("*model.DeploymentsSearchParams")).
+				Return(nil, 0, errors.New("internal error"))
+			return app
+		},
+		Params: &model.DeploymentsSearchParams{},
+
+		Code:     http.StatusInternalServerError,
+		Response: rest.Error{Err: "internal error"},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			app := tc.App(t, tc)
+			defer app.AssertExpectations(t)
+			router := NewRouter(app)
+
+			b, _ := json.Marshal(tc.Params)
+			req, _ := http.NewRequest(
+				http.MethodPost,
+				URIManagement+URIDeploymentSummariesSearch,
+				bytes.NewReader(b),
+			)
+			req.Header.Set("Authorization", "Bearer "+GenerateJWT(identity.Identity{
+				Subject: "851f90b3-cee5-425e-8f6e-b36de1993e7e",
+				Tenant:  "123456789012345678901234",
+			}))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.Code, w.Code)
+
+			if res, ok := tc.Response.(rest.Error); ok {
+				var actual rest.Error
+				err := json.Unmarshal(w.Body.Bytes(), &actual)
+				if assert.NoError(t, err, "response schema did not match expected rest.Error") {
+					assert.EqualError(t, res, actual.Error())
+				}
+			} else {
+				b, _ := json.Marshal(tc.Response)
+				assert.JSONEq(t, string(b), w.Body.String())
+			}
+		})
+	}
+}
+
 func time2ptr(t time.Time) *time.Time {
 	return &t
 }
@@ -30,15 +30,19 @@ const (
 	URIInternal   = "/api/internal/v1/reporting"
 	URIManagement = "/api/management/v1/reporting"
 
-	URIAlive                   = "/alive"
-	URIHealth                  = "/health"
-	URIDeploymentsAggregate    = "/deployments/devices/aggregate"
-	URIDeploymentsSearch       = "/deployments/devices/search"
-	URIInventoryAggregate      = "/devices/aggregate"
-	URIInventoryAttrs          = "/devices/attributes"
-	URIInventorySearch         = "/devices/search"
-	URIInventorySearchAttrs    = "/devices/search/attributes"
-	URIInventorySearchInternal = "/tenants/:tenant_id/devices/search"
+	URIAlive                        = "/alive"
+	URIHealth                       = "/health"
+	URIDeploymentsAggregate         = "/deployments/devices/aggregate"
+	URIDeploymentsSearch            = "/deployments/devices/search"
+	URIDeploymentSummariesAggregate = "/deployments/aggregate"
+	URIDeploymentSummariesSearch    = "/deployments/search"
+	URIInventoryAggregate           = "/devices/aggregate"
+	URIInventoryAttrs               = "/devices/attributes"
+	URIInventorySearch              = "/devices/search"
+	URIInventorySearchAttrs         = "/devices/search/attributes"
+	URIInventorySearchInternal      = "/tenants/:tenant_id/devices/search"
+	URIReindexInternal              = "/tenants/:tenant_id/reindex"
+	URIVerifyInternal               = "/tenants/:tenant_id/verify"
 )
 
 // NewRouter returns the gin router
@@ -56,6 +60,8 @@ func NewRouter(reporting reporting.App) *gin.Engine {
 	internalAPI.GET(URIAlive, internal.Alive)
 	internalAPI.GET(URIHealth, internal.Health)
 	internalAPI.POST(URIInventorySearchInternal, internal.SearchDevices)
+	internalAPI.POST(URIReindexInternal, internal.ReindexTenant)
+	internalAPI.GET(URIVerifyInternal, internal.VerifyTenant)
 
 	mgmt := NewManagementController(reporting)
 	mgmtAPI := router.Group(URIManagement)
@@ -69,6 +75,8 @@ func NewRouter(reporting reporting.App) *gin.Engine {
 	// deployments
 	mgmtAPI.POST(URIDeploymentsAggregate, mgmt.AggregateDeployments)
 	mgmtAPI.POST(URIDeploymentsSearch, mgmt.SearchDeployments)
+	mgmtAPI.POST(URIDeploymentSummariesAggregate, mgmt.AggregateDeploymentSummaries)
+	mgmtAPI.POST(URIDeploymentSummariesSearch, mgmt.SearchDeploymentSummaries)
 
 	return router
 }
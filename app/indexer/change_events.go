@@ -0,0 +1,213 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	rconfig "github.com/mendersoftware/reporting/config"
+	"github.com/mendersoftware/reporting/metrics"
+	"github.com/mendersoftware/reporting/model"
+	"github.com/mendersoftware/reporting/store"
+)
+
+// ChangeEventsSubject returns the subject where the change events of the
+// indexed documents are published, or an empty string if they are disabled
+func ChangeEventsSubject(conf config.Reader) string {
+	topic := conf.GetString(rconfig.SettingNatsChangeEventsTopic)
+	if topic == "" {
+		return ""
+	}
+	return conf.GetString(rconfig.SettingNatsStreamName) + "." + topic
+}
+
+// newChangeEvents compares the documents about to be indexed, and the
+// removed ones, with the indexed ones and returns the events for the
+// documents which changed
+func newChangeEvents(
+	tenant, entityType string,
+	indexed map[string]map[string]interface{},
+	docs map[string]interface{},
+	removedIDs []string,
+) ([]model.ChangeEvent, error) {
+	events := make([]model.ChangeEvent, 0, len(docs)+len(removedIDs))
+	for id, doc := range docs {
+		fields, err := documentFields(doc)
+		if err != nil {
+			return nil, err
+		}
+		changed := changedFields(indexed[id], fields)
+		if len(changed) > 0 {
+			events = append(events, model.ChangeEvent{
+				TenantID:          tenant,
+				EntityType:        entityType,
+				ID:                id,
+				ChangedAttributes: changed,
+			})
+		}
+	}
+	for _, id := range removedIDs {
+		if _, ok := indexed[id]; ok {
+			events = append(events, model.ChangeEvent{
+				TenantID:   tenant,
+				EntityType: entityType,
+				ID:         id,
+				Deleted:    true,
+			})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
+
+// documentFields returns the fields of the document as stored in the index
+func documentFields(doc interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode the document")
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the document")
+	}
+	return fields, nil
+}
+
+// changedFields returns the sorted names of the fields added, removed or
+// updated between the two versions of a document; missing and null fields
+// are equivalent
+func changedFields(before, after map[string]interface{}) []string {
+	var changed []string
+	for name, value := range after {
+		if name == model.FieldNameID || name == model.FieldNameTenantID {
+			continue
+		}
+		if !reflect.DeepEqual(before[name], value) {
+			changed = append(changed, name)
+		}
+	}
+	for name, value := range before {
+		if _, ok := after[name]; !ok && value != nil {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// publishChangeEvents publishes the events of the documents written to
+// the index; the documents skipped as stale, and the ones the bulk error, if
+// any, tells failed, were not written
+func (i *indexer) publishChangeEvents(
+	ctx context.Context,
+	events []model.ChangeEvent,
+	stale []string,
+	indexErr error,
+) {
+	l := log.FromContext(ctx)
+	var bulkErr *store.BulkError
+	if indexErr != nil && !errors.As(indexErr, &bulkErr) {
+		return
+	}
+	skipped := make(map[string]bool, len(stale))
+	for _, id := range stale {
+		skipped[id] = true
+	}
+	now := time.Now().UTC()
+	published := make([]model.ChangeEvent, 0, len(events))
+	msgs := make([][]byte, 0, len(events))
+	for _, event := range events {
+		if skipped[event.ID] || (bulkErr != nil && bulkErr.Item(event.ID) != nil) {
+			continue
+		}
+		event.IndexedAt = now
+		data, err := json.Marshal(event)
+		if err != nil {
+			metrics.ChangeEventsPublished.WithLabelValues(metrics.ResultError).Inc()
+			l.Error(errors.Wrapf(err, "failed to encode the change event of %s %s",
+				event.EntityType, event.ID))
+			continue
+		}
+		published = append(published, event)
+		msgs = append(msgs, data)
+	}
+	if len(msgs) == 0 {
+		return
+	}
+	errs := i.nats.JetStreamPublishBatch(ctx, i.changeEventsSubject, msgs)
+	for n, event := range published {
+		if err := errs[n]; err != nil {
+			metrics.ChangeEventsPublished.WithLabelValues(metrics.ResultError).Inc()
+			l.Error(errors.Wrapf(err, "failed to publish the change event of %s %s",
+				event.EntityType, event.ID))
+			continue
+		}
+		metrics.ChangeEventsPublished.WithLabelValues(metrics.ResultOK).Inc()
+	}
+}
+
+// deviceChangeEvents returns the change events of the devices about to be
+// indexed or removed
+func (i *indexer) deviceChangeEvents(
+	ctx context.Context,
+	tenant string,
+	devices, removedDevices []*model.Device,
+) ([]model.ChangeEvent, error) {
+	ids := make([]string, 0, len(devices)+len(removedDevices))
+	docs := make(map[string]interface{}, len(devices))
+	for _, device := range devices {
+		ids = append(ids, device.GetID())
+		docs[device.GetID()] = device
+	}
+	removedIDs := make([]string, 0, len(removedDevices))
+	for _, device := range removedDevices {
+		ids = append(ids, device.GetID())
+		removedIDs = append(removedIDs, device.GetID())
+	}
+	indexed, err := i.store.GetDevices(ctx, tenant, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the indexed devices")
+	}
+	return newChangeEvents(tenant, model.EntityTypeDevice, indexed, docs, removedIDs)
+}
+
+// deploymentChangeEvents returns the change events of the deployments
+// about to be indexed
+func (i *indexer) deploymentChangeEvents(
+	ctx context.Context,
+	tenant string,
+	depls []*model.Deployment,
+) ([]model.ChangeEvent, error) {
+	docs := make(map[string]interface{}, len(depls))
+	for _, depl := range depls {
+		docs[depl.ID] = depl
+	}
+	indexed, err := i.store.GetDeployments(ctx, tenant, depls)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the indexed deployments")
+	}
+	return newChangeEvents(tenant, model.EntityTypeDeployment, indexed, docs, nil)
+}
@@ -0,0 +1,221 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	nats_mocks "github.com/mendersoftware/reporting/client/nats/mocks"
+	"github.com/mendersoftware/reporting/model"
+	"github.com/mendersoftware/reporting/store"
+	store_mocks "github.com/mendersoftware/reporting/store/mocks"
+)
+
+func TestChangedFields(t *testing.T) {
+	testCases := map[string]struct {
+		before map[string]interface{}
+		after  map[string]interface{}
+
+		changed []string
+	}{
+		"new document": {
+			after: map[string]interface{}{
+				"id":                  "1",
+				"tenant_id":           "tenant",
+				"identity_status_str": []interface{}{"accepted"},
+				"location":            nil,
+			},
+			changed: []string{"identity_status_str"},
+		},
+		"updated, added and removed fields": {
+			before: map[string]interface{}{
+				"id":                  "1",
+				"identity_status_str": []interface{}{"pending"},
+				"inventory_foo_str":   []interface{}{"bar"},
+				"inventory_baz_num":   []interface{}{1.0},
+				"location":            nil,
+			},
+			after: map[string]interface{}{
+				"id":                  "1",
+				"identity_status_str": []interface{}{"accepted"},
+				"inventory_baz_num":   []interface{}{1.0},
+				"inventory_new_bool":  []interface{}{true},
+			},
+			changed: []string{
+				"identity_status_str",
+				"inventory_foo_str",
+				"inventory_new_bool",
+			},
+		},
+		"unchanged": {
+			before: map[string]interface{}{
+				"id":                "1",
+				"inventory_baz_num": []interface{}{1.0},
+			},
+			after: map[string]interface{}{
+				"id":                "1",
+				"inventory_baz_num": []interface{}{1.0},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.changed, changedFields(tc.before, tc.after))
+		})
+	}
+}
+
+func TestProcessJobsChangeEvents(t *testing.T) {
+	const (
+		tenantID = "tenant"
+		subject  = "WORKFLOWS.reporting-changes"
+	)
+
+	jobs := []model.Job{}
+	for _, id := range []string{"1", "2", "3"} {
+		jobs = append(jobs, model.Job{
+			Action:   model.ActionReindex,
+			TenantID: tenantID,
+			DeviceID: id,
+			Payload: &model.JobPayload{
+				Version: model.JobPayloadVersion,
+				DeviceAuth: &model.JobPayloadDeviceAuth{
+					Status: "accepted",
+				},
+				Inventory:   &model.JobPayloadInventory{Complete: true},
+				Deployments: &model.JobPayloadDeployments{},
+			},
+		})
+	}
+	indexed := map[string]map[string]interface{}{
+		"1": {
+			"id":                  "1",
+			"tenant_id":           tenantID,
+			"location":            nil,
+			"identity_status_str": []interface{}{"pending"},
+		},
+		"2": {
+			"id":                  "2",
+			"tenant_id":           tenantID,
+			"location":            nil,
+			"identity_status_str": []interface{}{"accepted"},
+		},
+	}
+
+	testCases := map[string]struct {
+		stale        []string
+		bulkIndexErr error
+
+		events []model.ChangeEvent
+	}{
+		"ok": {
+			events: []model.ChangeEvent{{
+				TenantID:          tenantID,
+				EntityType:        model.EntityTypeDevice,
+				ID:                "1",
+				ChangedAttributes: []string{"identity_status_str"},
+			}, {
+				TenantID:          tenantID,
+				EntityType:        model.EntityTypeDevice,
+				ID:                "3",
+				ChangedAttributes: []string{"identity_status_str"},
+			}},
+		},
+		"ok, partial bulk failure": {
+			bulkIndexErr: &store.BulkError{Items: []store.BulkItemResult{{
+				ID:     "3",
+				Status: http.StatusTooManyRequests,
+			}}},
+			events: []model.ChangeEvent{{
+				TenantID:          tenantID,
+				EntityType:        model.EntityTypeDevice,
+				ID:                "1",
+				ChangedAttributes: []string{"identity_status_str"},
+			}},
+		},
+		"ok, stale device": {
+			// the index holds a newer version of the device
+			stale: []string{"3"},
+			events: []model.ChangeEvent{{
+				TenantID:          tenantID,
+				EntityType:        model.EntityTypeDevice,
+				ID:                "1",
+				ChangedAttributes: []string{"identity_status_str"},
+			}},
+		},
+		"ko, bulk failure": {
+			bulkIndexErr: errors.New("bulk index error"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			store := &store_mocks.Store{}
+			defer store.AssertExpectations(t)
+			store.On("GetDevices", ctx, tenantID, mock.AnythingOfType("[]string")).
+				Return(indexed, nil)
+			store.On("BulkIndexDevices",
+				ctx,
+				mock.AnythingOfType("[]*model.Device"),
+				[]*model.Device{},
+			).Return(tc.stale, tc.bulkIndexErr)
+
+			ds := &store_mocks.DataStore{}
+			ds.On("UpdateAndGetMapping", ctx, tenantID, mock.Anything).
+				Return(&model.Mapping{TenantID: tenantID}, nil).Maybe()
+
+			var published []model.ChangeEvent
+			nats := &nats_mocks.Client{}
+			defer nats.AssertExpectations(t)
+			if len(tc.events) > 0 {
+				nats.On("JetStreamPublishBatch",
+					ctx,
+					subject,
+					mock.AnythingOfType("[][]uint8"),
+				).
+					Run(func(args mock.Arguments) {
+						for _, data := range args.Get(2).([][]byte) {
+							var event model.ChangeEvent
+							err := json.Unmarshal(data, &event)
+							if assert.NoError(t, err) {
+								assert.False(t, event.IndexedAt.IsZero())
+								event.IndexedAt = time.Time{}
+								published = append(published, event)
+							}
+						}
+					}).
+					Return(make([]error, len(tc.events)))
+			}
+			nats.On("Flush", ctx).Return(nil)
+
+			indexer := NewIndexer(store, ds, nats, nil, nil, nil,
+				WithChangeEvents(subject))
+
+			indexer.ProcessJobs(ctx, jobs)
+
+			assert.Equal(t, tc.events, published)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+
+	"github.com/mendersoftware/reporting/client/nats"
+	rconfig "github.com/mendersoftware/reporting/config"
+	"github.com/mendersoftware/reporting/metrics"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// maxDebounceWindow is the longest debounce window: the jobs are
+// acknowledged only after being held for the window, queued and indexed,
+// and the jobs not acknowledged within the ack wait are redelivered, and
+// eventually dropped, so the window must leave most of the ack wait to
+// queue and index them
+const maxDebounceWindow = nats.AckWait / 3
+
+// debounceWindow returns the debounce window from the configuration
+func debounceWindow(conf config.Reader) (time.Duration, error) {
+	debounceMs := conf.GetInt(rconfig.SettingReindexDebounceMsec)
+	if debounceMs < 0 {
+		return 0, fmt.Errorf(
+			"%s: must be a non-negative integer",
+			rconfig.SettingReindexDebounceMsec,
+		)
+	}
+	window := time.Duration(debounceMs) * time.Millisecond
+	if window > maxDebounceWindow {
+		return 0, fmt.Errorf(
+			"%s: must not exceed %d, a third of the NATS ack wait",
+			rconfig.SettingReindexDebounceMsec,
+			maxDebounceWindow.Milliseconds(),
+		)
+	}
+	return window, nil
+}
+
+type debounceKey struct {
+	tenantID string
+	action   string
+	id       string
+}
+
+type debounced struct {
+	key      debounceKey
+	deadline time.Time
+	jobs     []model.Job
+}
+
+// debouncer holds the jobs for the same entity for a time window, so that
+// repeated jobs are released together and fetched from upstream once
+type debouncer struct {
+	window  time.Duration
+	pending map[debounceKey]*debounced
+	// queue holds the pending entities sorted by deadline; as the window
+	// is constant, it is the order in which the entities were added
+	queue []*debounced
+}
+
+func newDebouncer(window time.Duration) *debouncer {
+	return &debouncer{
+		window:  window,
+		pending: make(map[debounceKey]*debounced),
+	}
+}
+
+// Add holds the job until the window for its entity expires
+func (d *debouncer) Add(job model.Job, now time.Time) {
+	key := debounceKey{
+		tenantID: job.TenantID,
+		action:   jobIndexAction(&job),
+		id:       jobDocumentID(&job),
+	}
+	if entry, ok := d.pending[key]; ok {
+		entry.jobs = append(entry.jobs, job)
+		return
+	}
+	entry := &debounced{
+		key:      key,
+		deadline: now.Add(d.window),
+		jobs:     []model.Job{job},
+	}
+	d.pending[key] = entry
+	d.queue = append(d.queue, entry)
+}
+
+// Next returns the time at which the next entity is released, and false
+// if no jobs are pending
+func (d *debouncer) Next() (time.Time, bool) {
+	if len(d.queue) == 0 {
+		return time.Time{}, false
+	}
+	return d.queue[0].deadline, true
+}
+
+// Release returns the jobs of the entities whose window expired; the jobs
+// of the same entity are returned next to each other, in order
+func (d *debouncer) Release(now time.Time) []model.Job {
+	var jobs []model.Job
+	for len(d.queue) > 0 && !d.queue[0].deadline.After(now) {
+		jobs = append(jobs, d.pop()...)
+	}
+	return jobs
+}
+
+// Flush returns all the pending jobs
+func (d *debouncer) Flush() []model.Job {
+	var jobs []model.Job
+	for len(d.queue) > 0 {
+		jobs = append(jobs, d.pop()...)
+	}
+	return jobs
+}
+
+func (d *debouncer) pop() []model.Job {
+	entry := d.queue[0]
+	d.queue[0] = nil
+	d.queue = d.queue[1:]
+	delete(d.pending, entry.key)
+	if len(entry.jobs) > 1 {
+		metrics.JobsCoalesced.Add(float64(len(entry.jobs) - 1))
+	}
+	return entry.jobs
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	rconfig "github.com/mendersoftware/reporting/config"
+	"github.com/mendersoftware/reporting/metrics"
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestDebouncer(t *testing.T) {
+	const window = time.Second
+	now := time.Now()
+
+	d := newDebouncer(window)
+	_, ok := d.Next()
+	assert.False(t, ok)
+
+	jobs := []model.Job{
+		{Action: model.ActionReindex, TenantID: "t1", DeviceID: "d1", RequestID: "1"},
+		{Action: model.ActionReindex, TenantID: "t1", DeviceID: "d2", RequestID: "2"},
+		{Action: model.ActionReindex, TenantID: "t1", DeviceID: "d1", RequestID: "3"},
+		{Action: model.ActionReindex, TenantID: "t2", DeviceID: "d1", RequestID: "4"},
+		{Action: model.ActionReindex, TenantID: "t1", DeviceID: "d1", RequestID: "5"},
+	}
+	coalesced := testutil.ToFloat64(metrics.JobsCoalesced)
+
+	d.Add(jobs[0], now)
+	d.Add(jobs[1], now.Add(window/2))
+	d.Add(jobs[2], now.Add(window/2))
+	d.Add(jobs[3], now.Add(window))
+
+	next, ok := d.Next()
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(window), next)
+
+	assert.Empty(t, d.Release(now.Add(window/2)))
+	assert.Equal(t, []model.Job{jobs[0], jobs[2]}, d.Release(now.Add(window)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.JobsCoalesced)-coalesced)
+
+	// the window for d1 starts over once released
+	d.Add(jobs[4], now.Add(window))
+	next, _ = d.Next()
+	assert.Equal(t, now.Add(window*3/2), next)
+
+	assert.Equal(t, []model.Job{jobs[1], jobs[3], jobs[4]}, d.Flush())
+	_, ok = d.Next()
+	assert.False(t, ok)
+	assert.Empty(t, d.pending)
+}
+
+func TestDebounceWindow(t *testing.T) {
+	testCases := map[string]struct {
+		debounceMs int
+
+		window   time.Duration
+		errMatch string
+	}{
+		"ok, disabled": {},
+		"ok": {
+			debounceMs: 500,
+			window:     500 * time.Millisecond,
+		},
+		"ok, longest window": {
+			debounceMs: 10000,
+			window:     10 * time.Second,
+		},
+		"ko, negative": {
+			debounceMs: -1,
+			errMatch:   "must be a non-negative integer",
+		},
+		"ko, too close to the ack wait": {
+			debounceMs: 10001,
+			errMatch:   "must not exceed 10000",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			conf := viper.New()
+			conf.Set(rconfig.SettingReindexDebounceMsec, tc.debounceMs)
+			window, err := debounceWindow(conf)
+			if tc.errMatch != "" {
+				assert.ErrorContains(t, err, tc.errMatch)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.window, window)
+			}
+		})
+	}
+}
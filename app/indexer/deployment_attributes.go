@@ -0,0 +1,171 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+
+	"github.com/mendersoftware/reporting/client/inventory"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// deviceAttribute identifies a device attribute by scope and name
+type deviceAttribute struct {
+	Scope string
+	Name  string
+}
+
+// parseDeviceAttributes parses the "scope/name" device attribute
+// identifiers; the scope defaults to inventory
+func parseDeviceAttributes(attrs []string) []deviceAttribute {
+	parsed := make([]deviceAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		parts := strings.SplitN(attr, "/", 2)
+		if len(parts) == 1 {
+			parsed = append(parsed, deviceAttribute{
+				Scope: model.ScopeInventory,
+				Name:  parts[0],
+			})
+		} else if parts[0] != "" && parts[1] != "" {
+			parsed = append(parsed, deviceAttribute{
+				Scope: parts[0],
+				Name:  parts[1],
+			})
+		}
+	}
+	return parsed
+}
+
+// setDeploymentsDeviceAttributes sets the snapshot of the device attributes
+// on the deployments; deployments already indexed keep their snapshot, so
+// that it reflects the device at the time the deployment was first indexed
+func (i *indexer) setDeploymentsDeviceAttributes(
+	ctx context.Context,
+	tenant string,
+	depls []*model.Deployment,
+) error {
+	if len(i.deploymentsDeviceAttributes) == 0 || len(depls) == 0 {
+		return nil
+	}
+	snapshots, err := i.getDeploymentsDeviceAttributes(ctx, tenant, depls)
+	if err != nil {
+		return err
+	}
+
+	deviceIDs := make([]string, 0, len(depls))
+	seen := make(map[string]bool, len(depls))
+	for _, depl := range depls {
+		if snapshot, ok := snapshots[depl.ID]; ok {
+			depl.DeviceAttributes = snapshot
+		} else if !seen[depl.DeviceID] {
+			seen[depl.DeviceID] = true
+			deviceIDs = append(deviceIDs, depl.DeviceID)
+		}
+	}
+	if len(deviceIDs) == 0 {
+		return nil
+	}
+
+	devices, err := i.invClient.GetDevices(ctx, tenant, deviceIDs)
+	if err != nil {
+		return errors.Wrap(err, "failed to get devices from inventory")
+	}
+	deviceAttributes := make(map[string]map[string]interface{}, len(devices))
+	for _, device := range devices {
+		deviceAttributes[string(device.ID)] = i.snapshotDeviceAttributes(device.Attributes)
+	}
+	for _, depl := range depls {
+		if depl.DeviceAttributes == nil {
+			depl.DeviceAttributes = deviceAttributes[depl.DeviceID]
+		}
+	}
+	return nil
+}
+
+// snapshotDeviceAttributes returns the configured device attributes, by
+// attribute field name
+func (i *indexer) snapshotDeviceAttributes(
+	attrs inventory.DeviceAttributes,
+) map[string]interface{} {
+	snapshot := make(map[string]interface{}, len(i.deploymentsDeviceAttributes))
+	for _, attr := range attrs {
+		for _, selected := range i.deploymentsDeviceAttributes {
+			if attr.Scope != selected.Scope || attr.Name != selected.Name {
+				continue
+			}
+			name, value := model.NewInventoryAttribute(attr.Scope).
+				SetName(attr.Name).
+				SetVal(attr.Value).
+				Map()
+			if value != nil {
+				snapshot[name] = value
+			}
+			break
+		}
+	}
+	return snapshot
+}
+
+// getDeploymentsDeviceAttributes returns the device attributes snapshots
+// of the deployments already indexed, by deployment ID
+func (i *indexer) getDeploymentsDeviceAttributes(
+	ctx context.Context,
+	tenant string,
+	depls []*model.Deployment,
+) (map[string]map[string]interface{}, error) {
+	ids := make([]string, len(depls))
+	for n, depl := range depls {
+		ids[n] = depl.ID
+	}
+	query := model.NewQuery().
+		Must(model.M{
+			"term": model.M{model.FieldNameTenantID: tenant},
+		}).
+		Must(model.M{
+			"terms": model.M{model.FieldNameID: ids},
+		}).
+		Must(model.M{
+			"exists": model.M{"field": model.FieldNameDeviceAttributes},
+		}).
+		WithSize(len(ids)).
+		With(model.M{
+			"_source": []string{model.FieldNameID, model.FieldNameDeviceAttributes},
+		})
+
+	ctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenant})
+	res, err := i.store.SearchDeployments(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search the indexed deployments")
+	}
+
+	snapshots := make(map[string]map[string]interface{}, len(ids))
+	hits, _ := res["hits"].(map[string]interface{})
+	hitsS, _ := hits["hits"].([]interface{})
+	for _, hit := range hitsS {
+		hitM, _ := hit.(map[string]interface{})
+		source, _ := hitM["_source"].(map[string]interface{})
+		id, _ := source[model.FieldNameID].(string)
+		attrs, ok := source[model.FieldNameDeviceAttributes].(map[string]interface{})
+		if id != "" && ok {
+			snapshots[id] = attrs
+		}
+	}
+	return snapshots, nil
+}
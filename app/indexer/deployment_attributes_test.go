@@ -0,0 +1,179 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/client/inventory"
+	inventory_mocks "github.com/mendersoftware/reporting/client/inventory/mocks"
+	"github.com/mendersoftware/reporting/model"
+	store_mocks "github.com/mendersoftware/reporting/store/mocks"
+)
+
+func TestParseDeviceAttributes(t *testing.T) {
+	attrs := parseDeviceAttributes([]string{
+		"inventory/device_type",
+		"system/group",
+		"rootfs-image.version",
+		"inventory/",
+		"/group",
+	})
+	assert.Equal(t, []deviceAttribute{
+		{Scope: model.ScopeInventory, Name: "device_type"},
+		{Scope: model.ScopeSystem, Name: "group"},
+		{Scope: model.ScopeInventory, Name: "rootfs-image.version"},
+	}, attrs)
+}
+
+func TestSetDeploymentsDeviceAttributes(t *testing.T) {
+	const tenantID = "tenant"
+
+	testCases := map[string]struct {
+		depls []*model.Deployment
+
+		searchResult model.M
+		searchErr    error
+
+		inventoryDeviceIDs []string
+		inventoryDevices   []inventory.Device
+		inventoryErr       error
+
+		deviceAttributes map[string]map[string]interface{}
+		err              error
+	}{
+		"ok": {
+			depls: []*model.Deployment{
+				{ID: "dd1", DeviceID: "1"},
+				{ID: "dd2", DeviceID: "2"},
+				{ID: "dd3", DeviceID: "2"},
+			},
+			searchResult: model.M{
+				"hits": map[string]interface{}{
+					"hits": []interface{}{
+						map[string]interface{}{
+							"_source": map[string]interface{}{
+								"id": "dd1",
+								"device_attributes": map[string]interface{}{
+									"inventory_device_type_str": []interface{}{"rpi3"},
+								},
+							},
+						},
+					},
+				},
+			},
+			inventoryDeviceIDs: []string{"2"},
+			inventoryDevices: []inventory.Device{{
+				ID: "2",
+				Attributes: inventory.DeviceAttributes{
+					{Scope: model.ScopeInventory, Name: "device_type", Value: "rpi4"},
+					{Scope: model.ScopeInventory, Name: "mac", Value: "00:11:22:33:44"},
+					{Scope: model.ScopeSystem, Name: "group", Value: "production"},
+				},
+			}},
+			deviceAttributes: map[string]map[string]interface{}{
+				"dd1": {"inventory_device_type_str": []interface{}{"rpi3"}},
+				"dd2": {
+					"inventory_device_type_str": []string{"rpi4"},
+					"system_group_str":          []string{"production"},
+				},
+				"dd3": {
+					"inventory_device_type_str": []string{"rpi4"},
+					"system_group_str":          []string{"production"},
+				},
+			},
+		},
+		"ok, all snapshots indexed": {
+			depls: []*model.Deployment{
+				{ID: "dd1", DeviceID: "1"},
+			},
+			searchResult: model.M{
+				"hits": map[string]interface{}{
+					"hits": []interface{}{
+						map[string]interface{}{
+							"_source": map[string]interface{}{
+								"id":                "dd1",
+								"device_attributes": map[string]interface{}{},
+							},
+						},
+					},
+				},
+			},
+			deviceAttributes: map[string]map[string]interface{}{
+				"dd1": {},
+			},
+		},
+		"ko, failure in store": {
+			depls: []*model.Deployment{
+				{ID: "dd1", DeviceID: "1"},
+			},
+			searchErr: errors.New("store error"),
+			err:       errors.New("failed to search the indexed deployments: store error"),
+		},
+		"ko, failure in inventory": {
+			depls: []*model.Deployment{
+				{ID: "dd1", DeviceID: "1"},
+			},
+			searchResult:       model.M{},
+			inventoryDeviceIDs: []string{"1"},
+			inventoryErr:       errors.New("inventory error"),
+			err:                errors.New("failed to get devices from inventory: inventory error"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			store := &store_mocks.Store{}
+			defer store.AssertExpectations(t)
+			store.On("SearchDeployments",
+				mock.AnythingOfType("*context.valueCtx"),
+				mock.AnythingOfType("*model.query"),
+			).Return(tc.searchResult, tc.searchErr)
+
+			invClient := &inventory_mocks.Client{}
+			defer invClient.AssertExpectations(t)
+			if tc.inventoryDeviceIDs != nil {
+				invClient.On("GetDevices",
+					ctx,
+					tenantID,
+					tc.inventoryDeviceIDs,
+				).Return(tc.inventoryDevices, tc.inventoryErr)
+			}
+
+			indexer := NewIndexer(store, nil, nil, nil, invClient, nil,
+				WithDeploymentsDeviceAttributes([]string{
+					"inventory/device_type",
+					"system/group",
+				})).(*indexer)
+
+			err := indexer.setDeploymentsDeviceAttributes(ctx, tenantID, tc.depls)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				for _, depl := range tc.depls {
+					assert.Equal(t, tc.deviceAttributes[depl.ID], depl.DeviceAttributes)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/client/deployments"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// finishedDeviceStatuses are the final statuses of the device deployments,
+// and whether they count as a successful installation
+var finishedDeviceStatuses = map[string]bool{
+	"success":           true,
+	"already-installed": true,
+	"failure":           false,
+	"noartifact":        false,
+	"aborted":           false,
+	"decommissioned":    false,
+}
+
+// indexDeploymentSummaries refreshes the summaries of the deployments the
+// device deployments belong to
+func (i *indexer) indexDeploymentSummaries(
+	ctx context.Context,
+	tenant string,
+	deviceDeployments []*deployments.DeviceDeployment,
+) error {
+	seen := make(map[string]bool, len(deviceDeployments))
+	deploymentIDs := make([]string, 0, len(deviceDeployments))
+	for _, d := range deviceDeployments {
+		if d.Deployment == nil || seen[d.Deployment.Id] {
+			continue
+		}
+		seen[d.Deployment.Id] = true
+		deploymentIDs = append(deploymentIDs, d.Deployment.Id)
+	}
+	if len(deploymentIDs) == 0 {
+		return nil
+	}
+	depls, err := i.deplClient.ListDeployments(ctx, tenant, deploymentIDs)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the deployments from deployments")
+	}
+	summaries := make([]*model.DeploymentSummary, 0, len(depls))
+	for _, depl := range depls {
+		if depl != nil && seen[depl.Id] {
+			summaries = append(summaries, newDeploymentSummary(tenant, depl))
+		}
+	}
+	if len(summaries) > 0 {
+		err = i.store.BulkIndexDeploymentSummaries(ctx, summaries)
+		if err != nil {
+			return errors.Wrap(err, "failed to bulk index the deployment summaries")
+		}
+	}
+	return nil
+}
+
+func newDeploymentSummary(
+	tenant string,
+	depl *deployments.Deployment,
+) *model.DeploymentSummary {
+	summary := &model.DeploymentSummary{
+		ID:                     depl.Id,
+		TenantID:               tenant,
+		DeploymentID:           depl.Id,
+		DeploymentName:         depl.Name,
+		DeploymentArtifactName: depl.ArtifactName,
+		DeploymentType:         depl.Type,
+		DeploymentStatus:       depl.Status,
+		DeploymentCreated:      depl.Created,
+		DeploymentFinished:     depl.Finished,
+		DeploymentFilterID:     depl.FilterId,
+		DeploymentAllDevices:   depl.AllDevices,
+		DeploymentGroups:       depl.Groups,
+		DeploymentPhased:       len(depl.Phases) > 0,
+		InitialDeviceCount:     depl.InitialDeviceCount,
+	}
+	if depl.DeviceCount != nil {
+		summary.DeviceCount = *depl.DeviceCount
+	}
+	for _, phase := range depl.Phases {
+		summary.DeploymentPhases = append(summary.DeploymentPhases,
+			model.DeploymentSummaryPhase{
+				ID:          phase.Id,
+				BatchSize:   phase.BatchSize,
+				StartTs:     phase.StartTs,
+				DeviceCount: phase.DeviceCount,
+			})
+	}
+	if depl.Statistics != nil {
+		summary.DeviceCounts = depl.Statistics.Status
+		summary.SuccessRatio = successRatio(depl.Statistics.Status)
+	}
+	return summary
+}
+
+// successRatio returns the share of the finished device deployments
+// which installed the artifact successfully
+func successRatio(counts map[string]int) float64 {
+	var finished, succeeded int
+	for status, count := range counts {
+		success, ok := finishedDeviceStatuses[status]
+		if !ok {
+			continue
+		}
+		finished += count
+		if success {
+			succeeded += count
+		}
+	}
+	if finished == 0 {
+		return 0
+	}
+	return float64(succeeded) / float64(finished)
+}
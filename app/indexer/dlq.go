@@ -0,0 +1,77 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/reporting/client/nats"
+	rconfig "github.com/mendersoftware/reporting/config"
+)
+
+// DeadLetterSubject returns the subject where the jobs which can't be
+// processed are published, or an empty string if dead-lettering is disabled
+func DeadLetterSubject(conf config.Reader) string {
+	topic := conf.GetString(rconfig.SettingNatsDeadLetterTopic)
+	if topic == "" {
+		return ""
+	}
+	return conf.GetString(rconfig.SettingNatsStreamName) + "." + topic
+}
+
+// ReplayDeadLetters publishes the dead-lettered jobs to the jobs subject
+// again, removing them from the dead-letter subject; it returns the number
+// of replayed jobs
+func ReplayDeadLetters(
+	ctx context.Context,
+	nats nats.Client,
+	dlq, subject string,
+) (int, error) {
+	l := log.FromContext(ctx)
+	letters, err := nats.JetStreamDeadLetters(ctx, dlq)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get the dead letters")
+	}
+	replayed := 0
+	for _, letter := range letters {
+		if letter.Job == nil {
+			l.Warnf("skipping dead letter %d: the job could not be decoded",
+				letter.Sequence)
+			continue
+		}
+		data, err := json.Marshal(letter.Job)
+		if err != nil {
+			return replayed, err
+		}
+		err = nats.JetStreamPublish(subject, data)
+		if err != nil {
+			return replayed, errors.Wrapf(err,
+				"failed to replay the dead letter %d", letter.Sequence)
+		}
+		err = nats.JetStreamDeleteDeadLetter(ctx, dlq, letter.Sequence)
+		if err != nil {
+			return replayed, errors.Wrapf(err,
+				"failed to delete the dead letter %d", letter.Sequence)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
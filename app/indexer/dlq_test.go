@@ -0,0 +1,109 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	nats_mocks "github.com/mendersoftware/reporting/client/nats/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestReplayDeadLetters(t *testing.T) {
+	const (
+		dlq     = "WORKFLOWS.reporting-dead-letter"
+		subject = "WORKFLOWS.reporting"
+	)
+	job := &model.Job{
+		Action:   model.ActionReindex,
+		TenantID: "tenant",
+		DeviceID: "device",
+	}
+	jobData, _ := json.Marshal(job)
+
+	testCases := map[string]struct {
+		letters    []model.DeadLetter
+		lettersErr error
+
+		publishErr error
+		deleteErr  error
+
+		replayed int
+		err      error
+	}{
+		"ok": {
+			letters: []model.DeadLetter{
+				{Sequence: 1, Job: job},
+				{Sequence: 2, Data: []byte("bad job")},
+			},
+			replayed: 1,
+		},
+		"ok, no dead letters": {},
+		"ko, failed to get the dead letters": {
+			lettersErr: errors.New("abc"),
+			err:        errors.New("failed to get the dead letters: abc"),
+		},
+		"ko, failed to publish": {
+			letters: []model.DeadLetter{
+				{Sequence: 1, Job: job},
+			},
+			publishErr: errors.New("abc"),
+			err:        errors.New("failed to replay the dead letter 1: abc"),
+		},
+		"ko, failed to delete": {
+			letters: []model.DeadLetter{
+				{Sequence: 1, Job: job},
+			},
+			deleteErr: errors.New("abc"),
+			err:       errors.New("failed to delete the dead letter 1: abc"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			nats := &nats_mocks.Client{}
+			defer nats.AssertExpectations(t)
+
+			nats.On("JetStreamDeadLetters", ctx, dlq).
+				Return(tc.letters, tc.lettersErr)
+			for _, letter := range tc.letters {
+				if letter.Job == nil {
+					continue
+				}
+				nats.On("JetStreamPublish", subject, jobData).
+					Return(tc.publishErr)
+				if tc.publishErr == nil {
+					nats.On("JetStreamDeleteDeadLetter", ctx, dlq, letter.Sequence).
+						Return(tc.deleteErr)
+				}
+			}
+
+			replayed, err := ReplayDeadLetters(ctx, nats, dlq, subject)
+			assert.Equal(t, tc.replayed, replayed)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -16,11 +16,18 @@ package indexer
 
 import (
 	"context"
+	"errors"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/config"
 
 	"github.com/mendersoftware/reporting/client/deployments"
 	"github.com/mendersoftware/reporting/client/deviceauth"
+	"github.com/mendersoftware/reporting/client/deviceconnect"
+	"github.com/mendersoftware/reporting/client/devicemonitor"
 	"github.com/mendersoftware/reporting/client/inventory"
 	"github.com/mendersoftware/reporting/client/nats"
+	rconfig "github.com/mendersoftware/reporting/config"
 	"github.com/mendersoftware/reporting/mapping"
 	"github.com/mendersoftware/reporting/model"
 	"github.com/mendersoftware/reporting/store"
@@ -28,17 +35,71 @@ import (
 
 //go:generate ../../x/mockgen.sh
 type Indexer interface {
-	GetJobs(ctx context.Context, jobs chan model.Job) error
+	GetJobs(ctx context.Context, jobs []chan model.Job) error
 	ProcessJobs(ctx context.Context, jobs []model.Job)
+	HealthCheck(ctx context.Context) error
+	ReindexAll(ctx context.Context) error
+	ReindexTenant(ctx context.Context, tenantID string) error
+	VerifyTenant(ctx context.Context, tenantID string, sample int) (*model.DriftReport, error)
 }
 
 type indexer struct {
 	store      store.Store
+	ds         store.DataStore
 	mapper     mapping.Mapper
 	nats       nats.Client
 	devClient  deviceauth.Client
 	invClient  inventory.Client
 	deplClient deployments.Client
+	connClient deviceconnect.Client
+	monClient  devicemonitor.Client
+
+	failedDeploymentsWindow     time.Duration
+	deploymentsDeviceAttributes []deviceAttribute
+	changeEventsSubject         string
+}
+
+// Option configures the optional dependencies of the indexer
+type Option func(*indexer)
+
+// WithDeviceConnectClient sets the deviceconnect client used to index
+// the connectivity attributes of the devices
+func WithDeviceConnectClient(connClient deviceconnect.Client) Option {
+	return func(i *indexer) {
+		i.connClient = connClient
+	}
+}
+
+// WithDeviceMonitorClient sets the devicemonitor client used to index
+// the monitor attributes of the devices
+func WithDeviceMonitorClient(monClient devicemonitor.Client) Option {
+	return func(i *indexer) {
+		i.monClient = monClient
+	}
+}
+
+// WithFailedDeploymentsWindow sets the time window the failed deployments
+// of the devices are counted within; zero disables the count
+func WithFailedDeploymentsWindow(window time.Duration) Option {
+	return func(i *indexer) {
+		i.failedDeploymentsWindow = window
+	}
+}
+
+// WithDeploymentsDeviceAttributes sets the device attributes, in the
+// "scope/name" form, copied onto the deployments at index time
+func WithDeploymentsDeviceAttributes(attrs []string) Option {
+	return func(i *indexer) {
+		i.deploymentsDeviceAttributes = parseDeviceAttributes(attrs)
+	}
+}
+
+// WithChangeEvents sets the subject where the change events of the
+// indexed documents are published
+func WithChangeEvents(subject string) Option {
+	return func(i *indexer) {
+		i.changeEventsSubject = subject
+	}
 }
 
 func NewIndexer(
@@ -48,14 +109,75 @@ func NewIndexer(
 	devClient deviceauth.Client,
 	invClient inventory.Client,
 	deplClient deployments.Client,
+	opts ...Option,
 ) Indexer {
 	mapper := mapping.NewMapper(ds)
-	return &indexer{
+	i := &indexer{
 		store:      store,
+		ds:         ds,
 		mapper:     mapper,
 		nats:       nats,
 		devClient:  devClient,
 		invClient:  invClient,
 		deplClient: deplClient,
 	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// NewIndexerFromConfig returns a new indexer using the upstream service
+// addresses from the configuration
+func NewIndexerFromConfig(
+	conf config.Reader,
+	store store.Store,
+	ds store.DataStore,
+	nats nats.Client,
+) Indexer {
+	invClient := inventory.NewClient(
+		conf.GetString(rconfig.SettingInventoryAddr),
+	)
+
+	devClient := deviceauth.NewClient(
+		conf.GetString(rconfig.SettingDeviceAuthAddr),
+	)
+
+	deplClient := deployments.NewClient(
+		conf.GetString(rconfig.SettingDeploymentsAddr),
+	)
+
+	failedDays := conf.GetInt(rconfig.SettingFailedDeploymentsWindowDays)
+	opts := []Option{
+		WithFailedDeploymentsWindow(time.Duration(failedDays) * 24 * time.Hour),
+		WithDeploymentsDeviceAttributes(
+			conf.GetStringSlice(rconfig.SettingDeploymentsDeviceAttributes),
+		),
+	}
+	if addr := conf.GetString(rconfig.SettingDeviceConnectAddr); addr != "" {
+		opts = append(opts, WithDeviceConnectClient(deviceconnect.NewClient(addr)))
+	}
+	if addr := conf.GetString(rconfig.SettingDeviceMonitorAddr); addr != "" {
+		opts = append(opts, WithDeviceMonitorClient(devicemonitor.NewClient(addr)))
+	}
+	// the change events are published only by the indexers connected to nats
+	if subject := ChangeEventsSubject(conf); subject != "" && nats != nil {
+		opts = append(opts, WithChangeEvents(subject))
+	}
+
+	return NewIndexer(store, ds, nats, devClient, invClient, deplClient, opts...)
+}
+
+// HealthCheck performs a health check and returns an error if it fails
+func (i *indexer) HealthCheck(ctx context.Context) error {
+	if !i.nats.IsConnected() {
+		return errors.New("not connected to nats")
+	} else if !i.nats.IsSubscribed() {
+		return errors.New("the JetStream subscription is not running")
+	}
+	err := i.ds.Ping(ctx)
+	if err == nil {
+		err = i.store.Ping(ctx)
+	}
+	return err
 }
@@ -15,12 +15,75 @@
 package indexer
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	nats_mocks "github.com/mendersoftware/reporting/client/nats/mocks"
+	store_mocks "github.com/mendersoftware/reporting/store/mocks"
 )
 
 func TestNewIndexer(t *testing.T) {
 	indexer := NewIndexer(nil, nil, nil, nil, nil, nil)
 	assert.NotNil(t, indexer)
 }
+
+func TestHealthCheck(t *testing.T) {
+	testCases := map[string]struct {
+		connected  bool
+		subscribed bool
+		dsErr      error
+		storeErr   error
+
+		err error
+	}{
+		"ok": {
+			connected:  true,
+			subscribed: true,
+		},
+		"ko, nats not connected": {
+			err: errors.New("not connected to nats"),
+		},
+		"ko, subscription not running": {
+			connected: true,
+			err:       errors.New("the JetStream subscription is not running"),
+		},
+		"ko, mongo": {
+			connected:  true,
+			subscribed: true,
+			dsErr:      errors.New("mongo error"),
+			err:        errors.New("mongo error"),
+		},
+		"ko, opensearch": {
+			connected:  true,
+			subscribed: true,
+			storeErr:   errors.New("opensearch error"),
+			err:        errors.New("opensearch error"),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			nats := &nats_mocks.Client{}
+			nats.On("IsConnected").Return(tc.connected)
+			nats.On("IsSubscribed").Return(tc.subscribed)
+
+			ds := &store_mocks.DataStore{}
+			ds.On("Ping", ctx).Return(tc.dsErr)
+
+			store := &store_mocks.Store{}
+			store.On("Ping", ctx).Return(tc.storeErr)
+
+			indexer := NewIndexer(store, ds, nats, nil, nil, nil)
+			err := indexer.HealthCheck(ctx)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -16,7 +16,9 @@ package indexer
 
 import (
 	"context"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -25,88 +27,256 @@ import (
 
 	"github.com/mendersoftware/reporting/client/deployments"
 	"github.com/mendersoftware/reporting/client/deviceauth"
+	"github.com/mendersoftware/reporting/client/deviceconnect"
+	"github.com/mendersoftware/reporting/client/devicemonitor"
 	"github.com/mendersoftware/reporting/client/inventory"
+	"github.com/mendersoftware/reporting/client/nats"
 	rconfig "github.com/mendersoftware/reporting/config"
+	"github.com/mendersoftware/reporting/metrics"
 	"github.com/mendersoftware/reporting/model"
+	"github.com/mendersoftware/reporting/store"
 )
 
-const undefinedCoordinateIdx = -1
+const (
+	undefinedCoordinateIdx = -1
+	// jobRetryDelay is the delay before a failed job is redelivered
+	jobRetryDelay = 10 * time.Second
+)
 
 type IDs map[string]bool
 type ActionIDs map[string]IDs
 type TenantActionIDs map[string]ActionIDs
 
-func (i *indexer) GetJobs(ctx context.Context, jobs chan model.Job) error {
+// GetJobs subscribes the NATS consumers of the lanes, which deliver the
+// jobs of the lane i to jobs[i]
+func (i *indexer) GetJobs(ctx context.Context, jobs []chan model.Job) error {
 	streamName := config.Config.GetString(rconfig.SettingNatsStreamName)
 
 	topic := config.Config.GetString(rconfig.SettingNatsSubscriberTopic)
 	subject := streamName + "." + topic
-	durableName := config.Config.GetString(rconfig.SettingNatsSubscriberDurable)
-
-	err := i.nats.JetStreamSubscribe(ctx, subject, durableName, jobs)
-	if err != nil {
-		return errors.Wrap(err, "failed to subscribe to the nats JetStream")
+	for lane, durableName := range LaneDurables(config.Config) {
+		opts := SubscribeOptions(config.Config)
+		opts.Filter = laneFilter(lane)
+		err := i.nats.JetStreamSubscribe(ctx, subject, durableName, opts, jobs[lane])
+		if err != nil {
+			return errors.Wrap(err, "failed to subscribe to the nats JetStream")
+		}
 	}
 
 	return nil
 }
 
+// SubscribeOptions returns the JetStream subscription options from the
+// configuration; the fetch batch size and max wait default to the reindex
+// batch size and max time
+func SubscribeOptions(conf config.Reader) nats.SubscribeOptions {
+	batchSize := conf.GetInt(rconfig.SettingNatsFetchBatchSize)
+	if batchSize <= 0 {
+		batchSize = conf.GetInt(rconfig.SettingReindexBatchSize)
+	}
+	maxWaitMs := conf.GetInt(rconfig.SettingNatsFetchMaxWaitMsec)
+	if maxWaitMs <= 0 {
+		maxWaitMs = conf.GetInt(rconfig.SettingReindexMaxTimeMsec)
+	}
+	return nats.SubscribeOptions{
+		DeadLetterSubject: DeadLetterSubject(conf),
+		FetchBatchSize:    batchSize,
+		FetchMaxWait:      time.Duration(maxWaitMs) * time.Millisecond,
+	}
+}
+
 func (i *indexer) ProcessJobs(ctx context.Context, jobs []model.Job) {
 	l := log.FromContext(ctx)
 	l.Debugf("Processing %d jobs", len(jobs))
 	tenantsActionIDs := groupJobsIntoTenantActionIDs(jobs)
 	for tenant, actionIDs := range tenantsActionIDs {
 		for action, IDs := range actionIDs {
+			var err error
 			if action == model.ActionReindex {
-				i.processJobDevices(ctx, tenant, IDs)
+				err = i.processJobDevices(ctx, tenant, IDs, jobPayloads(jobs, tenant))
 			} else if action == model.ActionReindexDeployment {
-				i.processJobDeployments(ctx, tenant, IDs)
+				err = i.processJobDeployments(ctx, tenant, IDs)
 			} else {
 				l.Warnf("ignoring unknown job action: %v", action)
 			}
+			if err != nil {
+				l.Error(err)
+			}
+			settleJobs(ctx, jobs, tenant, action, err)
+		}
+	}
+	// send the acknowledgements of the whole batch at once
+	if i.nats != nil {
+		if err := i.nats.Flush(ctx); err != nil {
+			l.Error(errors.Wrap(err, "failed to flush the job acknowledgements"))
 		}
 	}
 }
 
-func (i *indexer) processJobDevices(
+// settleJobs acknowledges the jobs for the given tenant and action if
+// they were processed successfully, and requests their redelivery otherwise;
+// jobs whose documents were permanently rejected by the store are
+// dead-lettered instead, as redelivering them would not help
+func settleJobs(
 	ctx context.Context,
-	tenant string,
-	IDs IDs,
+	jobs []model.Job,
+	tenant, action string,
+	err error,
 ) {
 	l := log.FromContext(ctx)
-	devices := make([]*model.Device, 0, len(IDs))
-	removedDevices := make([]*model.Device, 0, len(IDs))
+	var bulkErr *store.BulkError
+	errors.As(err, &bulkErr)
+	rejected := 0
+	for _, job := range jobs {
+		if job.TenantID != tenant || jobIndexAction(&job) != action {
+			continue
+		}
+		var ackErr error
+		if err == nil {
+			ackErr = job.Ack(ctx)
+		} else if bulkErr == nil {
+			ackErr = job.Nak(ctx, jobRetryDelay, err)
+		} else if item := bulkErr.Item(jobDocumentID(&job)); item == nil {
+			ackErr = job.Ack(ctx)
+		} else if item.Retryable() {
+			ackErr = job.Nak(ctx, jobRetryDelay, errors.New(item.String()))
+		} else {
+			rejected++
+			ackErr = job.DeadLetter(ctx, errors.New(item.String()))
+		}
+		if ackErr != nil {
+			l.Error(errors.Wrap(ackErr, "failed to acknowledge the job"))
+		}
+	}
+	if rejected > 0 {
+		l.Warnf("dead-lettered %d jobs rejected by the store", rejected)
+	}
+}
 
+func (i *indexer) processJobDevices(
+	ctx context.Context,
+	tenant string,
+	IDs IDs,
+	payloads map[string]*model.JobPayload,
+) error {
 	deviceIDs := make([]string, 0, len(IDs))
 	for deviceID := range IDs {
 		deviceIDs = append(deviceIDs, deviceID)
 	}
-	// get devices from deviceauth
-	deviceAuthDevices, err := i.devClient.GetDevices(ctx, tenant, deviceIDs)
+	sort.Strings(deviceIDs)
+	devices, removedDevices, err := i.buildDevices(ctx, tenant, deviceIDs, payloads)
 	if err != nil {
-		l.Error(errors.Wrap(err, "failed to get devices from deviceauth"))
-		return
+		return err
+	}
+	if len(devices) == 0 && len(removedDevices) == 0 {
+		return nil
+	}
+	var events []model.ChangeEvent
+	if i.changeEventsSubject != "" {
+		events, err = i.deviceChangeEvents(ctx, tenant, devices, removedDevices)
+		if err != nil {
+			return err
+		}
+	}
+	// bulk index the device
+	stale, err := i.store.BulkIndexDevices(ctx, devices, removedDevices)
+	if len(events) > 0 {
+		i.publishChangeEvents(ctx, events, stale, err)
 	}
-	// get devices from inventory
-	inventoryDevices, err := i.invClient.GetDevices(ctx, tenant, deviceIDs)
 	if err != nil {
-		l.Error(errors.Wrap(err, "failed to get devices from inventory"))
-		return
+		return errors.Wrap(err, "failed to bulk index the devices")
+	}
+	return nil
+}
+
+// buildDevices returns the documents of the devices from the upstream
+// services, and the devices to remove from the index because they are
+// not found in deviceauth or inventory
+func (i *indexer) buildDevices(
+	ctx context.Context,
+	tenant string,
+	deviceIDs []string,
+	payloads map[string]*model.JobPayload,
+) ([]*model.Device, []*model.Device, error) {
+	devices := make([]*model.Device, 0, len(deviceIDs))
+	removedDevices := make([]*model.Device, 0, len(deviceIDs))
+	// the data published inline with the jobs is used as is, while the
+	// rest is fetched from the upstream services
+	inline := newDevicePayloads(deviceIDs, payloads)
+	// get devices from deviceauth
+	deviceAuthDevices := inline.deviceAuth
+	if len(inline.deviceAuthFetch) > 0 {
+		fetched, err := i.devClient.GetDevices(ctx, tenant, inline.deviceAuthFetch)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to get devices from deviceauth")
+		}
+		for deviceID, d := range fetched {
+			deviceAuthDevices[deviceID] = d
+		}
+	}
+	// get devices from inventory
+	inventoryDevices := inline.inventory
+	if len(inline.inventoryFetch) > 0 {
+		fetched, err := i.invClient.GetDevices(ctx, tenant, inline.inventoryFetch)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to get devices from inventory")
+		}
+		for _, d := range fetched {
+			if partial, ok := inline.inventoryPartial[string(d.ID)]; ok {
+				d = mergeInventoryDevice(d, partial)
+			}
+			inventoryDevices = append(inventoryDevices, d)
+		}
 	}
 	// get last deployment statuses from deployment
-	deploymentsDevices, err := i.deplClient.GetLatestFinishedDeployment(ctx, tenant, deviceIDs)
+	deploymentsDevices := inline.deployments
+	if len(inline.deploymentsFetch) > 0 {
+		fetched, err := i.deplClient.GetLatestFinishedDeployment(ctx, tenant,
+			inline.deploymentsFetch)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to get last device deployments from deployments")
+		}
+		deploymentsDevices = append(deploymentsDevices, fetched...)
+	}
+	latestDeployments, err := i.getLatestDeployments(ctx, tenant, deploymentsDevices)
 	if err != nil {
-		l.Error(errors.Wrap(err, "failed to get last device deployments from deployments"))
-		return
+		return nil, nil, err
+	}
+	// get the connection state from deviceconnect, if enabled; like the
+	// alerts below, it is optional, so the devices are indexed without the
+	// connectivity attributes if deviceconnect fails
+	var connectDevices map[string]deviceconnect.Device
+	if i.connClient != nil {
+		connectDevices, err = i.connClient.GetDevices(ctx, tenant, deviceIDs)
+		if err != nil {
+			log.FromContext(ctx).Warn(errors.Wrap(err,
+				"failed to get device connections from deviceconnect: "+
+					"indexing the devices without the connectivity attributes"))
+			metrics.EnrichmentsSkipped.WithLabelValues(model.ServiceDeviceconnect).Inc()
+		}
+	}
+	// get the latest alerts from devicemonitor, if enabled; the devices
+	// are indexed without the monitor attributes if devicemonitor fails
+	var monitorDevices map[string][]devicemonitor.Alert
+	monitored := false
+	if i.monClient != nil {
+		monitorDevices, err = i.monClient.GetLatestAlerts(ctx, tenant, deviceIDs)
+		if err != nil {
+			log.FromContext(ctx).Warn(errors.Wrap(err,
+				"failed to get device alerts from devicemonitor: "+
+					"indexing the devices without the monitor attributes"))
+			metrics.EnrichmentsSkipped.WithLabelValues(model.ServiceMonitor).Inc()
+		} else {
+			monitored = true
+		}
 	}
 
 	// process the results
-	devices = devices[:0]
-	removedDevices = removedDevices[:0]
 	for _, deviceID := range deviceIDs {
+		deviceID := deviceID
 		var deviceAuthDevice *deviceauth.DeviceAuthDevice
 		var inventoryDevice *inventory.Device
-		var deploymentsDevice *deployments.LastDeviceDeployment
+		var connectDevice *deviceconnect.Device
 		if d, ok := deviceAuthDevices[deviceID]; ok {
 			deviceAuthDevice = &d
 		}
@@ -116,11 +286,8 @@ func (i *indexer) processJobDevices(
 				break
 			}
 		}
-		for _, d := range deploymentsDevices {
-			if d.DeviceID == deviceID {
-				deploymentsDevice = &d
-				break
-			}
+		if d, ok := connectDevices[deviceID]; ok {
+			connectDevice = &d
 		}
 		if deviceAuthDevice == nil || inventoryDevice == nil {
 			removedDevices = append(removedDevices, &model.Device{
@@ -134,20 +301,16 @@ func (i *indexer) processJobDevices(
 			tenant,
 			deviceAuthDevice,
 			inventoryDevice,
-			deploymentsDevice,
+			latestDeployments[deviceID],
+			connectDevice,
+			monitorDevices[deviceID],
+			monitored,
 		)
 		if device != nil {
 			devices = append(devices, device)
 		}
 	}
-	// bulk index the device
-	if len(devices) > 0 || len(removedDevices) > 0 {
-		err = i.store.BulkIndexDevices(ctx, devices, removedDevices)
-		if err != nil {
-			err = errors.Wrap(err, "failed to bulk index the devices")
-			l.Error(err)
-		}
-	}
+	return devices, removedDevices, nil
 }
 
 func (i *indexer) processJobDevice(
@@ -155,7 +318,10 @@ func (i *indexer) processJobDevice(
 	tenant string,
 	deviceAuthDevice *deviceauth.DeviceAuthDevice,
 	inventoryDevice *inventory.Device,
-	deploymentsDevice *deployments.LastDeviceDeployment,
+	deploymentsDevice *latestDeployment,
+	connectDevice *deviceconnect.Device,
+	alerts []devicemonitor.Alert,
+	monitored bool,
 ) *model.Device {
 	l := log.FromContext(ctx)
 	//
@@ -211,17 +377,95 @@ func (i *indexer) processJobDevice(
 
 	// data from deployments
 	if deploymentsDevice != nil {
+		i.appendLatestDeploymentAttributes(device, deploymentsDevice)
+	}
+
+	// data from deviceconnect; the update timestamp of disconnected
+	// devices is the last time they were connected
+	if connectDevice != nil {
 		_ = device.AppendAttr(&model.InventoryAttribute{
 			Scope:  model.ScopeSystem,
-			Name:   model.AttrNameLatestDeploymentStatus,
-			String: []string{deploymentsDevice.DeviceDeploymentStatus},
+			Name:   model.AttrNameConnectStatus,
+			String: []string{connectDevice.Status},
+		})
+		_ = device.AppendAttr(&model.InventoryAttribute{
+			Scope:  model.ScopeSystem,
+			Name:   model.AttrNameConnectUpdatedAt,
+			String: []string{connectDevice.UpdatedTs.UTC().Format(time.RFC3339)},
 		})
 	}
 
+	// data from devicemonitor
+	if monitored {
+		appendMonitorAttributes(device, alerts)
+	}
+
 	// return the device
 	return device
 }
 
+// appendMonitorAttributes summarizes the latest alerts of the monitored
+// services into the monitor attributes of the device
+func appendMonitorAttributes(device *model.Device, alerts []devicemonitor.Alert) {
+	var (
+		lastAlert     time.Time
+		serviceLevels = []string{}
+		openNames     = []string{}
+		openLevels    = []string{}
+		levels        = map[string]bool{}
+	)
+	for _, alert := range alerts {
+		if alert.Timestamp.After(lastAlert) {
+			lastAlert = alert.Timestamp
+		}
+		if alert.Subject.Name != "" {
+			serviceLevels = append(serviceLevels, alert.Subject.Name+":"+alert.Level)
+		}
+		if !alert.Open() {
+			continue
+		}
+		openNames = append(openNames, alert.Name)
+		if !levels[alert.Level] {
+			levels[alert.Level] = true
+			openLevels = append(openLevels, alert.Level)
+		}
+	}
+	sort.Strings(serviceLevels)
+	sort.Strings(openNames)
+	sort.Strings(openLevels)
+	if len(serviceLevels) > 0 {
+		_ = device.AppendAttr(&model.InventoryAttribute{
+			Scope:  model.ScopeMonitor,
+			Name:   model.AttrNameAlertLevels,
+			String: serviceLevels,
+		})
+	}
+	_ = device.AppendAttr(&model.InventoryAttribute{
+		Scope:   model.ScopeMonitor,
+		Name:    model.AttrNameAlertsOpen,
+		Numeric: []float64{float64(len(openNames))},
+	})
+	if len(openNames) > 0 {
+		_ = device.AppendAttr(&model.InventoryAttribute{
+			Scope:  model.ScopeMonitor,
+			Name:   model.AttrNameAlertsOpenNames,
+			String: openNames,
+		})
+		_ = device.AppendAttr(&model.InventoryAttribute{
+			Scope:  model.ScopeMonitor,
+			Name:   model.AttrNameAlertsOpenLevels,
+			String: openLevels,
+		})
+	}
+	if !lastAlert.IsZero() {
+		_ = device.AppendAttr(&model.InventoryAttribute{
+			Scope:  model.ScopeMonitor,
+			Name:   model.AttrNameAlertsLastTimestamp,
+			String: []string{lastAlert.UTC().Format(time.RFC3339)},
+		})
+	}
+}
+
 func extractLocation(
 	attrs inventory.DeviceAttributes,
 ) (bool, string) {
@@ -276,9 +520,7 @@ func (i *indexer) processJobDeployments(
 	ctx context.Context,
 	tenant string,
 	IDs IDs,
-) {
-	l := log.FromContext(ctx)
-	depls := make([]*model.Deployment, 0, len(IDs))
+) error {
 	deploymentIDs := make([]string, 0, len(IDs))
 	for deploymentID := range IDs {
 		deploymentIDs = append(deploymentIDs, deploymentID)
@@ -286,29 +528,59 @@ func (i *indexer) processJobDeployments(
 	// get device deployments from deployments
 	deviceDeployments, err := i.deplClient.GetDeployments(ctx, tenant, deploymentIDs)
 	if err != nil {
-		l.Error(errors.Wrap(err, "failed to get device deployments from device deployments"))
-		return
+		return errors.Wrap(err, "failed to get device deployments from device deployments")
 	}
 	// process the results
-	for deploymentID := range IDs {
-		for _, d := range deviceDeployments {
-			if d.ID == deploymentID {
-				depl := i.processJobDeployment(ctx, tenant, d)
-				if depl != nil {
-					depls = append(depls, depl)
-				}
-				break
-			}
+	found := make([]*deployments.DeviceDeployment, 0, len(IDs))
+	for _, d := range deviceDeployments {
+		if IDs[d.ID] {
+			found = append(found, d)
 		}
 	}
-	// bulk index the device
-	if len(depls) > 0 {
-		err = i.store.BulkIndexDeployments(ctx, depls)
+	return i.indexDeployments(ctx, tenant, found)
+}
+
+func (i *indexer) indexDeployments(
+	ctx context.Context,
+	tenant string,
+	deviceDeployments []*deployments.DeviceDeployment,
+) error {
+	// the summaries are indexed first: the bulk errors of the device
+	// deployments settle the jobs individually, while any failure here
+	// retries all of them
+	if err := i.indexDeploymentSummaries(ctx, tenant, deviceDeployments); err != nil {
+		return err
+	}
+	depls := make([]*model.Deployment, 0, len(deviceDeployments))
+	for _, d := range deviceDeployments {
+		depl := i.processJobDeployment(ctx, tenant, d)
+		if depl != nil {
+			depls = append(depls, depl)
+		}
+	}
+	if err := i.setDeploymentsDeviceAttributes(ctx, tenant, depls); err != nil {
+		return err
+	}
+	if len(depls) == 0 {
+		return nil
+	}
+	var events []model.ChangeEvent
+	if i.changeEventsSubject != "" {
+		var err error
+		events, err = i.deploymentChangeEvents(ctx, tenant, depls)
 		if err != nil {
-			err = errors.Wrap(err, "failed to bulk index the deployments")
-			l.Error(err)
+			return err
 		}
 	}
+	// bulk index the device
+	err := i.store.BulkIndexDeployments(ctx, depls)
+	if len(events) > 0 {
+		i.publishChangeEvents(ctx, events, nil, err)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to bulk index the deployments")
+	}
+	return nil
 }
 
 func (i *indexer) processJobDeployment(
@@ -17,19 +17,31 @@ package indexer
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"sort"
 	"testing"
 	"time"
 
+	"github.com/mendersoftware/go-lib-micro/config"
+
 	"github.com/mendersoftware/reporting/client/deployments"
 	deployments_mocks "github.com/mendersoftware/reporting/client/deployments/mocks"
 	"github.com/mendersoftware/reporting/client/deviceauth"
 	deviceauth_mocks "github.com/mendersoftware/reporting/client/deviceauth/mocks"
+	"github.com/mendersoftware/reporting/client/deviceconnect"
+	deviceconnect_mocks "github.com/mendersoftware/reporting/client/deviceconnect/mocks"
+	"github.com/mendersoftware/reporting/client/devicemonitor"
+	devicemonitor_mocks "github.com/mendersoftware/reporting/client/devicemonitor/mocks"
 	"github.com/mendersoftware/reporting/client/inventory"
 	inventory_mocks "github.com/mendersoftware/reporting/client/inventory/mocks"
+	natsclient "github.com/mendersoftware/reporting/client/nats"
 	nats_mocks "github.com/mendersoftware/reporting/client/nats/mocks"
+	rconfig "github.com/mendersoftware/reporting/config"
 	"github.com/mendersoftware/reporting/model"
+	"github.com/mendersoftware/reporting/store"
 	store_mocks "github.com/mendersoftware/reporting/store/mocks"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -37,7 +49,7 @@ import (
 func TestGetJobsSubscriptionError(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	jobs := make(chan model.Job, 1)
+	jobs := []chan model.Job{make(chan model.Job, 1), make(chan model.Job, 1)}
 
 	subscriptionError := errors.New("subscription error")
 
@@ -46,6 +58,7 @@ func TestGetJobsSubscriptionError(t *testing.T) {
 		ctx,
 		mock.AnythingOfType("string"),
 		mock.AnythingOfType("string"),
+		mock.AnythingOfType("nats.SubscribeOptions"),
 		mock.AnythingOfType("chan model.Job"),
 	).Return(subscriptionError)
 
@@ -61,18 +74,33 @@ func TestGetJobsSubscriptionError(t *testing.T) {
 func TestGetJobs(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	jobs := make(chan model.Job, 1)
+	jobs := []chan model.Job{make(chan model.Job, 1), make(chan model.Job, 1)}
+	devicesJob := model.Job{Action: model.ActionReindex}
+	deploymentsJob := model.Job{Action: model.ActionReindexDeployment}
 
+	// each lane subscribes its own consumer, which skips the jobs of
+	// the other lane and dead-letters the undecodable ones once
 	nats := &nats_mocks.Client{}
-	nats.On("JetStreamSubscribe",
-		ctx,
-		mock.AnythingOfType("string"),
-		mock.AnythingOfType("string"),
-		mock.MatchedBy(func(msgs chan model.Job) bool {
-			msgs <- model.Job{Action: model.ActionReindex}
-			return true
-		}),
-	).Return(nil)
+	for lane, durable := range LaneDurables(config.Config) {
+		lane := lane
+		nats.On("JetStreamSubscribe",
+			ctx,
+			mock.AnythingOfType("string"),
+			durable,
+			mock.MatchedBy(func(opts natsclient.SubscribeOptions) bool {
+				return opts.Filter(&devicesJob) == (lane == laneDevices) &&
+					opts.Filter(&deploymentsJob) == (lane == laneDeployments) &&
+					opts.Filter(nil) == (lane == laneDevices)
+			}),
+			jobs[lane],
+		).Run(func(args mock.Arguments) {
+			if lane == laneDevices {
+				jobs[lane] <- devicesJob
+			} else {
+				jobs[lane] <- deploymentsJob
+			}
+		}).Return(nil).Once()
+	}
 
 	defer nats.AssertExpectations(t)
 
@@ -80,10 +108,8 @@ func TestGetJobs(t *testing.T) {
 	err := indexer.GetJobs(ctx, jobs)
 	assert.Nil(t, err)
 
-	time.Sleep(500 * time.Millisecond)
-
-	job := <-jobs
-	assert.Equal(t, job.Action, model.ActionReindex)
+	assert.Equal(t, devicesJob, <-jobs[laneDevices])
+	assert.Equal(t, deploymentsJob, <-jobs[laneDeployments])
 
 	cancel()
 }
@@ -92,7 +118,7 @@ func TestGetJobsError(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	jobs := make(chan model.Job, 1)
+	jobs := []chan model.Job{make(chan model.Job, 1), make(chan model.Job, 1)}
 	testErr := errors.New("test error")
 
 	nats := &nats_mocks.Client{}
@@ -100,6 +126,7 @@ func TestGetJobsError(t *testing.T) {
 		ctx,
 		mock.AnythingOfType("string"),
 		mock.AnythingOfType("string"),
+		mock.AnythingOfType("nats.SubscribeOptions"),
 		mock.MatchedBy(func(msgs chan model.Job) bool {
 			return true
 		}),
@@ -112,10 +139,155 @@ func TestGetJobsError(t *testing.T) {
 	assert.ErrorIs(t, err, testErr)
 }
 
+func TestSubscribeOptions(t *testing.T) {
+	testCases := map[string]struct {
+		settings map[string]interface{}
+
+		opts natsclient.SubscribeOptions
+	}{
+		"default to the reindex batch size and max time": {
+			settings: map[string]interface{}{
+				rconfig.SettingNatsStreamName:      "WORKFLOWS",
+				rconfig.SettingNatsDeadLetterTopic: "dlq",
+				rconfig.SettingReindexBatchSize:    100,
+				rconfig.SettingReindexMaxTimeMsec:  1000,
+			},
+			opts: natsclient.SubscribeOptions{
+				DeadLetterSubject: "WORKFLOWS.dlq",
+				FetchBatchSize:    100,
+				FetchMaxWait:      time.Second,
+			},
+		},
+		"fetch batch size and max wait": {
+			settings: map[string]interface{}{
+				rconfig.SettingNatsStreamName:       "WORKFLOWS",
+				rconfig.SettingReindexBatchSize:     100,
+				rconfig.SettingReindexMaxTimeMsec:   1000,
+				rconfig.SettingNatsFetchBatchSize:   500,
+				rconfig.SettingNatsFetchMaxWaitMsec: 200,
+			},
+			opts: natsclient.SubscribeOptions{
+				FetchBatchSize: 500,
+				FetchMaxWait:   200 * time.Millisecond,
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			conf := viper.New()
+			for key, value := range tc.settings {
+				conf.Set(key, value)
+			}
+			assert.Equal(t, tc.opts, SubscribeOptions(conf))
+		})
+	}
+}
+
 func strptr(s string) *string {
 	return &s
 }
 
+type jobAcknowledger struct {
+	acked        bool
+	naked        bool
+	deadLettered bool
+}
+
+func (a *jobAcknowledger) Ack(ctx context.Context) error {
+	a.acked = true
+	return nil
+}
+
+func (a *jobAcknowledger) Nak(ctx context.Context, delay time.Duration, cause error) error {
+	a.naked = true
+	return nil
+}
+
+func (a *jobAcknowledger) DeadLetter(ctx context.Context, cause error) error {
+	a.deadLettered = true
+	return nil
+}
+
+func withAcknowledgers(jobs []model.Job) ([]model.Job, []*jobAcknowledger) {
+	res := make([]model.Job, len(jobs))
+	acks := make([]*jobAcknowledger, len(jobs))
+	for i, job := range jobs {
+		acks[i] = &jobAcknowledger{}
+		job.Acknowledger = acks[i]
+		res[i] = job
+	}
+	return res, acks
+}
+
+func assertJobsSettled(t *testing.T, acks []*jobAcknowledger, success bool) {
+	for _, ack := range acks {
+		assert.Equal(t, success, ack.acked)
+		assert.Equal(t, !success, ack.naked)
+		assert.False(t, ack.deadLettered)
+	}
+}
+
+func TestSettleJobs(t *testing.T) {
+	const tenantID = "tenant"
+
+	jobs := []model.Job{
+		{Action: model.ActionReindex, TenantID: tenantID, DeviceID: "1"},
+		{Action: model.ActionReindex, TenantID: tenantID, DeviceID: "2"},
+		{Action: model.ActionReindex, TenantID: tenantID, DeviceID: "3"},
+		{Action: model.ActionReindexDeployment, TenantID: tenantID, ID: "1"},
+	}
+	testCases := map[string]struct {
+		err error
+
+		acked        []bool
+		naked        []bool
+		deadLettered []bool
+	}{
+		"ok": {
+			acked:        []bool{true, true, true, false},
+			naked:        []bool{false, false, false, false},
+			deadLettered: []bool{false, false, false, false},
+		},
+		"ko": {
+			err:          errors.New("abc"),
+			acked:        []bool{false, false, false, false},
+			naked:        []bool{true, true, true, false},
+			deadLettered: []bool{false, false, false, false},
+		},
+		"ko, bulk error": {
+			err: fmt.Errorf("failed to bulk index the devices: %w",
+				&store.BulkError{Items: []store.BulkItemResult{{
+					Action: "index",
+					ID:     "1",
+					Status: http.StatusBadRequest,
+					Error: &store.BulkItemError{
+						Type:   "mapper_parsing_exception",
+						Reason: "failed to parse",
+					},
+				}, {
+					Action: "index",
+					ID:     "2",
+					Status: http.StatusTooManyRequests,
+				}}}),
+			acked:        []bool{false, false, true, false},
+			naked:        []bool{false, true, false, false},
+			deadLettered: []bool{true, false, false, false},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			jobs, acks := withAcknowledgers(jobs)
+			settleJobs(context.Background(), jobs, tenantID, model.ActionReindex, tc.err)
+			for i, ack := range acks {
+				assert.Equal(t, tc.acked[i], ack.acked)
+				assert.Equal(t, tc.naked[i], ack.naked)
+				assert.Equal(t, tc.deadLettered[i], ack.deadLettered)
+			}
+		})
+	}
+}
+
 func TestProcessJobs(t *testing.T) {
 	const tenantID = "tenant"
 
@@ -133,6 +305,12 @@ func TestProcessJobs(t *testing.T) {
 		deploymentsDevices []deployments.LastDeviceDeployment
 		deploymentsErr     error
 
+		connectDevices map[string]deviceconnect.Device
+		connectErr     error
+
+		monitorAlerts map[string][]devicemonitor.Alert
+		monitorErr    error
+
 		updateMapping       []string
 		updateMappingResult []string
 
@@ -435,6 +613,312 @@ func TestProcessJobs(t *testing.T) {
 			inventoryDeviceIDs: []string{"1", "2", "3"},
 			inventoryErr:       errors.New("abc"),
 		},
+		"ok with connectivity": {
+			jobs: []model.Job{
+				{
+					Action:   model.ActionReindexConnectivity,
+					TenantID: tenantID,
+					DeviceID: "1",
+					Service:  model.ServiceDeviceconnect,
+				},
+				{
+					Action:   model.ActionReindex,
+					TenantID: tenantID,
+					DeviceID: "1",
+					Service:  model.ServiceInventory,
+				},
+				{
+					Action:   model.ActionReindexConnectivity,
+					TenantID: tenantID,
+					DeviceID: "2",
+					Service:  model.ServiceDeviceconnect,
+				},
+			},
+
+			deviceauthDeviceIDs: []string{"1", "2"},
+			deviceauthDevices: map[string]deviceauth.DeviceAuthDevice{
+				"1": {
+					ID:     "1",
+					Status: "accepted",
+				},
+				"2": {
+					ID:     "2",
+					Status: "accepted",
+				},
+			},
+
+			inventoryDeviceIDs: []string{"1", "2"},
+			inventoryDevices: []inventory.Device{
+				{
+					ID: "1",
+				},
+				{
+					ID: "2",
+				},
+			},
+
+			connectDevices: map[string]deviceconnect.Device{
+				"1": {
+					ID:        "1",
+					Status:    deviceconnect.StatusDisconnected,
+					UpdatedTs: time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+				},
+			},
+
+			updateMapping:       []string{},
+			updateMappingResult: []string{},
+
+			bulkIndexDevices: []*model.Device{
+				{
+					ID:       strptr("1"),
+					TenantID: strptr(tenantID),
+					IdentityAttributes: model.InventoryAttributes{
+						{
+							Scope:  model.ScopeIdentity,
+							Name:   model.AttrNameStatus,
+							String: []string{"accepted"},
+						},
+					},
+					SystemAttributes: model.InventoryAttributes{
+						{
+							Scope:  model.ScopeSystem,
+							Name:   model.AttrNameConnectStatus,
+							String: []string{deviceconnect.StatusDisconnected},
+						},
+						{
+							Scope:  model.ScopeSystem,
+							Name:   model.AttrNameConnectUpdatedAt,
+							String: []string{"2023-05-01T10:00:00Z"},
+						},
+					},
+				},
+				{
+					ID:       strptr("2"),
+					TenantID: strptr(tenantID),
+					IdentityAttributes: model.InventoryAttributes{
+						{
+							Scope:  model.ScopeIdentity,
+							Name:   model.AttrNameStatus,
+							String: []string{"accepted"},
+						},
+					},
+				},
+			},
+			bulkIndexRemoveDevices: []*model.Device{},
+		},
+		"ok, failure in deviceconnect indexes without the connectivity attributes": {
+			jobs: []model.Job{
+				{
+					Action:   model.ActionReindexConnectivity,
+					TenantID: tenantID,
+					DeviceID: "1",
+					Service:  model.ServiceDeviceconnect,
+				},
+			},
+
+			deviceauthDeviceIDs: []string{"1"},
+			deviceauthDevices: map[string]deviceauth.DeviceAuthDevice{
+				"1": {
+					ID:     "1",
+					Status: "accepted",
+				},
+			},
+
+			inventoryDeviceIDs: []string{"1"},
+			inventoryDevices: []inventory.Device{
+				{
+					ID: "1",
+				},
+			},
+
+			connectErr: errors.New("deviceconnect error"),
+
+			updateMapping:       []string{},
+			updateMappingResult: []string{},
+
+			bulkIndexDevices: []*model.Device{
+				{
+					ID:       strptr("1"),
+					TenantID: strptr(tenantID),
+					IdentityAttributes: model.InventoryAttributes{
+						{
+							Scope:  model.ScopeIdentity,
+							Name:   model.AttrNameStatus,
+							String: []string{"accepted"},
+						},
+					},
+				},
+			},
+			bulkIndexRemoveDevices: []*model.Device{},
+		},
+		"ok with monitor alerts": {
+			jobs: []model.Job{
+				{
+					Action:   model.ActionReindex,
+					TenantID: tenantID,
+					DeviceID: "1",
+					Service:  model.ServiceMonitor,
+				},
+				{
+					Action:   model.ActionReindex,
+					TenantID: tenantID,
+					DeviceID: "2",
+					Service:  model.ServiceMonitor,
+				},
+			},
+
+			deviceauthDeviceIDs: []string{"1", "2"},
+			deviceauthDevices: map[string]deviceauth.DeviceAuthDevice{
+				"1": {
+					ID:     "1",
+					Status: "accepted",
+				},
+				"2": {
+					ID:     "2",
+					Status: "accepted",
+				},
+			},
+
+			inventoryDeviceIDs: []string{"1", "2"},
+			inventoryDevices: []inventory.Device{
+				{
+					ID: "1",
+				},
+				{
+					ID: "2",
+				},
+			},
+
+			monitorAlerts: map[string][]devicemonitor.Alert{
+				"1": {
+					{
+						Name:      "sshd is not running",
+						DeviceID:  "1",
+						Level:     devicemonitor.AlertLevelCritical,
+						Subject:   devicemonitor.AlertSubject{Name: "sshd"},
+						Timestamp: time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+					},
+					{
+						Name:      "nginx is running",
+						DeviceID:  "1",
+						Level:     devicemonitor.AlertLevelOK,
+						Subject:   devicemonitor.AlertSubject{Name: "nginx"},
+						Timestamp: time.Date(2023, 5, 1, 11, 0, 0, 0, time.UTC),
+					},
+				},
+			},
+
+			updateMapping:       []string{},
+			updateMappingResult: []string{},
+
+			bulkIndexDevices: []*model.Device{
+				{
+					ID:       strptr("1"),
+					TenantID: strptr(tenantID),
+					IdentityAttributes: model.InventoryAttributes{
+						{
+							Scope:  model.ScopeIdentity,
+							Name:   model.AttrNameStatus,
+							String: []string{"accepted"},
+						},
+					},
+					MonitorAttributes: model.InventoryAttributes{
+						{
+							Scope: model.ScopeMonitor,
+							Name:  model.AttrNameAlertLevels,
+							String: []string{
+								"nginx:" + devicemonitor.AlertLevelOK,
+								"sshd:" + devicemonitor.AlertLevelCritical,
+							},
+						},
+						{
+							Scope:   model.ScopeMonitor,
+							Name:    model.AttrNameAlertsOpen,
+							Numeric: []float64{1},
+						},
+						{
+							Scope:  model.ScopeMonitor,
+							Name:   model.AttrNameAlertsOpenNames,
+							String: []string{"sshd is not running"},
+						},
+						{
+							Scope:  model.ScopeMonitor,
+							Name:   model.AttrNameAlertsOpenLevels,
+							String: []string{devicemonitor.AlertLevelCritical},
+						},
+						{
+							Scope:  model.ScopeMonitor,
+							Name:   model.AttrNameAlertsLastTimestamp,
+							String: []string{"2023-05-01T11:00:00Z"},
+						},
+					},
+				},
+				{
+					ID:       strptr("2"),
+					TenantID: strptr(tenantID),
+					IdentityAttributes: model.InventoryAttributes{
+						{
+							Scope:  model.ScopeIdentity,
+							Name:   model.AttrNameStatus,
+							String: []string{"accepted"},
+						},
+					},
+					MonitorAttributes: model.InventoryAttributes{
+						{
+							Scope:   model.ScopeMonitor,
+							Name:    model.AttrNameAlertsOpen,
+							Numeric: []float64{0},
+						},
+					},
+				},
+			},
+			bulkIndexRemoveDevices: []*model.Device{},
+		},
+		"ok, failure in devicemonitor indexes without the monitor attributes": {
+			jobs: []model.Job{
+				{
+					Action:   model.ActionReindex,
+					TenantID: tenantID,
+					DeviceID: "1",
+					Service:  model.ServiceMonitor,
+				},
+			},
+
+			deviceauthDeviceIDs: []string{"1"},
+			deviceauthDevices: map[string]deviceauth.DeviceAuthDevice{
+				"1": {
+					ID:     "1",
+					Status: "accepted",
+				},
+			},
+
+			inventoryDeviceIDs: []string{"1"},
+			inventoryDevices: []inventory.Device{
+				{
+					ID: "1",
+				},
+			},
+
+			monitorErr: errors.New("devicemonitor error"),
+
+			updateMapping:       []string{},
+			updateMappingResult: []string{},
+
+			bulkIndexDevices: []*model.Device{
+				{
+					ID:       strptr("1"),
+					TenantID: strptr(tenantID),
+					IdentityAttributes: model.InventoryAttributes{
+						{
+							Scope:  model.ScopeIdentity,
+							Name:   model.AttrNameStatus,
+							String: []string{"accepted"},
+						},
+					},
+				},
+			},
+			bulkIndexRemoveDevices: []*model.Device{},
+		},
 		"ko, failure in BulkIndex": {
 			jobs: []model.Job{
 				{
@@ -544,7 +1028,7 @@ func TestProcessJobs(t *testing.T) {
 					ctx,
 					tc.bulkIndexDevices,
 					tc.bulkIndexRemoveDevices,
-				).Return(tc.bulkIndexErr)
+				).Return(nil, tc.bulkIndexErr)
 			}
 
 			devClient := &deviceauth_mocks.Client{}
@@ -587,6 +1071,28 @@ func TestProcessJobs(t *testing.T) {
 				).Return(tc.deploymentsDevices, tc.deploymentsErr)
 			}
 
+			var opts []Option
+			if tc.connectDevices != nil || tc.connectErr != nil {
+				connClient := &deviceconnect_mocks.Client{}
+				defer connClient.AssertExpectations(t)
+				connClient.On("GetDevices",
+					ctx,
+					tenantID,
+					mock.AnythingOfType("[]string"),
+				).Return(tc.connectDevices, tc.connectErr)
+				opts = append(opts, WithDeviceConnectClient(connClient))
+			}
+			if tc.monitorAlerts != nil || tc.monitorErr != nil {
+				monClient := &devicemonitor_mocks.Client{}
+				defer monClient.AssertExpectations(t)
+				monClient.On("GetLatestAlerts",
+					ctx,
+					tenantID,
+					mock.AnythingOfType("[]string"),
+				).Return(tc.monitorAlerts, tc.monitorErr)
+				opts = append(opts, WithDeviceMonitorClient(monClient))
+			}
+
 			ds := &store_mocks.DataStore{}
 			ds.On("UpdateAndGetMapping",
 				ctx,
@@ -597,9 +1103,14 @@ func TestProcessJobs(t *testing.T) {
 				Inventory: tc.updateMappingResult,
 			}, nil)
 
-			indexer := NewIndexer(store, ds, nil, devClient, invClient, deplClient)
+			indexer := NewIndexer(store, ds, nil, devClient, invClient, deplClient, opts...)
 
-			indexer.ProcessJobs(ctx, tc.jobs)
+			jobs, acks := withAcknowledgers(tc.jobs)
+			indexer.ProcessJobs(ctx, jobs)
+
+			success := tc.deviceauthErr == nil && tc.inventoryErr == nil &&
+				tc.deploymentsErr == nil && tc.bulkIndexErr == nil
+			assertJobsSettled(t, acks, success)
 		})
 	}
 }
@@ -609,6 +1120,7 @@ func TestProcessJobsDeployments(t *testing.T) {
 
 	now := time.Now().Truncate(0)
 	five_seconds_ago := now.Add(-5 * time.Second)
+	two := 2
 
 	testCases := map[string]struct {
 		jobs []model.Job
@@ -617,6 +1129,13 @@ func TestProcessJobsDeployments(t *testing.T) {
 		getDeployments    []*deployments.DeviceDeployment
 		getDeploymentsErr error
 
+		listDeploymentsIDs []string
+		listDeployments    []*deployments.Deployment
+		listDeploymentsErr error
+
+		bulkIndexSummaries    []*model.DeploymentSummary
+		bulkIndexSummariesErr error
+
 		bulkIndexDeployments []*model.Deployment
 		bulkIndexErr         error
 	}{
@@ -645,7 +1164,7 @@ func TestProcessJobsDeployments(t *testing.T) {
 			getDeployments: []*deployments.DeviceDeployment{
 				{
 					ID:         "92be929e-f924-49d0-9b98-3dec6c504901",
-					Deployment: &deployments.Deployment{},
+					Deployment: &deployments.Deployment{Id: "d1"},
 					Device: &deployments.Device{
 						Created:  &five_seconds_ago,
 						Finished: &now,
@@ -657,7 +1176,7 @@ func TestProcessJobsDeployments(t *testing.T) {
 				},
 				{
 					ID:         "92be929e-f924-49d0-9b98-3dec6c504902",
-					Deployment: &deployments.Deployment{},
+					Deployment: &deployments.Deployment{Id: "d1"},
 					Device: &deployments.Device{
 						Created:  &five_seconds_ago,
 						Finished: &now,
@@ -669,7 +1188,7 @@ func TestProcessJobsDeployments(t *testing.T) {
 				},
 				{
 					ID:         "92be929e-f924-49d0-9b98-3dec6c504903",
-					Deployment: &deployments.Deployment{},
+					Deployment: &deployments.Deployment{Id: "d2"},
 					Device: &deployments.Device{
 						Created: &five_seconds_ago,
 						Status:  "downloading",
@@ -679,10 +1198,68 @@ func TestProcessJobsDeployments(t *testing.T) {
 					},
 				},
 			},
+			listDeploymentsIDs: []string{"d1", "d2"},
+			listDeployments: []*deployments.Deployment{
+				{
+					Id:                 "d1",
+					Name:               "deployment",
+					Status:             "finished",
+					InitialDeviceCount: 2,
+					DeviceCount:        &two,
+					Statistics: &deployments.DeploymentStatistics{
+						Status: map[string]int{
+							"success": 1,
+							"failure": 1,
+						},
+					},
+				},
+				{
+					Id:     "d2",
+					Status: "inprogress",
+					Phases: []deployments.DeploymentPhase{
+						{Id: "p1", BatchSize: 100, StartTs: &now, DeviceCount: 1},
+					},
+					Statistics: &deployments.DeploymentStatistics{
+						Status: map[string]int{
+							"downloading": 1,
+						},
+					},
+				},
+			},
+			bulkIndexSummaries: []*model.DeploymentSummary{
+				{
+					ID:                 "d1",
+					TenantID:           tenantID,
+					DeploymentID:       "d1",
+					DeploymentName:     "deployment",
+					DeploymentStatus:   "finished",
+					InitialDeviceCount: 2,
+					DeviceCount:        2,
+					DeviceCounts: map[string]int{
+						"success": 1,
+						"failure": 1,
+					},
+					SuccessRatio: 0.5,
+				},
+				{
+					ID:               "d2",
+					TenantID:         tenantID,
+					DeploymentID:     "d2",
+					DeploymentStatus: "inprogress",
+					DeploymentPhased: true,
+					DeploymentPhases: []model.DeploymentSummaryPhase{
+						{ID: "p1", BatchSize: 100, StartTs: &now, DeviceCount: 1},
+					},
+					DeviceCounts: map[string]int{
+						"downloading": 1,
+					},
+				},
+			},
 			bulkIndexDeployments: []*model.Deployment{
 				{
 					ID:                   "92be929e-f924-49d0-9b98-3dec6c504901",
 					TenantID:             tenantID,
+					DeploymentID:         "d1",
 					DeviceCreated:        &five_seconds_ago,
 					DeviceFinished:       &now,
 					DeviceElapsedSeconds: 5,
@@ -691,6 +1268,7 @@ func TestProcessJobsDeployments(t *testing.T) {
 				{
 					ID:                   "92be929e-f924-49d0-9b98-3dec6c504902",
 					TenantID:             tenantID,
+					DeploymentID:         "d1",
 					DeviceCreated:        &five_seconds_ago,
 					DeviceFinished:       &now,
 					DeviceElapsedSeconds: 5,
@@ -699,10 +1277,107 @@ func TestProcessJobsDeployments(t *testing.T) {
 				{
 					ID:            "92be929e-f924-49d0-9b98-3dec6c504903",
 					TenantID:      tenantID,
+					DeploymentID:  "d2",
+					DeviceCreated: &five_seconds_ago,
+					DeviceStatus:  "downloading",
+				},
+			},
+		},
+		"ko, failure in deployments": {
+			jobs: []model.Job{
+				{
+					Action:   model.ActionReindexDeployment,
+					TenantID: tenantID,
+					ID:       "92be929e-f924-49d0-9b98-3dec6c504901",
+					Service:  model.ServiceDeployments,
+				},
+			},
+
+			getDeploymentsErr: errors.New("abc"),
+		},
+		"ko, failure in BulkIndex": {
+			jobs: []model.Job{
+				{
+					Action:   model.ActionReindexDeployment,
+					TenantID: tenantID,
+					ID:       "92be929e-f924-49d0-9b98-3dec6c504901",
+					Service:  model.ServiceDeployments,
+				},
+			},
+
+			getDeployments: []*deployments.DeviceDeployment{
+				{
+					ID:         "92be929e-f924-49d0-9b98-3dec6c504901",
+					Deployment: &deployments.Deployment{Id: "d1"},
+					Device: &deployments.Device{
+						Created: &five_seconds_ago,
+						Status:  "downloading",
+					},
+				},
+			},
+			listDeploymentsIDs: []string{"d1"},
+			listDeployments: []*deployments.Deployment{
+				{Id: "d1"},
+			},
+			bulkIndexSummaries: []*model.DeploymentSummary{
+				{ID: "d1", TenantID: tenantID, DeploymentID: "d1"},
+			},
+			bulkIndexDeployments: []*model.Deployment{
+				{
+					ID:            "92be929e-f924-49d0-9b98-3dec6c504901",
+					TenantID:      tenantID,
+					DeploymentID:  "d1",
 					DeviceCreated: &five_seconds_ago,
 					DeviceStatus:  "downloading",
 				},
 			},
+			bulkIndexErr: errors.New("bulk index error"),
+		},
+		"ko, failure listing the deployments": {
+			jobs: []model.Job{
+				{
+					Action:   model.ActionReindexDeployment,
+					TenantID: tenantID,
+					ID:       "92be929e-f924-49d0-9b98-3dec6c504901",
+					Service:  model.ServiceDeployments,
+				},
+			},
+
+			getDeployments: []*deployments.DeviceDeployment{
+				{
+					ID:         "92be929e-f924-49d0-9b98-3dec6c504901",
+					Deployment: &deployments.Deployment{Id: "d1"},
+					Device:     &deployments.Device{Status: "downloading"},
+				},
+			},
+			listDeploymentsIDs: []string{"d1"},
+			listDeploymentsErr: errors.New("abc"),
+		},
+		"ko, failure indexing the summaries": {
+			jobs: []model.Job{
+				{
+					Action:   model.ActionReindexDeployment,
+					TenantID: tenantID,
+					ID:       "92be929e-f924-49d0-9b98-3dec6c504901",
+					Service:  model.ServiceDeployments,
+				},
+			},
+
+			getDeployments: []*deployments.DeviceDeployment{
+				{
+					ID:         "92be929e-f924-49d0-9b98-3dec6c504901",
+					Deployment: &deployments.Deployment{Id: "d1"},
+					Device:     &deployments.Device{Status: "downloading"},
+				},
+			},
+			listDeploymentsIDs: []string{"d1"},
+			listDeployments: []*deployments.Deployment{
+				{Id: "d1"},
+			},
+			bulkIndexSummaries: []*model.DeploymentSummary{
+				{ID: "d1", TenantID: tenantID, DeploymentID: "d1"},
+			},
+			bulkIndexSummariesErr: errors.New("bulk index error"),
 		},
 	}
 
@@ -713,7 +1388,13 @@ func TestProcessJobsDeployments(t *testing.T) {
 			store := &store_mocks.Store{}
 			defer store.AssertExpectations(t)
 
-			if tc.getDeploymentsErr == nil {
+			if tc.bulkIndexSummaries != nil {
+				store.On("BulkIndexDeploymentSummaries",
+					ctx,
+					tc.bulkIndexSummaries,
+				).Return(tc.bulkIndexSummariesErr)
+			}
+			if tc.bulkIndexDeployments != nil && tc.bulkIndexSummariesErr == nil {
 				store.On("BulkIndexDeployments",
 					ctx,
 					mock.MatchedBy(func(deployments []*model.Deployment) bool {
@@ -743,9 +1424,24 @@ func TestProcessJobsDeployments(t *testing.T) {
 				tenantID,
 				mock.AnythingOfType("[]string"),
 			).Return(tc.getDeployments, tc.getDeploymentsErr)
+			if tc.listDeploymentsIDs != nil {
+				deplClient.On("ListDeployments",
+					ctx,
+					tenantID,
+					tc.listDeploymentsIDs,
+				).Return(tc.listDeployments, tc.listDeploymentsErr)
+			}
 
 			indexer := NewIndexer(store, nil, nil, nil, nil, deplClient)
-			indexer.ProcessJobs(ctx, tc.jobs)
+
+			jobs, acks := withAcknowledgers(tc.jobs)
+			indexer.ProcessJobs(ctx, jobs)
+
+			success := tc.getDeploymentsErr == nil &&
+				tc.listDeploymentsErr == nil &&
+				tc.bulkIndexSummariesErr == nil &&
+				tc.bulkIndexErr == nil
+			assertJobsSettled(t, acks, success)
 		})
 	}
 }
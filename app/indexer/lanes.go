@@ -0,0 +1,279 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	rconfig "github.com/mendersoftware/reporting/config"
+	"github.com/mendersoftware/reporting/metrics"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// the jobs are processed in separate lanes per kind of entity
+const (
+	laneDevices = iota
+	laneDeployments
+)
+
+// laneSettings holds the config keys of the lane settings; when not set,
+// the shared reindex settings apply
+type laneSettings struct {
+	name string
+	// durableSuffix is appended to the configured durable name to name
+	// the NATS consumer of the lane
+	durableSuffix     string
+	batchSize         string
+	workerConcurrency string
+	maxTimeMsec       string
+}
+
+var lanesSettings = []laneSettings{
+	laneDevices: {
+		name:              "devices",
+		batchSize:         rconfig.SettingReindexDevicesBatchSize,
+		workerConcurrency: rconfig.SettingReindexDevicesWorkerConcurrency,
+		maxTimeMsec:       rconfig.SettingReindexDevicesMaxTimeMsec,
+	},
+	laneDeployments: {
+		name:              "deployments",
+		durableSuffix:     "-deployments",
+		batchSize:         rconfig.SettingReindexDeploymentsBatchSize,
+		workerConcurrency: rconfig.SettingReindexDeploymentsWorkerConcurrency,
+		maxTimeMsec:       rconfig.SettingReindexDeploymentsMaxTimeMsec,
+	},
+}
+
+// jobLane returns the lane processing the job
+func jobLane(job *model.Job) int {
+	if jobIndexAction(job) == model.ActionReindexDeployment {
+		return laneDeployments
+	}
+	return laneDevices
+}
+
+// LaneDurables returns the names of the NATS durable consumers of the lanes:
+// each lane receives the jobs from its own consumer, which skips the jobs
+// of the other lanes, so that the jobs waiting to be acknowledged in a lane
+// never stop the delivery of the jobs of the other lanes
+func LaneDurables(conf config.Reader) []string {
+	durable := conf.GetString(rconfig.SettingNatsSubscriberDurable)
+	durables := make([]string, len(lanesSettings))
+	for i, settings := range lanesSettings {
+		durables[i] = durable + settings.durableSuffix
+	}
+	return durables
+}
+
+// laneFilter returns the filter of the jobs received by the consumer of the
+// lane; the jobs which can't be decoded are dead-lettered by the first lane
+func laneFilter(id int) func(job *model.Job) bool {
+	return func(job *model.Job) bool {
+		if job == nil {
+			return id == 0
+		}
+		return jobLane(job) == id
+	}
+}
+
+// laneWorkers returns the share of the shared worker concurrency assigned
+// to the lane: the workers are split evenly across the lanes, the first
+// lanes taking the remainder, with one worker per lane at least
+func laneWorkers(id, workers int) int {
+	share := workers / len(lanesSettings)
+	if id < workers%len(lanesSettings) {
+		share++
+	} else if share == 0 {
+		share = 1
+	}
+	return share
+}
+
+// lane processes the jobs for a kind of entity with its own worker pool,
+// batch size and max wait, so that a flood of jobs for devices does not
+// delay the deployments, and the reverse
+type lane struct {
+	id        int
+	name      string
+	batchSize int
+	maxWait   time.Duration
+	sched     *scheduler
+	queues    []chan []model.Job
+	// busy counts the batches sent to each worker and not yet processed:
+	// one being processed and one waiting in the queue at most
+	busy   []int
+	ticker *time.Timer
+}
+
+// laneSetting returns the value of the lane setting, or of the shared
+// setting if the lane one is not set
+func laneSetting(conf config.Reader, key, sharedKey string) (int, error) {
+	value := conf.GetInt(key)
+	if value < 0 {
+		return 0, fmt.Errorf("%s: must be a non-negative integer", key)
+	} else if value == 0 {
+		value = conf.GetInt(sharedKey)
+	}
+	return value, nil
+}
+
+func newLaneFromConfig(conf config.Reader, id int, quantum, maxInFlight int) (*lane, error) {
+	settings := lanesSettings[id]
+	batchSize, err := laneSetting(conf,
+		settings.batchSize, rconfig.SettingReindexBatchSize)
+	if err != nil {
+		return nil, err
+	} else if batchSize <= 0 {
+		return nil, fmt.Errorf(
+			"%s: must be a positive integer",
+			rconfig.SettingReindexBatchSize,
+		)
+	}
+	workerConcurrency, err := laneSetting(conf,
+		settings.workerConcurrency, rconfig.SettingWorkerConcurrency)
+	if err != nil {
+		return nil, err
+	} else if workerConcurrency <= 0 {
+		return nil, fmt.Errorf(
+			"%s: must be a positive integer",
+			rconfig.SettingWorkerConcurrency,
+		)
+	} else if conf.GetInt(settings.workerConcurrency) == 0 {
+		workerConcurrency = laneWorkers(id, workerConcurrency)
+	}
+	maxTimeMs, err := laneSetting(conf,
+		settings.maxTimeMsec, rconfig.SettingReindexMaxTimeMsec)
+	if err != nil {
+		return nil, err
+	}
+	// jobs are partitioned across the workers by entity, so that the
+	// updates for the same device or deployment are applied in order;
+	// within a partition, the tenants are served in round-robin
+	l := &lane{
+		id:        id,
+		name:      settings.name,
+		batchSize: batchSize,
+		maxWait:   time.Duration(maxTimeMs) * time.Millisecond,
+		sched:     newScheduler(workerConcurrency, quantum, maxInFlight),
+		queues:    make([]chan []model.Job, workerConcurrency),
+		busy:      make([]int, workerConcurrency),
+	}
+	for i := range l.queues {
+		l.queues[i] = make(chan []model.Job, maxBatchesPerWorker-1)
+	}
+	return l, nil
+}
+
+// start starts the workers of the lane, and the max wait timer
+func (l *lane) start(
+	ctx context.Context,
+	indexer Indexer,
+	processed chan<- processedJobs,
+	wg *sync.WaitGroup,
+) {
+	for i := range l.queues {
+		wg.Add(1)
+		go workerRoutine(ctx, l.id, i, l.name+"-"+strconv.Itoa(i+1),
+			indexer, l.queues[i], processed, wg)
+	}
+	l.ticker = time.NewTimer(l.maxWait)
+}
+
+// Push queues the job and dispatches the partition if a batch is full
+func (l *lane) Push(job model.Job) {
+	l.dispatch(l.sched.Push(job), false)
+}
+
+// dispatch sends the full batches queued in the partition to its
+// worker, as long as the worker has room; with partial set, it sends
+// the jobs even if they do not fill a batch
+func (l *lane) dispatch(i int, partial bool) {
+	for l.busy[i] < maxBatchesPerWorker &&
+		(l.sched.Len(i) >= l.batchSize || (partial && l.sched.Len(i) > 0)) {
+		batch := l.sched.Next(i, l.batchSize)
+		if len(batch) == 0 {
+			break
+		}
+		l.busy[i]++
+		l.queues[i] <- batch
+	}
+	metrics.JobsQueued.WithLabelValues(l.name).Set(float64(l.sched.Total()))
+}
+
+// DispatchAll sends the jobs queued in all the partitions, as long as the
+// workers have room
+func (l *lane) DispatchAll() {
+	for i := range l.queues {
+		l.dispatch(i, true)
+	}
+}
+
+// Release releases the jobs processed by a worker of the lane; the
+// partitions holding jobs of the same tenants, held back by the in-flight
+// limit, are dispatched at once, as their jobs are due already
+func (l *lane) Release(p processedJobs) {
+	l.busy[p.worker]--
+	unblocked := l.sched.Done(p.jobs)
+	l.dispatch(p.worker, false)
+	for _, i := range unblocked {
+		l.dispatch(i, true)
+	}
+}
+
+// Close closes the worker queues
+func (l *lane) Close() {
+	for i := range l.queues {
+		close(l.queues[i])
+	}
+}
+
+// processedJobs is the batch of jobs processed by a worker
+type processedJobs struct {
+	lane   int
+	worker int
+	jobs   []model.Job
+}
+
+func workerRoutine(
+	ctx context.Context,
+	lane, worker int,
+	workerName string,
+	indexer Indexer,
+	jobQ <-chan []model.Job,
+	processed chan<- processedJobs,
+	wg *sync.WaitGroup) {
+	defer wg.Done()
+	l := log.FromContext(ctx)
+	l.Data["worker"] = workerName
+	l.Infof("Worker %s waiting for jobs", workerName)
+	ctx = log.WithContext(ctx, l)
+	for jobs := range jobQ {
+		l.Infof("processing %d jobs", len(jobs))
+		metrics.BatchSize.Observe(float64(len(jobs)))
+		metrics.WorkersBusy.Inc()
+		start := time.Now()
+		indexer.ProcessJobs(ctx, jobs)
+		metrics.WorkersBusySeconds.Add(time.Since(start).Seconds())
+		metrics.WorkersBusy.Dec()
+		processed <- processedJobs{lane: lane, worker: worker, jobs: jobs}
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	rconfig "github.com/mendersoftware/reporting/config"
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestNewLaneFromConfig(t *testing.T) {
+	shared := map[string]interface{}{
+		rconfig.SettingReindexBatchSize:   100,
+		rconfig.SettingWorkerConcurrency:  10,
+		rconfig.SettingReindexMaxTimeMsec: 1000,
+	}
+	testCases := map[string]struct {
+		lane     int
+		settings map[string]interface{}
+
+		batchSize int
+		workers   int
+		maxWait   time.Duration
+		err       string
+	}{
+		"ok, default to the shared settings": {
+			lane:      laneDevices,
+			batchSize: 100,
+			workers:   5,
+			maxWait:   time.Second,
+		},
+		"ok, shared workers split across the lanes": {
+			lane: laneDeployments,
+			settings: map[string]interface{}{
+				rconfig.SettingWorkerConcurrency:               11,
+				rconfig.SettingReindexDevicesWorkerConcurrency: 20,
+			},
+			batchSize: 100,
+			workers:   5,
+			maxWait:   time.Second,
+		},
+		"ok, device settings": {
+			lane: laneDevices,
+			settings: map[string]interface{}{
+				rconfig.SettingReindexDevicesBatchSize:         50,
+				rconfig.SettingReindexDevicesWorkerConcurrency: 20,
+				rconfig.SettingReindexDevicesMaxTimeMsec:       100,
+				rconfig.SettingReindexDeploymentsBatchSize:     10,
+			},
+			batchSize: 50,
+			workers:   20,
+			maxWait:   100 * time.Millisecond,
+		},
+		"ok, deployment settings": {
+			lane: laneDeployments,
+			settings: map[string]interface{}{
+				rconfig.SettingReindexDevicesBatchSize:             50,
+				rconfig.SettingReindexDeploymentsBatchSize:         10,
+				rconfig.SettingReindexDeploymentsWorkerConcurrency: 2,
+				rconfig.SettingReindexDeploymentsMaxTimeMsec:       5000,
+			},
+			batchSize: 10,
+			workers:   2,
+			maxWait:   5 * time.Second,
+		},
+		"error, negative lane setting": {
+			lane: laneDeployments,
+			settings: map[string]interface{}{
+				rconfig.SettingReindexDeploymentsWorkerConcurrency: -1,
+			},
+			err: rconfig.SettingReindexDeploymentsWorkerConcurrency +
+				": must be a non-negative integer",
+		},
+		"error, invalid shared setting": {
+			lane: laneDevices,
+			settings: map[string]interface{}{
+				rconfig.SettingReindexBatchSize: 0,
+			},
+			err: rconfig.SettingReindexBatchSize + ": must be a positive integer",
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			conf := viper.New()
+			for key, value := range shared {
+				conf.Set(key, value)
+			}
+			for key, value := range tc.settings {
+				conf.Set(key, value)
+			}
+			l, err := newLaneFromConfig(conf, tc.lane, 20, 0)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, lanesSettings[tc.lane].name, l.name)
+			assert.Equal(t, tc.batchSize, l.batchSize)
+			assert.Len(t, l.queues, tc.workers)
+			assert.Len(t, l.busy, tc.workers)
+			assert.Equal(t, tc.maxWait, l.maxWait)
+		})
+	}
+}
+
+func TestLaneWorkers(t *testing.T) {
+	assert.Equal(t, 6, laneWorkers(laneDevices, 11))
+	assert.Equal(t, 5, laneWorkers(laneDeployments, 11))
+	assert.Equal(t, 1, laneWorkers(laneDevices, 1))
+	assert.Equal(t, 1, laneWorkers(laneDeployments, 1))
+}
+
+func TestLaneDurables(t *testing.T) {
+	conf := viper.New()
+	conf.Set(rconfig.SettingNatsSubscriberDurable, "reporting")
+	assert.Equal(t, []string{"reporting", "reporting-deployments"}, LaneDurables(conf))
+}
+
+func TestJobLane(t *testing.T) {
+	assert.Equal(t, laneDevices, jobLane(&model.Job{Action: model.ActionReindex}))
+	assert.Equal(t, laneDevices,
+		jobLane(&model.Job{Action: model.ActionReindexConnectivity}))
+	assert.Equal(t, laneDeployments,
+		jobLane(&model.Job{Action: model.ActionReindexDeployment}))
+}
+
+func TestLaneDispatch(t *testing.T) {
+	conf := viper.New()
+	conf.Set(rconfig.SettingReindexBatchSize, 2)
+	conf.Set(rconfig.SettingWorkerConcurrency, 1)
+	l, err := newLaneFromConfig(conf, laneDevices, 20, 0)
+	assert.NoError(t, err)
+
+	jobs := []model.Job{
+		{Action: model.ActionReindex, TenantID: "t1", DeviceID: "d1"},
+		{Action: model.ActionReindex, TenantID: "t1", DeviceID: "d2"},
+		{Action: model.ActionReindex, TenantID: "t1", DeviceID: "d3"},
+		{Action: model.ActionReindex, TenantID: "t1", DeviceID: "d4"},
+		{Action: model.ActionReindex, TenantID: "t1", DeviceID: "d5"},
+	}
+
+	// the first batch is dispatched once full
+	l.Push(jobs[0])
+	assert.Empty(t, l.queues[0])
+	l.Push(jobs[1])
+	first := <-l.queues[0]
+	assert.Equal(t, jobs[:2], first)
+	assert.Equal(t, 1, l.busy[0])
+
+	// the second batch waits in the queue, the third one for the worker
+	l.Push(jobs[2])
+	l.Push(jobs[3])
+	l.Push(jobs[4])
+	assert.Equal(t, 2, l.busy[0])
+	assert.Equal(t, 1, l.sched.Total())
+	l.DispatchAll()
+	assert.Equal(t, 1, l.sched.Total())
+
+	l.Release(processedJobs{lane: laneDevices, worker: 0, jobs: first})
+	assert.Equal(t, 1, l.busy[0])
+	assert.Equal(t, jobs[2:4], <-l.queues[0])
+	l.DispatchAll()
+	assert.Equal(t, 2, l.busy[0])
+	assert.Equal(t, jobs[4:], <-l.queues[0])
+	assert.Equal(t, 0, l.sched.Total())
+}
+
+func TestLaneReleaseInFlightLimit(t *testing.T) {
+	conf := viper.New()
+	conf.Set(rconfig.SettingReindexBatchSize, 1)
+	conf.Set(rconfig.SettingWorkerConcurrency, 2)
+	conf.Set(rconfig.SettingReindexDevicesWorkerConcurrency, 2)
+	l, err := newLaneFromConfig(conf, laneDevices, 20, 1)
+	assert.NoError(t, err)
+
+	// two jobs of the same tenant, in different partitions
+	jobs := make([]model.Job, 2)
+	for i := 0; jobs[1].DeviceID == ""; i++ {
+		job := model.Job{
+			Action:   model.ActionReindex,
+			TenantID: "t1",
+			DeviceID: "d" + strconv.Itoa(i),
+		}
+		p := jobPartition(&job, 2)
+		if jobs[p].DeviceID == "" {
+			jobs[p] = job
+		}
+	}
+
+	l.Push(jobs[0])
+	assert.Equal(t, []model.Job{jobs[0]}, <-l.queues[0])
+
+	// the tenant reached the in-flight limit
+	l.Push(jobs[1])
+	assert.Empty(t, l.queues[1])
+	assert.Equal(t, 1, l.sched.Total())
+
+	// the other partition is dispatched as soon as the tenant has room
+	l.Release(processedJobs{lane: laneDevices, worker: 0, jobs: jobs[:1]})
+	assert.Len(t, l.queues[1], 1)
+	assert.Equal(t, []model.Job{jobs[1]}, <-l.queues[1])
+	assert.Equal(t, 0, l.sched.Total())
+}
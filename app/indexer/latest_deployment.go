@@ -0,0 +1,206 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+
+	"github.com/mendersoftware/reporting/client/deployments"
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	fieldDeviceStatus   = "device_status"
+	fieldDeviceFinished = "device_finished"
+	aggFailedByDevice   = "failed_by_device"
+)
+
+// latestDeployment summarizes the deployments of a device: the latest
+// finished deployment, its details and the count of recently failed ones
+type latestDeployment struct {
+	deployments.LastDeviceDeployment
+	// Details is the device deployment, if the upstream service returned
+	// its ID
+	Details *deployments.DeviceDeployment
+	// FailedCount is the number of deployments which failed within the
+	// failed deployments window
+	FailedCount int
+}
+
+// getLatestDeployments returns the latest deployments of the devices, by
+// device ID, enriched with the deployment details and failed counts
+func (i *indexer) getLatestDeployments(
+	ctx context.Context,
+	tenant string,
+	lastDeployments []deployments.LastDeviceDeployment,
+) (map[string]*latestDeployment, error) {
+	latest := make(map[string]*latestDeployment, len(lastDeployments))
+	if len(lastDeployments) == 0 {
+		return latest, nil
+	}
+	deviceIDs := make([]string, 0, len(lastDeployments))
+	deviceDeploymentIDs := make([]string, 0, len(lastDeployments))
+	for _, d := range lastDeployments {
+		latest[d.DeviceID] = &latestDeployment{LastDeviceDeployment: d}
+		deviceIDs = append(deviceIDs, d.DeviceID)
+		if d.DeviceDeploymentID != "" {
+			deviceDeploymentIDs = append(deviceDeploymentIDs, d.DeviceDeploymentID)
+		}
+	}
+	if len(deviceDeploymentIDs) > 0 {
+		details, err := i.deplClient.GetDeployments(ctx, tenant, deviceDeploymentIDs)
+		if err != nil {
+			return nil, errors.Wrap(err,
+				"failed to get the latest device deployments from deployments")
+		}
+		for _, d := range details {
+			if d.Device == nil {
+				continue
+			}
+			if l, ok := latest[d.Device.DeviceId]; ok &&
+				l.DeviceDeploymentID == d.ID {
+				l.Details = d
+			}
+		}
+	}
+	if i.failedDeploymentsWindow > 0 {
+		counts, err := i.countFailedDeployments(ctx, tenant, deviceIDs)
+		if err != nil {
+			return nil, err
+		}
+		for deviceID, count := range counts {
+			latest[deviceID].FailedCount = count
+		}
+	}
+	return latest, nil
+}
+
+// countFailedDeployments counts the deployments which failed within the
+// failed deployments window, by device ID, from the deployments index
+func (i *indexer) countFailedDeployments(
+	ctx context.Context,
+	tenant string,
+	deviceIDs []string,
+) (map[string]int, error) {
+	since := time.Now().Add(-i.failedDeploymentsWindow).UTC()
+	query := model.NewQuery().
+		Must(model.M{
+			"term": model.M{model.FieldNameTenantID: tenant},
+		}).
+		Must(model.M{
+			"terms": model.M{model.FieldNameDeviceID: deviceIDs},
+		}).
+		Must(model.M{
+			"term": model.M{
+				fieldDeviceStatus: deployments.DeviceDeploymentStatusFailure,
+			},
+		}).
+		Must(model.M{
+			"range": model.M{
+				fieldDeviceFinished: model.M{"gte": since.Format(time.RFC3339)},
+			},
+		}).
+		WithSize(0).
+		With(model.M{
+			"aggs": model.M{
+				aggFailedByDevice: model.M{
+					"terms": model.M{
+						"field": model.FieldNameDeviceID,
+						"size":  len(deviceIDs),
+					},
+				},
+			},
+		})
+
+	ctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenant})
+	res, err := i.store.AggregateDeployments(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count the failed deployments")
+	}
+
+	counts := make(map[string]int, len(deviceIDs))
+	aggs, _ := res["aggregations"].(map[string]interface{})
+	agg, _ := aggs[aggFailedByDevice].(map[string]interface{})
+	buckets, _ := agg["buckets"].([]interface{})
+	for _, b := range buckets {
+		bucket, _ := b.(map[string]interface{})
+		key, _ := bucket["key"].(string)
+		count, _ := bucket["doc_count"].(float64)
+		if key != "" {
+			counts[key] = int(count)
+		}
+	}
+	return counts, nil
+}
+
+// appendLatestDeploymentAttributes appends the system attributes
+// describing the latest deployment of the device
+func (i *indexer) appendLatestDeploymentAttributes(
+	device *model.Device,
+	latest *latestDeployment,
+) {
+	var deploymentID, name, artifactName string
+	var finished *time.Time
+	deploymentID = latest.DeploymentID
+	if details := latest.Details; details != nil {
+		if details.Deployment != nil {
+			deploymentID = details.Deployment.Id
+			name = details.Deployment.Name
+			artifactName = details.Deployment.ArtifactName
+		}
+		if details.Device.Image != nil {
+			artifactName = details.Device.Image.Name
+		}
+		finished = details.Device.Finished
+	}
+
+	_ = device.AppendAttr(&model.InventoryAttribute{
+		Scope:  model.ScopeSystem,
+		Name:   model.AttrNameLatestDeploymentStatus,
+		String: []string{latest.DeviceDeploymentStatus},
+	})
+	for _, attr := range []struct{ name, value string }{
+		{name: model.AttrNameLatestDeploymentID, value: deploymentID},
+		{name: model.AttrNameLatestDeploymentName, value: name},
+		{name: model.AttrNameLatestDeploymentArtifact, value: artifactName},
+	} {
+		if attr.value != "" {
+			_ = device.AppendAttr(&model.InventoryAttribute{
+				Scope:  model.ScopeSystem,
+				Name:   attr.name,
+				String: []string{attr.value},
+			})
+		}
+	}
+	if finished != nil {
+		_ = device.AppendAttr(&model.InventoryAttribute{
+			Scope:  model.ScopeSystem,
+			Name:   model.AttrNameLatestDeploymentFinished,
+			String: []string{finished.UTC().Format(time.RFC3339)},
+		})
+	}
+	if i.failedDeploymentsWindow > 0 {
+		_ = device.AppendAttr(&model.InventoryAttribute{
+			Scope:   model.ScopeSystem,
+			Name:    model.AttrNameFailedDeployments,
+			Numeric: []float64{float64(latest.FailedCount)},
+		})
+	}
+}
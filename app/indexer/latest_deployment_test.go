@@ -0,0 +1,221 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+
+	"github.com/mendersoftware/reporting/client/deployments"
+	deployments_mocks "github.com/mendersoftware/reporting/client/deployments/mocks"
+	"github.com/mendersoftware/reporting/model"
+	store_mocks "github.com/mendersoftware/reporting/store/mocks"
+)
+
+func TestGetLatestDeployments(t *testing.T) {
+	const tenantID = "tenant"
+	finished := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	lastDeployments := []deployments.LastDeviceDeployment{
+		{
+			DeviceID:               "1",
+			DeviceDeploymentID:     "dd1",
+			DeploymentID:           "d1",
+			DeviceDeploymentStatus: deployments.DeviceDeploymentStatusFailure,
+		},
+		{
+			DeviceID:               "2",
+			DeploymentID:           "d2",
+			DeviceDeploymentStatus: "success",
+		},
+	}
+	details := []*deployments.DeviceDeployment{{
+		ID: "dd1",
+		Deployment: &deployments.Deployment{
+			Id:           "d1",
+			Name:         "release 1.2",
+			ArtifactName: "release-1.2",
+		},
+		Device: &deployments.Device{
+			Id:       "dd1",
+			DeviceId: "1",
+			Finished: &finished,
+			Image:    &deployments.Image{Name: "release-1.2-rc"},
+		},
+	}}
+
+	testCases := map[string]struct {
+		failedWindow time.Duration
+
+		detailsErr error
+		aggregate  model.M
+		aggErr     error
+
+		latest map[string]*latestDeployment
+		err    error
+	}{
+		"ok": {
+			failedWindow: 24 * time.Hour,
+			aggregate: model.M{
+				"aggregations": map[string]interface{}{
+					aggFailedByDevice: map[string]interface{}{
+						"buckets": []interface{}{
+							map[string]interface{}{
+								"key":       "1",
+								"doc_count": float64(3),
+							},
+						},
+					},
+				},
+			},
+			latest: map[string]*latestDeployment{
+				"1": {
+					LastDeviceDeployment: lastDeployments[0],
+					Details:              details[0],
+					FailedCount:          3,
+				},
+				"2": {
+					LastDeviceDeployment: lastDeployments[1],
+				},
+			},
+		},
+		"ok, failed count disabled": {
+			latest: map[string]*latestDeployment{
+				"1": {
+					LastDeviceDeployment: lastDeployments[0],
+					Details:              details[0],
+				},
+				"2": {
+					LastDeviceDeployment: lastDeployments[1],
+				},
+			},
+		},
+		"ko, failure in deployments": {
+			detailsErr: errors.New("deployments error"),
+			err: errors.New("failed to get the latest device deployments " +
+				"from deployments: deployments error"),
+		},
+		"ko, failure in store": {
+			failedWindow: 24 * time.Hour,
+			aggErr:       errors.New("store error"),
+			err:          errors.New("failed to count the failed deployments: store error"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			deplClient := &deployments_mocks.Client{}
+			defer deplClient.AssertExpectations(t)
+			deplClient.On("GetDeployments",
+				ctx,
+				tenantID,
+				[]string{"dd1"},
+			).Return(details, tc.detailsErr)
+
+			store := &store_mocks.Store{}
+			defer store.AssertExpectations(t)
+			if tc.failedWindow > 0 && tc.detailsErr == nil {
+				store.On("AggregateDeployments",
+					mock.MatchedBy(func(ctx context.Context) bool {
+						id := identity.FromContext(ctx)
+						return id != nil && id.Tenant == tenantID
+					}),
+					mock.AnythingOfType("*model.query"),
+				).Return(tc.aggregate, tc.aggErr)
+			}
+
+			indexer := NewIndexer(store, nil, nil, nil, nil, deplClient,
+				WithFailedDeploymentsWindow(tc.failedWindow)).(*indexer)
+
+			latest, err := indexer.getLatestDeployments(ctx, tenantID, lastDeployments)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.latest, latest)
+			}
+		})
+	}
+}
+
+func TestAppendLatestDeploymentAttributes(t *testing.T) {
+	finished := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	latest := &latestDeployment{
+		LastDeviceDeployment: deployments.LastDeviceDeployment{
+			DeviceID:               "1",
+			DeviceDeploymentID:     "dd1",
+			DeviceDeploymentStatus: deployments.DeviceDeploymentStatusFailure,
+		},
+		Details: &deployments.DeviceDeployment{
+			ID: "dd1",
+			Deployment: &deployments.Deployment{
+				Id:           "d1",
+				Name:         "release 1.2",
+				ArtifactName: "release-1.2",
+			},
+			Device: &deployments.Device{
+				Finished: &finished,
+			},
+		},
+		FailedCount: 2,
+	}
+
+	indexer := NewIndexer(nil, nil, nil, nil, nil, nil,
+		WithFailedDeploymentsWindow(time.Hour)).(*indexer)
+	device := model.NewDevice("tenant", "1")
+	indexer.appendLatestDeploymentAttributes(device, latest)
+
+	assert.Equal(t, model.InventoryAttributes{
+		{
+			Scope:  model.ScopeSystem,
+			Name:   model.AttrNameLatestDeploymentStatus,
+			String: []string{deployments.DeviceDeploymentStatusFailure},
+		},
+		{
+			Scope:  model.ScopeSystem,
+			Name:   model.AttrNameLatestDeploymentID,
+			String: []string{"d1"},
+		},
+		{
+			Scope:  model.ScopeSystem,
+			Name:   model.AttrNameLatestDeploymentName,
+			String: []string{"release 1.2"},
+		},
+		{
+			Scope:  model.ScopeSystem,
+			Name:   model.AttrNameLatestDeploymentArtifact,
+			String: []string{"release-1.2"},
+		},
+		{
+			Scope:  model.ScopeSystem,
+			Name:   model.AttrNameLatestDeploymentFinished,
+			String: []string{"2023-05-01T10:00:00Z"},
+		},
+		{
+			Scope:   model.ScopeSystem,
+			Name:    model.AttrNameFailedDeployments,
+			Numeric: []float64{2},
+		},
+	}, device.SystemAttributes)
+}
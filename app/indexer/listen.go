@@ -0,0 +1,76 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rest.utils"
+
+	"github.com/mendersoftware/reporting/metrics"
+)
+
+const (
+	URIAlive   = "/alive"
+	URIHealth  = "/health"
+	URIMetrics = "/metrics"
+)
+
+// newHTTPHandler returns the handler serving the indexer liveness and
+// readiness endpoints and the metrics
+func newHTTPHandler(indexer Indexer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(URIAlive, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc(URIHealth, func(w http.ResponseWriter, r *http.Request) {
+		err := indexer.HealthCheck(r.Context())
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(rest.Error{Err: err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.Handle(URIMetrics, metrics.Handler())
+	return mux
+}
+
+// listenAndServe serves the handler on the given address in the background,
+// until the context is canceled
+func listenAndServe(ctx context.Context, addr string, handler http.Handler) {
+	l := log.FromContext(ctx)
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+	go func() {
+		l.Infof("indexer listening on %s", addr)
+		err := srv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			l.Errorf("indexer listener failed: %s", err)
+		}
+	}()
+}
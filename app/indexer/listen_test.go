@@ -0,0 +1,83 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/app/indexer/mocks"
+	"github.com/mendersoftware/reporting/metrics"
+)
+
+func TestHTTPHandlerHealth(t *testing.T) {
+	testCases := map[string]struct {
+		path      string
+		healthErr error
+
+		code int
+		body string
+	}{
+		"alive": {
+			path: URIAlive,
+			code: http.StatusNoContent,
+		},
+		"health": {
+			path: URIHealth,
+			code: http.StatusNoContent,
+		},
+		"health, ko": {
+			path:      URIHealth,
+			healthErr: errors.New("not connected to nats"),
+			code:      http.StatusInternalServerError,
+			body:      `{"error":"not connected to nats"}`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			indexer := &mocks.Indexer{}
+			defer indexer.AssertExpectations(t)
+			if tc.path == URIHealth {
+				indexer.On("HealthCheck", mock.Anything).Return(tc.healthErr)
+			}
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+			newHTTPHandler(indexer).ServeHTTP(w, req)
+
+			assert.Equal(t, tc.code, w.Code)
+			if tc.body != "" {
+				assert.JSONEq(t, tc.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHTTPHandlerMetrics(t *testing.T) {
+	metrics.JobsReceived.WithLabelValues("reindex", "tenant").Inc()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, URIMetrics, nil)
+	newHTTPHandler(&mocks.Indexer{}).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(),
+		`reporting_indexer_jobs_received_total{action="reindex",tenant="tenant"} 1`)
+}
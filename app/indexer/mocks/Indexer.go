@@ -30,11 +30,11 @@ type Indexer struct {
 }
 
 // GetJobs provides a mock function with given fields: ctx, jobs
-func (_m *Indexer) GetJobs(ctx context.Context, jobs chan model.Job) error {
+func (_m *Indexer) GetJobs(ctx context.Context, jobs []chan model.Job) error {
 	ret := _m.Called(ctx, jobs)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, chan model.Job) error); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, []chan model.Job) error); ok {
 		r0 = rf(ctx, jobs)
 	} else {
 		r0 = ret.Error(0)
@@ -43,7 +43,72 @@ func (_m *Indexer) GetJobs(ctx context.Context, jobs chan model.Job) error {
 	return r0
 }
 
+// HealthCheck provides a mock function with given fields: ctx
+func (_m *Indexer) HealthCheck(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // ProcessJobs provides a mock function with given fields: ctx, jobs
 func (_m *Indexer) ProcessJobs(ctx context.Context, jobs []model.Job) {
 	_m.Called(ctx, jobs)
 }
+
+// ReindexAll provides a mock function with given fields: ctx
+func (_m *Indexer) ReindexAll(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReindexTenant provides a mock function with given fields: ctx, tenantID
+func (_m *Indexer) ReindexTenant(ctx context.Context, tenantID string) error {
+	ret := _m.Called(ctx, tenantID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, tenantID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// VerifyTenant provides a mock function with given fields: ctx, tenantID, sample
+func (_m *Indexer) VerifyTenant(ctx context.Context, tenantID string, sample int) (*model.DriftReport, error) {
+	ret := _m.Called(ctx, tenantID, sample)
+
+	var r0 *model.DriftReport
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) *model.DriftReport); ok {
+		r0 = rf(ctx, tenantID, sample)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DriftReport)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, tenantID, sample)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,217 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"github.com/mendersoftware/reporting/client/deployments"
+	"github.com/mendersoftware/reporting/client/deviceauth"
+	"github.com/mendersoftware/reporting/client/inventory"
+	"github.com/mendersoftware/reporting/metrics"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// jobPayloads merges the payloads of the tenant's device jobs by device
+// ID; as the jobs are in order, the data of the later jobs prevails, and
+// the changed inventory attributes are merged, while a job without a valid
+// payload discards the data of the previous ones, as there is no telling
+// which data changed
+func jobPayloads(jobs []model.Job, tenant string) map[string]*model.JobPayload {
+	payloads := make(map[string]*model.JobPayload)
+	for _, job := range jobs {
+		if job.TenantID != tenant || jobIndexAction(&job) != model.ActionReindex {
+			continue
+		}
+		if !job.Payload.Valid() {
+			delete(payloads, job.DeviceID)
+			continue
+		}
+		merged, ok := payloads[job.DeviceID]
+		if !ok {
+			merged = &model.JobPayload{Version: model.JobPayloadVersion}
+			payloads[job.DeviceID] = merged
+		}
+		if job.Payload.DeviceAuth != nil {
+			merged.DeviceAuth = job.Payload.DeviceAuth
+		}
+		if job.Payload.Inventory != nil {
+			merged.Inventory = mergeInventoryPayloads(merged.Inventory,
+				job.Payload.Inventory)
+		}
+		if job.Payload.Deployments != nil {
+			merged.Deployments = job.Payload.Deployments
+		}
+	}
+	return payloads
+}
+
+// mergeInventoryPayloads applies the later inventory payload to the
+// previous one: a complete payload replaces it, while the attributes of a
+// partial one override the attributes with the same scope and name
+func mergeInventoryPayloads(
+	prev, next *model.JobPayloadInventory,
+) *model.JobPayloadInventory {
+	if prev == nil || next.Complete {
+		return next
+	}
+	return &model.JobPayloadInventory{
+		Attributes: mergePayloadAttributes(prev.Attributes, next.Attributes),
+		UpdatedTs:  next.UpdatedTs,
+		Complete:   prev.Complete,
+	}
+}
+
+func mergePayloadAttributes(
+	attrs, changed []model.JobPayloadAttribute,
+) []model.JobPayloadAttribute {
+	keys := make(map[string]bool, len(changed))
+	for _, attr := range changed {
+		keys[payloadAttributeKey(attr.Scope, attr.Name)] = true
+	}
+	merged := make([]model.JobPayloadAttribute, 0, len(attrs)+len(changed))
+	for _, attr := range attrs {
+		if !keys[payloadAttributeKey(attr.Scope, attr.Name)] {
+			merged = append(merged, attr)
+		}
+	}
+	return append(merged, changed...)
+}
+
+func payloadAttributeKey(scope, name string) string {
+	if scope == "" {
+		scope = inventory.AttrScopeInventory
+	}
+	return scope + "/" + name
+}
+
+// mergeInventoryDevice applies the changed attributes of a partial inventory
+// payload to the device fetched from inventory, if the payload is more
+// recent; otherwise, the fetched device already holds the changes
+func mergeInventoryDevice(
+	device inventory.Device,
+	payload *model.JobPayloadInventory,
+) inventory.Device {
+	if !payload.UpdatedTs.After(device.UpdatedTs) {
+		return device
+	}
+	changed := payloadToInventoryDevice(string(device.ID), payload)
+	keys := make(map[string]bool, len(changed.Attributes))
+	for _, attr := range changed.Attributes {
+		keys[payloadAttributeKey(attr.Scope, attr.Name)] = true
+	}
+	attributes := make(inventory.DeviceAttributes, 0,
+		len(device.Attributes)+len(changed.Attributes))
+	for _, attr := range device.Attributes {
+		if !keys[payloadAttributeKey(attr.Scope, attr.Name)] {
+			attributes = append(attributes, attr)
+		}
+	}
+	device.Attributes = append(attributes, changed.Attributes...)
+	device.UpdatedTs = payload.UpdatedTs
+	return device
+}
+
+// devicePayloads splits the devices between the ones whose data is
+// carried by the payloads, and the ones to fetch from upstream; the
+// partial inventory payloads are merged with the fetched devices
+type devicePayloads struct {
+	deviceAuth       map[string]deviceauth.DeviceAuthDevice
+	deviceAuthFetch  []string
+	inventory        []inventory.Device
+	inventoryFetch   []string
+	inventoryPartial map[string]*model.JobPayloadInventory
+	deployments      []deployments.LastDeviceDeployment
+	deploymentsFetch []string
+}
+
+func newDevicePayloads(
+	deviceIDs []string,
+	payloads map[string]*model.JobPayload,
+) *devicePayloads {
+	p := &devicePayloads{
+		deviceAuth:       make(map[string]deviceauth.DeviceAuthDevice),
+		inventoryPartial: make(map[string]*model.JobPayloadInventory),
+	}
+	for _, deviceID := range deviceIDs {
+		payload := payloads[deviceID]
+		if payload != nil && payload.DeviceAuth != nil {
+			p.deviceAuth[deviceID] = payloadToDeviceAuthDevice(deviceID, payload.DeviceAuth)
+		} else {
+			p.deviceAuthFetch = append(p.deviceAuthFetch, deviceID)
+		}
+		if payload != nil && payload.Inventory != nil && payload.Inventory.Complete {
+			p.inventory = append(p.inventory,
+				payloadToInventoryDevice(deviceID, payload.Inventory))
+		} else {
+			p.inventoryFetch = append(p.inventoryFetch, deviceID)
+			if payload != nil && payload.Inventory != nil {
+				p.inventoryPartial[deviceID] = payload.Inventory
+			}
+		}
+		if payload != nil && payload.Deployments != nil {
+			if payload.Deployments.Status != "" {
+				p.deployments = append(p.deployments, deployments.LastDeviceDeployment{
+					DeviceID:               deviceID,
+					DeviceDeploymentID:     payload.Deployments.DeviceDeploymentID,
+					DeploymentID:           payload.Deployments.DeploymentID,
+					DeviceDeploymentStatus: payload.Deployments.Status,
+				})
+			}
+		} else {
+			p.deploymentsFetch = append(p.deploymentsFetch, deviceID)
+		}
+	}
+	metrics.JobPayloadsUsed.WithLabelValues(model.ServiceDeviceauth).
+		Add(float64(len(deviceIDs) - len(p.deviceAuthFetch)))
+	metrics.JobPayloadsUsed.WithLabelValues(model.ServiceInventory).
+		Add(float64(len(deviceIDs) - len(p.inventoryFetch)))
+	metrics.JobPayloadsUsed.WithLabelValues(model.ServiceDeployments).
+		Add(float64(len(deviceIDs) - len(p.deploymentsFetch)))
+	return p
+}
+
+func payloadToDeviceAuthDevice(
+	deviceID string,
+	payload *model.JobPayloadDeviceAuth,
+) deviceauth.DeviceAuthDevice {
+	return deviceauth.DeviceAuthDevice{
+		ID:              deviceID,
+		IdDataStruct:    payload.IdentityData,
+		Status:          payload.Status,
+		LastCheckinDate: payload.LastCheckIn,
+	}
+}
+
+func payloadToInventoryDevice(
+	deviceID string,
+	payload *model.JobPayloadInventory,
+) inventory.Device {
+	attributes := make(inventory.DeviceAttributes, 0, len(payload.Attributes))
+	for _, attr := range payload.Attributes {
+		scope := attr.Scope
+		if scope == "" {
+			scope = inventory.AttrScopeInventory
+		}
+		attributes = append(attributes, inventory.DeviceAttribute{
+			Name:  attr.Name,
+			Scope: scope,
+			Value: attr.Value,
+		})
+	}
+	return inventory.Device{
+		ID:         inventory.DeviceID(deviceID),
+		Attributes: attributes,
+		UpdatedTs:  payload.UpdatedTs,
+	}
+}
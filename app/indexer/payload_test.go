@@ -0,0 +1,392 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/client/deployments"
+	deployments_mocks "github.com/mendersoftware/reporting/client/deployments/mocks"
+	deviceauth_mocks "github.com/mendersoftware/reporting/client/deviceauth/mocks"
+	"github.com/mendersoftware/reporting/client/inventory"
+	inventory_mocks "github.com/mendersoftware/reporting/client/inventory/mocks"
+	"github.com/mendersoftware/reporting/model"
+	store_mocks "github.com/mendersoftware/reporting/store/mocks"
+)
+
+func TestJobPayloads(t *testing.T) {
+	const tenantID = "tenant"
+
+	deviceAuth := &model.JobPayloadDeviceAuth{Status: "accepted"}
+	inv := &model.JobPayloadInventory{}
+	deploymentsV1 := &model.JobPayloadDeployments{Status: "failure"}
+	deploymentsV2 := &model.JobPayloadDeployments{Status: "success"}
+
+	testCases := map[string]struct {
+		jobs []model.Job
+
+		payloads map[string]*model.JobPayload
+	}{
+		"ok, merged": {
+			jobs: []model.Job{{
+				Action:   model.ActionReindex,
+				TenantID: tenantID,
+				DeviceID: "1",
+				Payload: &model.JobPayload{
+					Version:     model.JobPayloadVersion,
+					DeviceAuth:  deviceAuth,
+					Deployments: deploymentsV1,
+				},
+			}, {
+				Action:   model.ActionReindex,
+				TenantID: tenantID,
+				DeviceID: "1",
+				Payload: &model.JobPayload{
+					Version:     model.JobPayloadVersion,
+					Inventory:   inv,
+					Deployments: deploymentsV2,
+				},
+			}},
+
+			payloads: map[string]*model.JobPayload{
+				"1": {
+					Version:     model.JobPayloadVersion,
+					DeviceAuth:  deviceAuth,
+					Inventory:   inv,
+					Deployments: deploymentsV2,
+				},
+			},
+		},
+		"ok, discarded by a later job without payload": {
+			jobs: []model.Job{{
+				Action:   model.ActionReindex,
+				TenantID: tenantID,
+				DeviceID: "1",
+				Payload: &model.JobPayload{
+					Version:    model.JobPayloadVersion,
+					DeviceAuth: deviceAuth,
+				},
+			}, {
+				Action:   model.ActionReindexConnectivity,
+				TenantID: tenantID,
+				DeviceID: "1",
+			}, {
+				Action:   model.ActionReindex,
+				TenantID: tenantID,
+				DeviceID: "2",
+				Payload: &model.JobPayload{
+					Version:   model.JobPayloadVersion,
+					Inventory: inv,
+				},
+			}},
+
+			payloads: map[string]*model.JobPayload{
+				"2": {
+					Version:   model.JobPayloadVersion,
+					Inventory: inv,
+				},
+			},
+		},
+		"ok, partial inventory payloads merged": {
+			jobs: []model.Job{{
+				Action:   model.ActionReindex,
+				TenantID: tenantID,
+				DeviceID: "1",
+				Payload: &model.JobPayload{
+					Version: model.JobPayloadVersion,
+					Inventory: &model.JobPayloadInventory{
+						Attributes: []model.JobPayloadAttribute{
+							{Name: "a", Value: "1"},
+							{Name: "b", Value: "1"},
+						},
+						Complete: true,
+					},
+				},
+			}, {
+				Action:   model.ActionReindex,
+				TenantID: tenantID,
+				DeviceID: "1",
+				Payload: &model.JobPayload{
+					Version: model.JobPayloadVersion,
+					Inventory: &model.JobPayloadInventory{
+						Attributes: []model.JobPayloadAttribute{
+							{Name: "b", Scope: "inventory", Value: "2"},
+							{Name: "c", Value: "2"},
+						},
+					},
+				},
+			}},
+
+			payloads: map[string]*model.JobPayload{
+				"1": {
+					Version: model.JobPayloadVersion,
+					Inventory: &model.JobPayloadInventory{
+						Attributes: []model.JobPayloadAttribute{
+							{Name: "a", Value: "1"},
+							{Name: "b", Scope: "inventory", Value: "2"},
+							{Name: "c", Value: "2"},
+						},
+						Complete: true,
+					},
+				},
+			},
+		},
+		"ok, unsupported version and other tenants ignored": {
+			jobs: []model.Job{{
+				Action:   model.ActionReindex,
+				TenantID: tenantID,
+				DeviceID: "1",
+				Payload: &model.JobPayload{
+					Version:    model.JobPayloadVersion + 1,
+					DeviceAuth: deviceAuth,
+				},
+			}, {
+				Action:   model.ActionReindex,
+				TenantID: "other",
+				DeviceID: "2",
+				Payload: &model.JobPayload{
+					Version:    model.JobPayloadVersion,
+					DeviceAuth: deviceAuth,
+				},
+			}},
+
+			payloads: map[string]*model.JobPayload{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.payloads, jobPayloads(tc.jobs, tenantID))
+		})
+	}
+}
+
+func TestProcessJobsWithPayloads(t *testing.T) {
+	const tenantID = "tenant"
+	ctx := context.Background()
+	updated := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	jobs := []model.Job{{
+		Action:   model.ActionReindex,
+		TenantID: tenantID,
+		DeviceID: "1",
+		Service:  model.ServiceInventory,
+		Payload: &model.JobPayload{
+			Version: model.JobPayloadVersion,
+			DeviceAuth: &model.JobPayloadDeviceAuth{
+				Status:       "accepted",
+				IdentityData: map[string]string{"mac": "00:11:22:33:44"},
+			},
+			Inventory: &model.JobPayloadInventory{
+				UpdatedTs: updated,
+				Complete:  true,
+			},
+			Deployments: &model.JobPayloadDeployments{
+				Status: "success",
+			},
+		},
+	}, {
+		Action:   model.ActionReindex,
+		TenantID: tenantID,
+		DeviceID: "2",
+		Service:  model.ServiceDeviceauth,
+		Payload: &model.JobPayload{
+			Version: model.JobPayloadVersion,
+			DeviceAuth: &model.JobPayloadDeviceAuth{
+				Status: "pending",
+			},
+		},
+	}}
+
+	// only the data missing from the payloads is fetched
+	invClient := &inventory_mocks.Client{}
+	defer invClient.AssertExpectations(t)
+	invClient.On("GetDevices", ctx, tenantID, []string{"2"}).
+		Return([]inventory.Device{{ID: "2", UpdatedTs: updated}}, nil)
+
+	deplClient := &deployments_mocks.Client{}
+	defer deplClient.AssertExpectations(t)
+	deplClient.On("GetLatestFinishedDeployment", ctx, tenantID, []string{"2"}).
+		Return([]deployments.LastDeviceDeployment{}, nil)
+
+	devClient := &deviceauth_mocks.Client{}
+	defer devClient.AssertExpectations(t)
+
+	ds := &store_mocks.DataStore{}
+	ds.On("UpdateAndGetMapping", ctx, tenantID, mock.Anything).
+		Return(&model.Mapping{TenantID: tenantID}, nil).Maybe()
+
+	store := &store_mocks.Store{}
+	defer store.AssertExpectations(t)
+	var indexed []*model.Device
+	store.On("BulkIndexDevices", ctx,
+		mock.MatchedBy(func(devices []*model.Device) bool {
+			indexed = devices
+			return true
+		}),
+		[]*model.Device{},
+	).Return(nil, nil)
+
+	indexer := NewIndexer(store, ds, nil, devClient, invClient, deplClient)
+
+	jobs, acks := withAcknowledgers(jobs)
+	indexer.ProcessJobs(ctx, jobs)
+	assertJobsSettled(t, acks, true)
+
+	if assert.Len(t, indexed, 2) {
+		assert.Equal(t, "1", *indexed[0].ID)
+		assert.Equal(t, updated, *indexed[0].UpdatedAt)
+		assert.Equal(t, model.InventoryAttributes{{
+			Scope:  model.ScopeIdentity,
+			Name:   model.AttrNameStatus,
+			String: []string{"accepted"},
+		}, {
+			Scope:  model.ScopeIdentity,
+			Name:   "mac",
+			String: []string{"00:11:22:33:44"},
+		}}, indexed[0].IdentityAttributes)
+		assert.Equal(t, model.InventoryAttributes{{
+			Scope:  model.ScopeSystem,
+			Name:   model.AttrNameLatestDeploymentStatus,
+			String: []string{"success"},
+		}}, indexed[0].SystemAttributes)
+
+		assert.Equal(t, "2", *indexed[1].ID)
+		assert.Equal(t, model.InventoryAttributes{{
+			Scope:  model.ScopeIdentity,
+			Name:   model.AttrNameStatus,
+			String: []string{"pending"},
+		}}, indexed[1].IdentityAttributes)
+	}
+}
+
+func TestProcessJobsWithPartialPayload(t *testing.T) {
+	const tenantID = "tenant"
+	fetchedAt := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	fetched := inventory.Device{
+		ID: "1",
+		Attributes: inventory.DeviceAttributes{{
+			Name:  "group",
+			Scope: model.ScopeSystem,
+			Value: "production",
+		}, {
+			Name:  "region",
+			Scope: model.ScopeSystem,
+			Value: "eu",
+		}},
+		UpdatedTs: fetchedAt,
+	}
+
+	testCases := map[string]struct {
+		payloadUpdated time.Time
+
+		updated    time.Time
+		attributes model.InventoryAttributes
+	}{
+		"ok, newer payload merged with the fetched attributes": {
+			payloadUpdated: fetchedAt.Add(time.Second),
+
+			updated: fetchedAt.Add(time.Second),
+			attributes: model.InventoryAttributes{{
+				Scope:  model.ScopeSystem,
+				Name:   "region",
+				String: []string{"eu"},
+			}, {
+				Scope:  model.ScopeSystem,
+				Name:   "group",
+				String: []string{"staging"},
+			}},
+		},
+		"ok, older payload superseded by the fetched attributes": {
+			payloadUpdated: fetchedAt.Add(-time.Second),
+
+			updated: fetchedAt,
+			attributes: model.InventoryAttributes{{
+				Scope:  model.ScopeSystem,
+				Name:   "group",
+				String: []string{"production"},
+			}, {
+				Scope:  model.ScopeSystem,
+				Name:   "region",
+				String: []string{"eu"},
+			}},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			jobs := []model.Job{{
+				Action:   model.ActionReindex,
+				TenantID: tenantID,
+				DeviceID: "1",
+				Service:  model.ServiceInventory,
+				Payload: &model.JobPayload{
+					Version: model.JobPayloadVersion,
+					DeviceAuth: &model.JobPayloadDeviceAuth{
+						Status: "accepted",
+					},
+					Inventory: &model.JobPayloadInventory{
+						Attributes: []model.JobPayloadAttribute{{
+							Name:  "group",
+							Scope: model.ScopeSystem,
+							Value: "staging",
+						}},
+						UpdatedTs: tc.payloadUpdated,
+					},
+					Deployments: &model.JobPayloadDeployments{},
+				},
+			}}
+
+			// the partial inventory payload doesn't spare the fetch
+			invClient := &inventory_mocks.Client{}
+			defer invClient.AssertExpectations(t)
+			invClient.On("GetDevices", ctx, tenantID, []string{"1"}).
+				Return([]inventory.Device{fetched}, nil)
+
+			ds := &store_mocks.DataStore{}
+			ds.On("UpdateAndGetMapping", ctx, tenantID, mock.Anything).
+				Return(&model.Mapping{TenantID: tenantID}, nil).Maybe()
+
+			store := &store_mocks.Store{}
+			defer store.AssertExpectations(t)
+			var indexed []*model.Device
+			store.On("BulkIndexDevices", ctx,
+				mock.MatchedBy(func(devices []*model.Device) bool {
+					indexed = devices
+					return true
+				}),
+				[]*model.Device{},
+			).Return(nil, nil)
+
+			indexer := NewIndexer(store, ds, nil, nil, invClient, nil)
+
+			jobs, acks := withAcknowledgers(jobs)
+			indexer.ProcessJobs(ctx, jobs)
+			assertJobsSettled(t, acks, true)
+
+			if assert.Len(t, indexed, 1) {
+				assert.Equal(t, tc.updated, *indexed[0].UpdatedAt)
+				assert.Equal(t, tc.attributes, indexed[0].SystemAttributes)
+			}
+		})
+	}
+}
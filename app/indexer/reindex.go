@@ -0,0 +1,149 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/reporting/store"
+)
+
+// reindexPageSize is the number of devices or device deployments fetched
+// and indexed together when reindexing a tenant
+const reindexPageSize = 100
+
+// ErrNoTenants is returned when listing the tenants finds none
+var ErrNoTenants = errors.New("no tenants found in the mappings: " +
+	"select the tenants explicitly")
+
+// TenantIDs returns the IDs of the tenants known to reporting; the tenants
+// are listed from the mappings, which are created when the first device of
+// a tenant is indexed: the tenants never indexed, or all of them after the
+// loss of the database, are not listed and must be selected explicitly.
+// It fails rather than returning an empty list, which would silently skip
+// the whole fleet.
+func TenantIDs(ctx context.Context, ds store.DataStore) ([]string, error) {
+	tenantIDs, err := ds.GetTenantIDs(ctx)
+	if err != nil {
+		return nil, err
+	} else if len(tenantIDs) == 0 {
+		return nil, ErrNoTenants
+	}
+	return tenantIDs, nil
+}
+
+// ReindexAll reindexes the devices and device deployments of all the tenants
+// listed by TenantIDs
+func (i *indexer) ReindexAll(ctx context.Context) error {
+	l := log.FromContext(ctx)
+	tenantIDs, err := TenantIDs(ctx, i.ds)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, tenantID := range tenantIDs {
+		err := i.ReindexTenant(ctx, tenantID)
+		if err != nil {
+			l.Errorf("failed to reindex tenant %q: %s", tenantID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("failed to reindex %d of %d tenants",
+			failed, len(tenantIDs))
+	}
+	return nil
+}
+
+// ReindexTenant reindexes all the devices and device deployments of the tenant
+func (i *indexer) ReindexTenant(ctx context.Context, tenantID string) error {
+	l := log.FromContext(ctx)
+	l.Infof("reindexing tenant %q", tenantID)
+	devices, err := i.reindexDevices(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	deployments, err := i.reindexDeployments(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	l.Infof("reindexed %d devices and %d device deployments for tenant %q",
+		devices, deployments, tenantID)
+	return nil
+}
+
+func (i *indexer) reindexDevices(ctx context.Context, tenantID string) (int, error) {
+	l := log.FromContext(ctx)
+	reindexed, failed := 0, 0
+	for page := 1; ; page++ {
+		devices, err := i.invClient.ListDevices(ctx, tenantID, page, reindexPageSize)
+		if err != nil {
+			return reindexed, errors.Wrap(err, "failed to list the devices from inventory")
+		}
+		if len(devices) > 0 {
+			IDs := make(IDs, len(devices))
+			for _, device := range devices {
+				IDs[string(device.ID)] = true
+			}
+			err = i.processJobDevices(ctx, tenantID, IDs, nil)
+			if err != nil {
+				l.Error(err)
+				failed += len(IDs)
+			} else {
+				reindexed += len(IDs)
+			}
+		}
+		if len(devices) < reindexPageSize {
+			break
+		}
+	}
+	if failed > 0 {
+		return reindexed, errors.Errorf("failed to reindex %d devices", failed)
+	}
+	return reindexed, nil
+}
+
+func (i *indexer) reindexDeployments(ctx context.Context, tenantID string) (int, error) {
+	l := log.FromContext(ctx)
+	reindexed, failed := 0, 0
+	for page := 1; ; page++ {
+		deviceDeployments, err := i.deplClient.ListDeviceDeployments(ctx, tenantID,
+			page, reindexPageSize)
+		if err != nil {
+			return reindexed, errors.Wrap(err,
+				"failed to list the device deployments from deployments")
+		}
+		if len(deviceDeployments) > 0 {
+			err = i.indexDeployments(ctx, tenantID, deviceDeployments)
+			if err != nil {
+				l.Error(err)
+				failed += len(deviceDeployments)
+			} else {
+				reindexed += len(deviceDeployments)
+			}
+		}
+		if len(deviceDeployments) < reindexPageSize {
+			break
+		}
+	}
+	if failed > 0 {
+		return reindexed, errors.Errorf("failed to reindex %d device deployments", failed)
+	}
+	return reindexed, nil
+}
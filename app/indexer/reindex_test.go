@@ -0,0 +1,216 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/client/deployments"
+	deployments_mocks "github.com/mendersoftware/reporting/client/deployments/mocks"
+	"github.com/mendersoftware/reporting/client/deviceauth"
+	deviceauth_mocks "github.com/mendersoftware/reporting/client/deviceauth/mocks"
+	"github.com/mendersoftware/reporting/client/inventory"
+	inventory_mocks "github.com/mendersoftware/reporting/client/inventory/mocks"
+	"github.com/mendersoftware/reporting/model"
+	store_mocks "github.com/mendersoftware/reporting/store/mocks"
+)
+
+func TestReindexTenant(t *testing.T) {
+	const tenantID = "tenant"
+
+	fullPage := make([]inventory.Device, reindexPageSize)
+	for i := range fullPage {
+		fullPage[i] = inventory.Device{ID: inventory.DeviceID(strconv.Itoa(i))}
+	}
+
+	testCases := map[string]struct {
+		devicePages    [][]inventory.Device
+		listDevicesErr error
+
+		deviceDeployments    []*deployments.DeviceDeployment
+		listDeploymentsErr   error
+		bulkIndexDevicesErr  error
+		bulkIndexDeplsCalled bool
+
+		err error
+	}{
+		"ok": {
+			devicePages: [][]inventory.Device{
+				fullPage,
+				{{ID: "last"}},
+			},
+			deviceDeployments: []*deployments.DeviceDeployment{{
+				ID:         "deployment",
+				Deployment: &deployments.Deployment{Id: "d1"},
+				Device:     &deployments.Device{},
+			}},
+			bulkIndexDeplsCalled: true,
+		},
+		"ok, no devices nor deployments": {
+			devicePages: [][]inventory.Device{{}},
+		},
+		"ko, failed to list the devices": {
+			listDevicesErr: errors.New("abc"),
+			err:            errors.New("failed to list the devices from inventory: abc"),
+		},
+		"ko, failed to index the devices": {
+			devicePages: [][]inventory.Device{
+				{{ID: "1"}, {ID: "2"}},
+			},
+			bulkIndexDevicesErr: errors.New("abc"),
+			err:                 errors.New("failed to reindex 2 devices"),
+		},
+		"ko, failed to list the device deployments": {
+			devicePages:        [][]inventory.Device{{}},
+			listDeploymentsErr: errors.New("abc"),
+			err: errors.New(
+				"failed to list the device deployments from deployments: abc"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			store := &store_mocks.Store{}
+			defer store.AssertExpectations(t)
+
+			invClient := &inventory_mocks.Client{}
+			defer invClient.AssertExpectations(t)
+
+			devClient := &deviceauth_mocks.Client{}
+			defer devClient.AssertExpectations(t)
+
+			deplClient := &deployments_mocks.Client{}
+			defer deplClient.AssertExpectations(t)
+
+			ds := &store_mocks.DataStore{}
+			ds.On("UpdateAndGetMapping", ctx, tenantID, mock.Anything).
+				Return(&model.Mapping{TenantID: tenantID}, nil)
+
+			if tc.listDevicesErr != nil {
+				invClient.On("ListDevices", ctx, tenantID, 1, reindexPageSize).
+					Return(nil, tc.listDevicesErr)
+			}
+			for i, page := range tc.devicePages {
+				page := page
+				invClient.On("ListDevices", ctx, tenantID, i+1, reindexPageSize).
+					Return(page, nil)
+				if len(page) == 0 {
+					continue
+				}
+				devices := make(map[string]deviceauth.DeviceAuthDevice, len(page))
+				for _, d := range page {
+					devices[string(d.ID)] = deviceauth.DeviceAuthDevice{ID: string(d.ID)}
+				}
+				devClient.On("GetDevices", ctx, tenantID,
+					mock.AnythingOfType("[]string")).
+					Return(devices, nil).Once()
+				invClient.On("GetDevices", ctx, tenantID,
+					mock.AnythingOfType("[]string")).
+					Return(page, nil).Once()
+				deplClient.On("GetLatestFinishedDeployment", ctx, tenantID,
+					mock.AnythingOfType("[]string")).
+					Return(nil, nil).Once()
+				store.On("BulkIndexDevices", ctx,
+					mock.MatchedBy(func(devices []*model.Device) bool {
+						return len(devices) == len(page)
+					}),
+					[]*model.Device{},
+				).Return(nil, tc.bulkIndexDevicesErr).Once()
+			}
+			if tc.listDevicesErr == nil && tc.bulkIndexDevicesErr == nil {
+				deplClient.On("ListDeviceDeployments", ctx, tenantID, 1, reindexPageSize).
+					Return(tc.deviceDeployments, tc.listDeploymentsErr)
+			}
+			if tc.bulkIndexDeplsCalled {
+				deplClient.On("ListDeployments", ctx, tenantID, []string{"d1"}).
+					Return([]*deployments.Deployment{{Id: "d1"}}, nil)
+				store.On("BulkIndexDeploymentSummaries", ctx,
+					mock.AnythingOfType("[]*model.DeploymentSummary")).
+					Return(nil)
+				store.On("BulkIndexDeployments", ctx,
+					mock.AnythingOfType("[]*model.Deployment")).
+					Return(nil)
+			}
+
+			indexer := NewIndexer(store, ds, nil, devClient, invClient, deplClient)
+			err := indexer.ReindexTenant(ctx, tenantID)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestReindexAll(t *testing.T) {
+	testCases := map[string]struct {
+		tenantIDs    []string
+		tenantIDsErr error
+
+		err error
+	}{
+		"ok": {
+			tenantIDs: []string{"t1", "t2"},
+		},
+		"ko, failed to get the tenants": {
+			tenantIDsErr: errors.New("abc"),
+			err:          errors.New("abc"),
+		},
+		"ko, no tenants": {
+			tenantIDs: []string{},
+			err:       ErrNoTenants,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			ds := &store_mocks.DataStore{}
+			defer ds.AssertExpectations(t)
+			ds.On("GetTenantIDs", ctx).Return(tc.tenantIDs, tc.tenantIDsErr)
+
+			invClient := &inventory_mocks.Client{}
+			defer invClient.AssertExpectations(t)
+
+			deplClient := &deployments_mocks.Client{}
+			defer deplClient.AssertExpectations(t)
+
+			for _, tenantID := range tc.tenantIDs {
+				invClient.On("ListDevices", ctx, tenantID, 1, reindexPageSize).
+					Return(nil, nil)
+				deplClient.On("ListDeviceDeployments", ctx, tenantID, 1, reindexPageSize).
+					Return(nil, nil)
+			}
+
+			indexer := NewIndexer(nil, ds, nil, nil, invClient, deplClient)
+			err := indexer.ReindexAll(ctx)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
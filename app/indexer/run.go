@@ -20,7 +20,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"strconv"
+	"sync"
 	"time"
 
 	"golang.org/x/sys/unix"
@@ -28,11 +28,9 @@ import (
 	"github.com/mendersoftware/go-lib-micro/config"
 	"github.com/mendersoftware/go-lib-micro/log"
 
-	"github.com/mendersoftware/reporting/client/deployments"
-	"github.com/mendersoftware/reporting/client/deviceauth"
-	"github.com/mendersoftware/reporting/client/inventory"
 	"github.com/mendersoftware/reporting/client/nats"
 	rconfig "github.com/mendersoftware/reporting/config"
+	"github.com/mendersoftware/reporting/metrics"
 	"github.com/mendersoftware/reporting/model"
 	"github.com/mendersoftware/reporting/store"
 )
@@ -40,6 +38,9 @@ import (
 const (
 	jobsChanSize    = 1000
 	shutdownTimeout = time.Second * 30
+	// maxBatchesPerWorker is the maximum number of batches sent to a
+	// worker and not yet processed
+	maxBatchesPerWorker = 2
 )
 
 // InitAndRun initializes the indexer and runs it
@@ -48,20 +49,17 @@ func InitAndRun(conf config.Reader, store store.Store, ds store.DataStore, nats
 	defer cancel()
 	l := log.FromContext(ctx)
 
-	invClient := inventory.NewClient(
-		conf.GetString(rconfig.SettingInventoryAddr),
-	)
-
-	devClient := deviceauth.NewClient(
-		conf.GetString(rconfig.SettingDeviceAuthAddr),
-	)
-
-	deplClient := deployments.NewClient(
-		conf.GetString(rconfig.SettingDeploymentsAddr),
-	)
-
-	indexer := NewIndexer(store, ds, nats, devClient, invClient, deplClient)
-	jobs := make(chan model.Job, jobsChanSize)
+	indexer := NewIndexerFromConfig(conf, store, ds, nats)
+	if addr := conf.GetString(rconfig.SettingIndexerListen); addr != "" {
+		listenAndServe(ctx, addr, newHTTPHandler(indexer))
+	}
+	// each lane receives its jobs from its own NATS consumer, which bounds
+	// the jobs held by the lane to nats.MaxAckPending independently of the
+	// other lanes
+	jobs := make([]chan model.Job, len(lanesSettings))
+	for i := range jobs {
+		jobs[i] = make(chan model.Job, jobsChanSize)
+	}
 
 	err := indexer.GetJobs(ctx, jobs)
 	if err != nil {
@@ -71,71 +69,145 @@ func InitAndRun(conf config.Reader, store store.Store, ds store.DataStore, nats
 	intChan := make(chan os.Signal, 1)
 	signal.Notify(intChan, unix.SIGINT, unix.SIGTERM)
 
-	batchSize := conf.GetInt(rconfig.SettingReindexBatchSize)
-	if batchSize <= 0 {
+	window, err := debounceWindow(conf)
+	if err != nil {
+		return err
+	}
+	tenantQuantum := conf.GetInt(rconfig.SettingReindexTenantQuantum)
+	if tenantQuantum <= 0 {
 		return fmt.Errorf(
 			"%s: must be a positive integer",
-			rconfig.SettingReindexBatchSize,
+			rconfig.SettingReindexTenantQuantum,
 		)
 	}
-	workerConcurrency := conf.GetInt(rconfig.SettingWorkerConcurrency)
-	if workerConcurrency <= 0 {
+	tenantMaxInFlight := conf.GetInt(rconfig.SettingReindexTenantMaxInFlight)
+	if tenantMaxInFlight < 0 {
 		return fmt.Errorf(
-			"%s: must be a positive integer",
-			rconfig.SettingWorkerConcurrency,
+			"%s: must be a non-negative integer",
+			rconfig.SettingReindexTenantMaxInFlight,
 		)
 	}
-	dispatch := make(chan []model.Job)
-	jobPool := make(chan []model.Job, workerConcurrency)
-	for i := 0; i < workerConcurrency; i++ {
-		jobPool <- make([]model.Job, 0, batchSize)
-		go workerRoutine(ctx, strconv.Itoa(i+1), indexer, dispatch, jobPool)
+	lanes := make([]*lane, len(lanesSettings))
+	workerConcurrency := 0
+	for i := range lanes {
+		lanes[i], err = newLaneFromConfig(conf, i, tenantQuantum, tenantMaxInFlight)
+		if err != nil {
+			return err
+		}
+		workerConcurrency += len(lanes[i].queues)
+	}
+	processed := make(chan processedJobs, workerConcurrency*maxBatchesPerWorker)
+	var workers sync.WaitGroup
+	metrics.Workers.Set(float64(workerConcurrency))
+	for _, lane := range lanes {
+		lane.start(ctx, indexer, processed, &workers)
+	}
+	queued := func() (n int) {
+		for _, lane := range lanes {
+			n += lane.sched.Total()
+		}
+		return n
+	}
+	enqueue := func(jobs ...model.Job) {
+		for _, job := range jobs {
+			lanes[jobLane(&job)].Push(job)
+		}
+	}
+	release := func(p processedJobs) {
+		lanes[p.lane].Release(p)
+	}
+
+	// repeated jobs for the same entity are held by the debouncer for
+	// the debounce window, and released together
+	var debounce *debouncer
+	debounceTimer := time.NewTimer(time.Hour)
+	debounceTimer.Stop()
+	debounceArmed := false
+	if window > 0 {
+		debounce = newDebouncer(window)
+	}
+	armDebounce := func() {
+		if next, ok := debounce.Next(); ok && !debounceArmed {
+			debounceTimer.Reset(time.Until(next))
+			debounceArmed = true
+		}
+	}
+
+	receive := func(job model.Job) {
+		metrics.JobsReceived.WithLabelValues(job.Action, job.TenantID).Inc()
+		if debounce != nil {
+			debounce.Add(job, time.Now())
+			armDebounce()
+		} else {
+			enqueue(job)
+		}
 	}
 
-	maxTimeMs := conf.GetInt(rconfig.SettingReindexMaxTimeMsec)
-	tickerTimeout := time.Duration(maxTimeMs) * time.Millisecond
-	ticker := time.NewTimer(tickerTimeout)
-	jobsList := <-jobPool
 	done := ctx.Done()
 	for err == nil {
 		select {
 		case sig := <-intChan:
-			var workersDone int
 			l.Warnf("Received signal %s: waiting for workers to finish", sig)
-			if len(jobsList) > 0 {
-				_, err = dispatchJobs(ctx, jobsList, dispatch, jobPool)
-				if err != nil {
-					break
-				}
-				workersDone++
+			if debounce != nil {
+				enqueue(debounce.Flush()...)
 			}
-			close(dispatch)
 			timeout := time.After(shutdownTimeout)
-			for workersDone < workerConcurrency {
+			for queued() > 0 {
+				for _, lane := range lanes {
+					lane.DispatchAll()
+				}
+				if queued() == 0 {
+					break
+				}
 				select {
+				case p := <-processed:
+					release(p)
 				case <-timeout:
 					return errors.New("timeout waiting for workers to finish")
-				case <-jobPool:
-					workersDone++
 				}
 			}
+			for _, lane := range lanes {
+				lane.Close()
+			}
+			workersDone := make(chan struct{})
+			go func() {
+				workers.Wait()
+				close(workersDone)
+			}()
+			select {
+			case <-timeout:
+				return errors.New("timeout waiting for workers to finish")
+			case <-workersDone:
+			}
 			l.Info("workers finished processing jobs: terminating")
 			return nil
-		case <-ticker.C:
-			ticker.Reset(tickerTimeout)
-			if len(jobsList) > 0 {
-				jobsList, err = dispatchJobs(ctx, jobsList, dispatch, jobPool)
-			}
+		case <-lanes[laneDevices].ticker.C:
+			lanes[laneDevices].ticker.Reset(lanes[laneDevices].maxWait)
+			lanes[laneDevices].DispatchAll()
+
+		case <-lanes[laneDeployments].ticker.C:
+			lanes[laneDeployments].ticker.Reset(lanes[laneDeployments].maxWait)
+			lanes[laneDeployments].DispatchAll()
 
-		case job, open := <-jobs:
+		case p := <-processed:
+			release(p)
+
+		case job, open := <-jobs[laneDevices]:
 			if !open {
 				return errors.New("Jetstream closed")
 			}
-			jobsList = append(jobsList, job)
-			if len(jobsList) >= cap(jobsList) {
-				ticker.Reset(tickerTimeout)
-				jobsList, err = dispatchJobs(ctx, jobsList, dispatch, jobPool)
+			receive(job)
+
+		case job, open := <-jobs[laneDeployments]:
+			if !open {
+				return errors.New("Jetstream closed")
 			}
+			receive(job)
+
+		case <-debounceTimer.C:
+			debounceArmed = false
+			enqueue(debounce.Release(time.Now())...)
+			armDebounce()
 
 		case <-done:
 			err = ctx.Err()
@@ -143,39 +215,3 @@ func InitAndRun(conf config.Reader, store store.Store, ds store.DataStore, nats
 	}
 	return err
 }
-
-func dispatchJobs(ctx context.Context,
-	jobs []model.Job,
-	dispatch chan<- []model.Job,
-	jobPool <-chan []model.Job,
-) (next []model.Job, err error) {
-	done := ctx.Done()
-	select {
-	case <-done:
-		return nil, ctx.Err()
-	case dispatch <- jobs:
-	}
-	select {
-	case <-done:
-		return nil, ctx.Err()
-	case next = <-jobPool:
-	}
-	return next[:0], nil
-}
-
-func workerRoutine(
-	ctx context.Context,
-	workerName string,
-	indexer Indexer,
-	jobQ <-chan []model.Job,
-	jobPool chan<- []model.Job) {
-	l := log.FromContext(ctx)
-	l.Data["worker"] = workerName
-	l.Infof("Worker %s waiting for jobs", workerName)
-	ctx = log.WithContext(ctx, l)
-	for jobs := range jobQ {
-		l.Infof("processing %d jobs", len(jobs))
-		indexer.ProcessJobs(ctx, jobs)
-		jobPool <- jobs
-	}
-}
@@ -0,0 +1,192 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"sort"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+// tenantQueue holds the jobs received for a tenant, in order
+type tenantQueue struct {
+	tenantID string
+	jobs     []model.Job
+	deficit  int
+}
+
+// partitionQueue holds the jobs of a worker partition in per-tenant queues;
+// ring holds the tenants with queued jobs, in round-robin order
+type partitionQueue struct {
+	tenants map[string]*tenantQueue
+	ring    []*tenantQueue
+	cursor  int
+	len     int
+}
+
+func (q *partitionQueue) advance() {
+	q.cursor++
+	if q.cursor >= len(q.ring) {
+		q.cursor = 0
+	}
+}
+
+func (q *partitionQueue) removeCurrent() {
+	delete(q.tenants, q.ring[q.cursor].tenantID)
+	q.ring = append(q.ring[:q.cursor], q.ring[q.cursor+1:]...)
+	if q.cursor >= len(q.ring) {
+		q.cursor = 0
+	}
+}
+
+// scheduler holds the jobs waiting for a worker in per-tenant queues, and
+// serves the tenants with deficit round-robin, so that a tenant reindexing
+// many devices does not starve the others; it is not safe for concurrent use
+type scheduler struct {
+	// quantum is the number of jobs a tenant is served per round
+	quantum int
+	// maxInFlight is the maximum number of jobs per tenant dispatched to
+	// the workers and not yet processed (0 means unlimited)
+	maxInFlight int
+	inFlight    map[string]int
+	// blocked holds, per tenant, the partitions whose jobs were skipped
+	// because of the in-flight limit
+	blocked    map[string]map[int]bool
+	partitions []*partitionQueue
+	len        int
+}
+
+func newScheduler(partitions, quantum, maxInFlight int) *scheduler {
+	s := &scheduler{
+		quantum:     quantum,
+		maxInFlight: maxInFlight,
+		inFlight:    make(map[string]int),
+		blocked:     make(map[string]map[int]bool),
+		partitions:  make([]*partitionQueue, partitions),
+	}
+	for i := range s.partitions {
+		s.partitions[i] = &partitionQueue{
+			tenants: make(map[string]*tenantQueue),
+		}
+	}
+	return s
+}
+
+// Push queues the job in its partition and returns the partition index
+func (s *scheduler) Push(job model.Job) int {
+	i := jobPartition(&job, len(s.partitions))
+	q := s.partitions[i]
+	t, ok := q.tenants[job.TenantID]
+	if !ok {
+		t = &tenantQueue{tenantID: job.TenantID}
+		q.tenants[job.TenantID] = t
+		q.ring = append(q.ring, t)
+	}
+	t.jobs = append(t.jobs, job)
+	q.len++
+	s.len++
+	return i
+}
+
+// Len returns the number of jobs queued in the partition
+func (s *scheduler) Len(partition int) int {
+	return s.partitions[partition].len
+}
+
+// Total returns the number of jobs queued in all the partitions
+func (s *scheduler) Total() int {
+	return s.len
+}
+
+// Next dequeues up to n jobs from the partition, taking at most quantum
+// jobs from each tenant in turn; the tenants which reached the in-flight
+// limit are skipped until their jobs are released with Done
+func (s *scheduler) Next(partition, n int) []model.Job {
+	q := s.partitions[partition]
+	var batch []model.Job
+	// idle counts the tenants visited in a row without dequeuing any job
+	idle := 0
+	for len(batch) < n && len(q.ring) > 0 && idle < len(q.ring) {
+		t := q.ring[q.cursor]
+		if t.deficit == 0 {
+			t.deficit = s.quantum
+		}
+		take := minInt(n-len(batch), minInt(t.deficit, len(t.jobs)))
+		if s.maxInFlight > 0 {
+			room := s.maxInFlight - s.inFlight[t.tenantID]
+			if room <= 0 {
+				s.block(t.tenantID, partition)
+			}
+			take = minInt(take, room)
+		}
+		if take <= 0 {
+			idle++
+			q.advance()
+			continue
+		}
+		idle = 0
+		batch = append(batch, t.jobs[:take]...)
+		t.jobs = t.jobs[take:]
+		t.deficit -= take
+		s.inFlight[t.tenantID] += take
+		q.len -= take
+		s.len -= take
+		if len(t.jobs) == 0 {
+			q.removeCurrent()
+		} else if t.deficit == 0 {
+			q.advance()
+		}
+	}
+	return batch
+}
+
+func (s *scheduler) block(tenantID string, partition int) {
+	partitions, ok := s.blocked[tenantID]
+	if !ok {
+		partitions = make(map[int]bool)
+		s.blocked[tenantID] = partitions
+	}
+	partitions[partition] = true
+}
+
+// Done releases the in-flight jobs returned by Next once processed, and
+// returns the partitions holding jobs of the released tenants which were
+// skipped because of the in-flight limit, in order
+func (s *scheduler) Done(jobs []model.Job) []int {
+	partitions := make(map[int]bool)
+	for _, job := range jobs {
+		s.inFlight[job.TenantID]--
+		if s.inFlight[job.TenantID] <= 0 {
+			delete(s.inFlight, job.TenantID)
+		}
+		for partition := range s.blocked[job.TenantID] {
+			partitions[partition] = true
+		}
+		delete(s.blocked, job.TenantID)
+	}
+	unblocked := make([]int, 0, len(partitions))
+	for partition := range partitions {
+		unblocked = append(unblocked, partition)
+	}
+	sort.Ints(unblocked)
+	return unblocked
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
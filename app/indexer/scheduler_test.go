@@ -0,0 +1,144 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestScheduler(t *testing.T) {
+	type step struct {
+		// release the jobs dequeued so far before calling Next
+		release bool
+		n       int
+		jobs    []string
+	}
+	testCases := map[string]struct {
+		quantum     int
+		maxInFlight int
+		jobs        []model.Job
+		steps       []step
+	}{
+		"ok, round-robin across the tenants": {
+			quantum: 2,
+			jobs: []model.Job{
+				{TenantID: "t1", DeviceID: "d1", RequestID: "1"},
+				{TenantID: "t1", DeviceID: "d2", RequestID: "2"},
+				{TenantID: "t1", DeviceID: "d3", RequestID: "3"},
+				{TenantID: "t1", DeviceID: "d4", RequestID: "4"},
+				{TenantID: "t1", DeviceID: "d5", RequestID: "5"},
+				{TenantID: "t2", DeviceID: "d1", RequestID: "6"},
+				{TenantID: "t3", DeviceID: "d1", RequestID: "7"},
+			},
+			steps: []step{
+				{n: 4, jobs: []string{"1", "2", "6", "7"}},
+				{n: 4, jobs: []string{"3", "4", "5"}},
+				{n: 4},
+			},
+		},
+		"ok, the deficit carries over to the next batch": {
+			quantum: 3,
+			jobs: []model.Job{
+				{TenantID: "t1", DeviceID: "d1", RequestID: "1"},
+				{TenantID: "t1", DeviceID: "d2", RequestID: "2"},
+				{TenantID: "t1", DeviceID: "d3", RequestID: "3"},
+				{TenantID: "t1", DeviceID: "d4", RequestID: "4"},
+				{TenantID: "t2", DeviceID: "d1", RequestID: "5"},
+				{TenantID: "t2", DeviceID: "d2", RequestID: "6"},
+			},
+			steps: []step{
+				{n: 2, jobs: []string{"1", "2"}},
+				{n: 2, jobs: []string{"3", "5"}},
+				{n: 2, jobs: []string{"6", "4"}},
+			},
+		},
+		"ok, in-flight limit": {
+			quantum:     10,
+			maxInFlight: 2,
+			jobs: []model.Job{
+				{TenantID: "t1", DeviceID: "d1", RequestID: "1"},
+				{TenantID: "t1", DeviceID: "d2", RequestID: "2"},
+				{TenantID: "t1", DeviceID: "d3", RequestID: "3"},
+				{TenantID: "t1", DeviceID: "d4", RequestID: "4"},
+				{TenantID: "t2", DeviceID: "d1", RequestID: "5"},
+			},
+			steps: []step{
+				{n: 10, jobs: []string{"1", "2", "5"}},
+				{n: 10},
+				{release: true, n: 10, jobs: []string{"3", "4"}},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			s := newScheduler(1, tc.quantum, tc.maxInFlight)
+			for _, job := range tc.jobs {
+				assert.Equal(t, 0, s.Push(job))
+			}
+			assert.Equal(t, len(tc.jobs), s.Total())
+
+			var dequeued []model.Job
+			for _, step := range tc.steps {
+				if step.release {
+					s.Done(dequeued)
+					dequeued = nil
+				}
+				batch := s.Next(0, step.n)
+				dequeued = append(dequeued, batch...)
+				ids := []string{}
+				for _, job := range batch {
+					ids = append(ids, job.RequestID)
+				}
+				if step.jobs == nil {
+					step.jobs = []string{}
+				}
+				assert.Equal(t, step.jobs, ids)
+			}
+		})
+	}
+}
+
+func TestSchedulerPartitions(t *testing.T) {
+	s := newScheduler(4, 10, 0)
+	jobs := []model.Job{
+		{TenantID: "t1", DeviceID: "d1", RequestID: "1"},
+		{TenantID: "t1", DeviceID: "d2", RequestID: "2"},
+		{TenantID: "t2", DeviceID: "d1", RequestID: "3"},
+		{TenantID: "t1", DeviceID: "d1", RequestID: "4"},
+	}
+	partitions := make([]int, len(jobs))
+	for i, job := range jobs {
+		partitions[i] = s.Push(job)
+		assert.Equal(t, jobPartition(&job, 4), partitions[i])
+	}
+	assert.Equal(t, partitions[0], partitions[3])
+	assert.Equal(t, len(jobs), s.Total())
+
+	total := 0
+	for i := 0; i < 4; i++ {
+		batch := s.Next(i, 10)
+		assert.Equal(t, 0, s.Len(i))
+		total += len(batch)
+		s.Done(batch)
+	}
+	assert.Equal(t, len(jobs), total)
+	assert.Equal(t, 0, s.Total())
+	assert.Empty(t, s.inFlight)
+}
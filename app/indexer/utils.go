@@ -14,7 +14,11 @@
 
 package indexer
 
-import "github.com/mendersoftware/reporting/model"
+import (
+	"hash/fnv"
+
+	"github.com/mendersoftware/reporting/model"
+)
 
 func groupJobsIntoTenantActionIDs(jobs []model.Job) TenantActionIDs {
 	tenantsActionIDs := make(TenantActionIDs)
@@ -22,18 +26,44 @@ func groupJobsIntoTenantActionIDs(jobs []model.Job) TenantActionIDs {
 		if _, ok := tenantsActionIDs[job.TenantID]; !ok {
 			tenantsActionIDs[job.TenantID] = make(ActionIDs)
 		}
-		if _, ok := tenantsActionIDs[job.TenantID][job.Action]; !ok {
-			tenantsActionIDs[job.TenantID][job.Action] = make(IDs)
-		}
-		var ID string
-		if job.Action == model.ActionReindex {
-			ID = job.DeviceID
-		} else if job.Action == model.ActionReindexDeployment {
-			ID = job.ID
+		action := jobIndexAction(&job)
+		if _, ok := tenantsActionIDs[job.TenantID][action]; !ok {
+			tenantsActionIDs[job.TenantID][action] = make(IDs)
 		}
-		if _, ok := tenantsActionIDs[job.TenantID][job.Action][ID]; !ok {
-			tenantsActionIDs[job.TenantID][job.Action][ID] = true
+		ID := jobDocumentID(&job)
+		if _, ok := tenantsActionIDs[job.TenantID][action][ID]; !ok {
+			tenantsActionIDs[job.TenantID][action][ID] = true
 		}
 	}
 	return tenantsActionIDs
 }
+
+// jobIndexAction returns the action which indexes the document of the
+// job; connectivity changes reindex the whole device
+func jobIndexAction(job *model.Job) string {
+	if job.Action == model.ActionReindexConnectivity {
+		return model.ActionReindex
+	}
+	return job.Action
+}
+
+// jobDocumentID returns the ID of the document indexed by the job
+func jobDocumentID(job *model.Job) string {
+	action := jobIndexAction(job)
+	if action == model.ActionReindex {
+		return job.DeviceID
+	} else if action == model.ActionReindexDeployment {
+		return job.ID
+	}
+	return ""
+}
+
+// jobPartition returns the partition, out of n, the job belongs to; jobs
+// indexing the same document always belong to the same partition
+func jobPartition(job *model.Job, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(job.TenantID))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(jobDocumentID(job)))
+	return int(h.Sum32() % uint32(n))
+}
@@ -41,6 +41,12 @@ func TestGroupJobsIntoTenantActionIDs(t *testing.T) {
 			DeviceID: "d2",
 			Service:  model.ServiceInventory,
 		},
+		{
+			Action:   model.ActionReindexConnectivity,
+			TenantID: "t1",
+			DeviceID: "d3",
+			Service:  model.ServiceDeviceconnect,
+		},
 		{
 			Action:   model.ActionReindex,
 			TenantID: "t2",
@@ -67,6 +73,7 @@ func TestGroupJobsIntoTenantActionIDs(t *testing.T) {
 			model.ActionReindex: {
 				"d1": true,
 				"d2": true,
+				"d3": true,
 			},
 		},
 		"t2": ActionIDs{
@@ -82,3 +89,43 @@ func TestGroupJobsIntoTenantActionIDs(t *testing.T) {
 
 	assert.Equal(t, expected, tenantActionIDs)
 }
+
+func TestJobPartition(t *testing.T) {
+	const partitions = 8
+
+	jobs := []model.Job{
+		{Action: model.ActionReindex, TenantID: "t1", DeviceID: "d1"},
+		{Action: model.ActionReindex, TenantID: "t1", DeviceID: "d2"},
+		{Action: model.ActionReindex, TenantID: "t2", DeviceID: "d1"},
+		{Action: model.ActionReindexDeployment, TenantID: "t1", ID: "d1"},
+	}
+	for _, job := range jobs {
+		partition := jobPartition(&job, partitions)
+		assert.GreaterOrEqual(t, partition, 0)
+		assert.Less(t, partition, partitions)
+
+		// jobs for the same document always land in the same partition
+		same := model.Job{
+			Action:    job.Action,
+			TenantID:  job.TenantID,
+			DeviceID:  job.DeviceID,
+			ID:        job.ID,
+			Service:   model.ServiceDeviceauth,
+			RequestID: "another request",
+		}
+		assert.Equal(t, partition, jobPartition(&same, partitions))
+	}
+
+	// connectivity changes index the same document as the device reindex
+	connectivity := model.Job{
+		Action:   model.ActionReindexConnectivity,
+		TenantID: "t1",
+		DeviceID: "d1",
+	}
+	assert.Equal(t,
+		jobPartition(&jobs[0], partitions),
+		jobPartition(&connectivity, partitions),
+	)
+
+	assert.Equal(t, 0, jobPartition(&jobs[0], 1))
+}
@@ -0,0 +1,513 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/reporting/client/deployments"
+	"github.com/mendersoftware/reporting/client/nats"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// verifyPageSize is the number of documents compared together when
+// verifying a tenant
+const verifyPageSize = 100
+
+const fieldDeviceDeleted = "device_deleted"
+
+// the document fields compared with the source services
+var (
+	verifyDeviceFields = []string{
+		model.ToAttr(model.ScopeIdentity, model.AttrNameStatus, model.TypeStr),
+		model.ToAttr(model.ScopeSystem, model.AttrNameGroup, model.TypeStr),
+		model.ToAttr(model.ScopeSystem, model.AttrNameUpdatedAt, model.TypeStr),
+		model.FieldNameCheckIn,
+	}
+	verifyDeploymentFields = []string{
+		model.FieldNameDeviceID,
+		model.FieldNameDeploymentID,
+		fieldDeviceStatus,
+		fieldDeviceFinished,
+		fieldDeviceDeleted,
+	}
+)
+
+// VerifyTenant compares the devices and device deployments indexed for the
+// tenant with the source services, and returns the drift report; with a
+// positive sample, it compares a random sample of the indexed documents
+// rather than scanning the source services, which does not find the
+// missing documents
+func (i *indexer) VerifyTenant(
+	ctx context.Context,
+	tenantID string,
+	sample int,
+) (*model.DriftReport, error) {
+	l := log.FromContext(ctx)
+	l.Infof("verifying tenant %q", tenantID)
+	report := &model.DriftReport{
+		TenantID: tenantID,
+		Sample:   sample,
+	}
+	var err error
+	if sample > 0 {
+		err = i.verifyDevicesSample(ctx, tenantID, sample, &report.Devices)
+		if err == nil {
+			err = i.verifyDeploymentsSample(ctx, tenantID, sample, &report.Deployments)
+		}
+	} else {
+		err = i.verifyAllDevices(ctx, tenantID, &report.Devices)
+		if err == nil {
+			err = i.verifyAllDeployments(ctx, tenantID, &report.Deployments)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.Infof("verified %d devices and %d device deployments for tenant %q",
+		report.Devices.Checked, report.Deployments.Checked, tenantID)
+	return report, nil
+}
+
+func (i *indexer) verifyAllDevices(
+	ctx context.Context,
+	tenantID string,
+	drift *model.EntityDrift,
+) error {
+	seen := make(map[string]bool)
+	for page := 1; ; page++ {
+		devices, err := i.invClient.ListDevices(ctx, tenantID, page, verifyPageSize)
+		if err != nil {
+			return errors.Wrap(err, "failed to list the devices from inventory")
+		}
+		ids := make([]string, 0, len(devices))
+		for _, device := range devices {
+			if !seen[string(device.ID)] {
+				seen[string(device.ID)] = true
+				ids = append(ids, string(device.ID))
+			}
+		}
+		if err := i.verifyDevices(ctx, tenantID, ids, drift); err != nil {
+			return err
+		}
+		if len(devices) < verifyPageSize {
+			break
+		}
+	}
+	return scanIndexedIDs(ctx, i.store.SearchDevices, tenantID, func(ids []string) error {
+		stale := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if !seen[id] {
+				stale = append(stale, id)
+			}
+		}
+		// the devices indexed after they were listed from inventory
+		// are compared again, rather than reported as stale
+		return i.verifyDevices(ctx, tenantID, stale, drift)
+	})
+}
+
+type searchFunc func(ctx context.Context, query model.Query) (model.M, error)
+
+// getIndexedDocuments searches the documents currently in the index, by ID;
+// the search is near-real-time, which is good enough to spot the drift
+func getIndexedDocuments(
+	ctx context.Context,
+	search searchFunc,
+	tenant string,
+	ids []string,
+) (map[string]map[string]interface{}, error) {
+	docs := make(map[string]map[string]interface{}, len(ids))
+	if len(ids) == 0 {
+		return docs, nil
+	}
+	query := model.NewQuery().
+		Must(model.M{
+			"term": model.M{model.FieldNameTenantID: tenant},
+		}).
+		Must(model.M{
+			"terms": model.M{model.FieldNameID: ids},
+		}).
+		WithSize(len(ids))
+
+	ctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenant})
+	res, err := search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	hits, _ := res["hits"].(map[string]interface{})
+	hitsS, _ := hits["hits"].([]interface{})
+	for _, hit := range hitsS {
+		hitM, _ := hit.(map[string]interface{})
+		source, _ := hitM["_source"].(map[string]interface{})
+		if id, _ := source[model.FieldNameID].(string); id != "" {
+			docs[id] = source
+		}
+	}
+	return docs, nil
+}
+
+func (i *indexer) verifyDevicesSample(
+	ctx context.Context,
+	tenantID string,
+	sample int,
+	drift *model.EntityDrift,
+) error {
+	ids, err := sampleIndexedIDs(ctx, i.store.SearchDevices, tenantID, sample)
+	if err != nil {
+		return errors.Wrap(err, "failed to sample the indexed devices")
+	}
+	for len(ids) > 0 {
+		n := minInt(len(ids), verifyPageSize)
+		if err := i.verifyDevices(ctx, tenantID, ids[:n], drift); err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+// verifyDevices compares the indexed devices with the documents built from
+// the source services
+func (i *indexer) verifyDevices(
+	ctx context.Context,
+	tenantID string,
+	ids []string,
+	drift *model.EntityDrift,
+) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+	devices, removedDevices, err := i.buildDevices(ctx, tenantID, ids, nil)
+	if err != nil {
+		return err
+	}
+	indexed, err := getIndexedDocuments(ctx, i.store.SearchDevices, tenantID, ids)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the indexed devices")
+	}
+	docs := make(map[string]interface{}, len(devices))
+	for _, device := range devices {
+		docs[device.GetID()] = device
+	}
+	removedIDs := make([]string, 0, len(removedDevices))
+	for _, device := range removedDevices {
+		removedIDs = append(removedIDs, device.GetID())
+	}
+	return compareDocuments(indexed, docs, removedIDs, verifyDeviceFields, drift)
+}
+
+func (i *indexer) verifyAllDeployments(
+	ctx context.Context,
+	tenantID string,
+	drift *model.EntityDrift,
+) error {
+	seen := make(map[string]bool)
+	for page := 1; ; page++ {
+		deviceDeployments, err := i.deplClient.ListDeviceDeployments(ctx, tenantID,
+			page, verifyPageSize)
+		if err != nil {
+			return errors.Wrap(err,
+				"failed to list the device deployments from deployments")
+		}
+		ids := make([]string, 0, len(deviceDeployments))
+		for _, d := range deviceDeployments {
+			seen[d.ID] = true
+			ids = append(ids, d.ID)
+		}
+		err = i.verifyDeployments(ctx, tenantID, ids, deviceDeployments, drift)
+		if err != nil {
+			return err
+		}
+		if len(deviceDeployments) < verifyPageSize {
+			break
+		}
+	}
+	return scanIndexedIDs(ctx, i.store.SearchDeployments, tenantID, func(ids []string) error {
+		stale := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if !seen[id] {
+				stale = append(stale, id)
+			}
+		}
+		return i.verifyDeploymentIDs(ctx, tenantID, stale, drift)
+	})
+}
+
+func (i *indexer) verifyDeploymentsSample(
+	ctx context.Context,
+	tenantID string,
+	sample int,
+	drift *model.EntityDrift,
+) error {
+	ids, err := sampleIndexedIDs(ctx, i.store.SearchDeployments, tenantID, sample)
+	if err != nil {
+		return errors.Wrap(err, "failed to sample the indexed deployments")
+	}
+	for len(ids) > 0 {
+		n := minInt(len(ids), verifyPageSize)
+		if err := i.verifyDeploymentIDs(ctx, tenantID, ids[:n], drift); err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+// verifyDeploymentIDs fetches the device deployments from the source
+// service and compares them with the indexed ones
+func (i *indexer) verifyDeploymentIDs(
+	ctx context.Context,
+	tenantID string,
+	ids []string,
+	drift *model.EntityDrift,
+) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	deviceDeployments, err := i.deplClient.GetDeployments(ctx, tenantID, ids)
+	if err != nil {
+		return errors.Wrap(err, "failed to get device deployments from device deployments")
+	}
+	return i.verifyDeployments(ctx, tenantID, ids, deviceDeployments, drift)
+}
+
+// verifyDeployments compares the indexed device deployments with the
+// documents built from the source service
+func (i *indexer) verifyDeployments(
+	ctx context.Context,
+	tenantID string,
+	ids []string,
+	deviceDeployments []*deployments.DeviceDeployment,
+	drift *model.EntityDrift,
+) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	indexed, err := getIndexedDocuments(ctx, i.store.SearchDeployments, tenantID, ids)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the indexed deployments")
+	}
+	docs := make(map[string]interface{}, len(deviceDeployments))
+	for _, d := range deviceDeployments {
+		if depl := i.processJobDeployment(ctx, tenantID, d); depl != nil {
+			docs[depl.ID] = depl
+		}
+	}
+	removedIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := docs[id]; !ok {
+			removedIDs = append(removedIDs, id)
+		}
+	}
+	return compareDocuments(indexed, docs, removedIDs, verifyDeploymentFields, drift)
+}
+
+// compareDocuments compares the given fields of the indexed documents with
+// the expected ones, and adds the differences to the drift
+func compareDocuments(
+	indexed map[string]map[string]interface{},
+	docs map[string]interface{},
+	removedIDs []string,
+	fields []string,
+	drift *model.EntityDrift,
+) error {
+	ids := make([]string, 0, len(docs))
+	for id := range docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		drift.Checked++
+		doc, ok := indexed[id]
+		if !ok {
+			drift.Missing = append(drift.Missing, id)
+			continue
+		}
+		expected, err := documentFields(docs[id])
+		if err != nil {
+			return err
+		}
+		changed := changedFields(selectFields(doc, fields), selectFields(expected, fields))
+		if len(changed) > 0 {
+			drift.Differing = append(drift.Differing, model.DocumentDrift{
+				ID:     id,
+				Fields: changed,
+			})
+		}
+	}
+	for _, id := range removedIDs {
+		drift.Checked++
+		if _, ok := indexed[id]; ok {
+			drift.Stale = append(drift.Stale, id)
+		}
+	}
+	return nil
+}
+
+func selectFields(doc map[string]interface{}, fields []string) map[string]interface{} {
+	res := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if value, ok := doc[field]; ok {
+			res[field] = value
+		}
+	}
+	return res
+}
+
+// hitIDs returns the IDs of the documents in the search result, and the
+// sort values of the last hit
+func hitIDs(res model.M) ([]string, []interface{}) {
+	hits, _ := res["hits"].(map[string]interface{})
+	hitsS, _ := hits["hits"].([]interface{})
+	ids := make([]string, 0, len(hitsS))
+	var sortValues []interface{}
+	for _, hit := range hitsS {
+		hitM, _ := hit.(map[string]interface{})
+		source, _ := hitM["_source"].(map[string]interface{})
+		if id, _ := source[model.FieldNameID].(string); id != "" {
+			ids = append(ids, id)
+		}
+		sortValues, _ = hitM["sort"].([]interface{})
+	}
+	return ids, sortValues
+}
+
+// scanIndexedIDs calls fn with the pages of the IDs of the documents
+// indexed for the tenant, in ascending order
+func scanIndexedIDs(
+	ctx context.Context,
+	search searchFunc,
+	tenant string,
+	fn func(ids []string) error,
+) error {
+	ctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenant})
+	var after []interface{}
+	for {
+		query := model.NewQuery().
+			Must(model.M{
+				"term": model.M{model.FieldNameTenantID: tenant},
+			}).
+			WithSort(model.M{model.FieldNameID: model.M{"order": "asc"}}).
+			WithSize(verifyPageSize).
+			With(model.M{"_source": []string{model.FieldNameID}})
+		if after != nil {
+			query = query.With(model.M{"search_after": after})
+		}
+		res, err := search(ctx, query)
+		if err != nil {
+			return errors.Wrap(err, "failed to scan the indexed documents")
+		}
+		var ids []string
+		ids, after = hitIDs(res)
+		if err := fn(ids); err != nil {
+			return err
+		}
+		if len(ids) < verifyPageSize || after == nil {
+			return nil
+		}
+	}
+}
+
+// sampleIndexedIDs returns the IDs of a random sample of the documents
+// indexed for the tenant
+func sampleIndexedIDs(
+	ctx context.Context,
+	search searchFunc,
+	tenant string,
+	sample int,
+) ([]string, error) {
+	ctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenant})
+	query := model.NewQuery().
+		WithSize(sample).
+		With(model.M{
+			"_source": []string{model.FieldNameID},
+			"query": model.M{
+				"function_score": model.M{
+					"query": model.M{
+						"term": model.M{model.FieldNameTenantID: tenant},
+					},
+					"random_score": model.M{},
+				},
+			},
+		})
+	res, err := search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	ids, _ := hitIDs(res)
+	return ids, nil
+}
+
+// RepairDrift publishes the reindex jobs for the entities in the drift
+// report to the jobs subject, and returns the number of published jobs;
+// the stale device deployments are not repaired, as reindexing does not
+// remove them
+func RepairDrift(
+	ctx context.Context,
+	nats nats.Client,
+	subject string,
+	report *model.DriftReport,
+) (int, error) {
+	var jobs []model.Job
+	devices := append(append([]string{}, report.Devices.Missing...),
+		report.Devices.Stale...)
+	for _, d := range report.Devices.Differing {
+		devices = append(devices, d.ID)
+	}
+	for _, id := range devices {
+		jobs = append(jobs, model.Job{
+			Action:   model.ActionReindex,
+			TenantID: report.TenantID,
+			DeviceID: id,
+		})
+	}
+	deployments := append([]string{}, report.Deployments.Missing...)
+	for _, d := range report.Deployments.Differing {
+		deployments = append(deployments, d.ID)
+	}
+	for _, id := range deployments {
+		jobs = append(jobs, model.Job{
+			Action:   model.ActionReindexDeployment,
+			TenantID: report.TenantID,
+			ID:       id,
+		})
+	}
+	published := 0
+	for _, job := range jobs {
+		data, err := json.Marshal(job)
+		if err != nil {
+			return published, err
+		}
+		err = nats.JetStreamPublish(subject, data)
+		if err != nil {
+			return published, errors.Wrapf(err,
+				"failed to publish the reindex job for %s", jobDocumentID(&job))
+		}
+		published++
+	}
+	log.FromContext(ctx).Infof("published %d reindex jobs for tenant %q",
+		published, report.TenantID)
+	return published, nil
+}
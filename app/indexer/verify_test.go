@@ -0,0 +1,263 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/client/deployments"
+	deployments_mocks "github.com/mendersoftware/reporting/client/deployments/mocks"
+	"github.com/mendersoftware/reporting/client/deviceauth"
+	deviceauth_mocks "github.com/mendersoftware/reporting/client/deviceauth/mocks"
+	"github.com/mendersoftware/reporting/client/inventory"
+	inventory_mocks "github.com/mendersoftware/reporting/client/inventory/mocks"
+	nats_mocks "github.com/mendersoftware/reporting/client/nats/mocks"
+	"github.com/mendersoftware/reporting/model"
+	store_mocks "github.com/mendersoftware/reporting/store/mocks"
+)
+
+// searchHits returns the search result with the documents, sorted by ID
+func searchHits(docs ...map[string]interface{}) model.M {
+	hits := make([]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		hits = append(hits, map[string]interface{}{
+			"_source": doc,
+			"sort":    []interface{}{doc[model.FieldNameID]},
+		})
+	}
+	return model.M{
+		"hits": map[string]interface{}{
+			"hits": hits,
+		},
+	}
+}
+
+func TestCompareDocuments(t *testing.T) {
+	fields := []string{"status", "group"}
+	testCases := map[string]struct {
+		indexed    map[string]map[string]interface{}
+		docs       map[string]interface{}
+		removedIDs []string
+
+		drift model.EntityDrift
+	}{
+		"ok, in sync": {
+			indexed: map[string]map[string]interface{}{
+				"1": {"id": "1", "status": "accepted", "other": "a"},
+			},
+			docs: map[string]interface{}{
+				"1": map[string]interface{}{"id": "1", "status": "accepted", "other": "b"},
+			},
+			removedIDs: []string{"2"},
+			drift:      model.EntityDrift{Checked: 2},
+		},
+		"ok, drift": {
+			indexed: map[string]map[string]interface{}{
+				"1": {"id": "1", "status": "accepted"},
+				"3": {"id": "3", "status": "accepted", "group": "g1"},
+			},
+			docs: map[string]interface{}{
+				"1": map[string]interface{}{"id": "1", "status": "rejected"},
+				"2": map[string]interface{}{"id": "2", "status": "accepted"},
+			},
+			removedIDs: []string{"3"},
+			drift: model.EntityDrift{
+				Checked: 3,
+				Missing: []string{"2"},
+				Stale:   []string{"3"},
+				Differing: []model.DocumentDrift{{
+					ID:     "1",
+					Fields: []string{"status"},
+				}},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var drift model.EntityDrift
+			err := compareDocuments(tc.indexed, tc.docs, tc.removedIDs, fields, &drift)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.drift, drift)
+			assert.Equal(t, len(tc.drift.Missing) == 0 &&
+				len(tc.drift.Stale) == 0 &&
+				len(tc.drift.Differing) == 0, drift.InSync())
+		})
+	}
+}
+
+func TestVerifyTenant(t *testing.T) {
+	const tenantID = "tenant"
+	ctx := context.Background()
+	anyCtx := mock.MatchedBy(func(context.Context) bool { return true })
+
+	store := &store_mocks.Store{}
+	defer store.AssertExpectations(t)
+
+	invClient := &inventory_mocks.Client{}
+	defer invClient.AssertExpectations(t)
+
+	devClient := &deviceauth_mocks.Client{}
+	defer devClient.AssertExpectations(t)
+
+	deplClient := &deployments_mocks.Client{}
+	defer deplClient.AssertExpectations(t)
+
+	ds := &store_mocks.DataStore{}
+	ds.On("UpdateAndGetMapping", ctx, tenantID, mock.Anything).
+		Return(&model.Mapping{TenantID: tenantID}, nil).Maybe()
+
+	// devices: 1 is in sync, 2 differs, 3 is not indexed and 4 is stale
+	page := []inventory.Device{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+	invClient.On("ListDevices", ctx, tenantID, 1, verifyPageSize).Return(page, nil)
+	invClient.On("GetDevices", ctx, tenantID, []string{"1", "2", "3"}).Return(page, nil)
+	devClient.On("GetDevices", ctx, tenantID, []string{"1", "2", "3"}).
+		Return(map[string]deviceauth.DeviceAuthDevice{
+			"1": {ID: "1", Status: "accepted"},
+			"2": {ID: "2", Status: "accepted"},
+			"3": {ID: "3", Status: "accepted"},
+		}, nil)
+	deplClient.On("GetLatestFinishedDeployment", ctx, tenantID, mock.AnythingOfType("[]string")).
+		Return(nil, nil)
+	device := func(id, status string) map[string]interface{} {
+		return map[string]interface{}{
+			"id":                  id,
+			"tenant_id":           tenantID,
+			"identity_status_str": []interface{}{status},
+		}
+	}
+	store.On("SearchDevices", anyCtx, mock.Anything).
+		Return(searchHits(device("1", "accepted"), device("2", "pending")), nil).Once()
+	store.On("SearchDevices", anyCtx, mock.Anything).
+		Return(searchHits(device("1", "accepted"), device("2", "pending"),
+			device("4", "accepted")), nil).Once()
+	invClient.On("GetDevices", ctx, tenantID, []string{"4"}).Return(nil, nil)
+	devClient.On("GetDevices", ctx, tenantID, []string{"4"}).
+		Return(map[string]deviceauth.DeviceAuthDevice{}, nil)
+	store.On("SearchDevices", anyCtx, mock.Anything).
+		Return(searchHits(device("4", "accepted")), nil).Once()
+
+	// deployments: d1 differs
+	deplClient.On("ListDeviceDeployments", ctx, tenantID, 1, verifyPageSize).
+		Return([]*deployments.DeviceDeployment{{
+			ID:         "dd1",
+			Deployment: &deployments.Deployment{Id: "d1"},
+			Device:     &deployments.Device{Id: "1", Status: "success"},
+		}}, nil)
+	deployment := map[string]interface{}{
+		"id":            "dd1",
+		"tenant_id":     tenantID,
+		"device_id":     "1",
+		"deployment_id": "d1",
+		"device_status": "failure",
+	}
+	store.On("SearchDeployments", anyCtx, mock.Anything).
+		Return(searchHits(deployment), nil).Twice()
+
+	indexer := NewIndexer(store, ds, nil, devClient, invClient, deplClient)
+	report, err := indexer.VerifyTenant(ctx, tenantID, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.DriftReport{
+		TenantID: tenantID,
+		Devices: model.EntityDrift{
+			Checked: 4,
+			Missing: []string{"3"},
+			Stale:   []string{"4"},
+			Differing: []model.DocumentDrift{{
+				ID:     "2",
+				Fields: []string{"identity_status_str"},
+			}},
+		},
+		Deployments: model.EntityDrift{
+			Checked: 1,
+			Differing: []model.DocumentDrift{{
+				ID:     "dd1",
+				Fields: []string{"device_status"},
+			}},
+		},
+	}, report)
+	assert.False(t, report.InSync())
+}
+
+func TestRepairDrift(t *testing.T) {
+	const subject = "WORKFLOWS.reporting"
+	report := &model.DriftReport{
+		TenantID: "tenant",
+		Devices: model.EntityDrift{
+			Missing:   []string{"1"},
+			Stale:     []string{"2"},
+			Differing: []model.DocumentDrift{{ID: "3"}},
+		},
+		Deployments: model.EntityDrift{
+			Missing:   []string{"dd1"},
+			Stale:     []string{"dd2"},
+			Differing: []model.DocumentDrift{{ID: "dd3"}},
+		},
+	}
+	testCases := map[string]struct {
+		publishErr error
+
+		published int
+		err       error
+	}{
+		"ok": {
+			published: 5,
+		},
+		"ko, failed to publish": {
+			publishErr: errors.New("nats error"),
+			err:        errors.New("failed to publish the reindex job for 1: nats error"),
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var jobs []model.Job
+			nats := &nats_mocks.Client{}
+			defer nats.AssertExpectations(t)
+			call := nats.On("JetStreamPublish", subject, mock.AnythingOfType("[]uint8")).
+				Run(func(args mock.Arguments) {
+					var job model.Job
+					err := json.Unmarshal(args.Get(1).([]byte), &job)
+					assert.NoError(t, err)
+					jobs = append(jobs, job)
+				}).
+				Return(tc.publishErr)
+			if tc.publishErr != nil {
+				call.Once()
+			}
+
+			published, err := RepairDrift(context.Background(), nats, subject, report)
+			assert.Equal(t, tc.published, published)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []model.Job{
+				{Action: model.ActionReindex, TenantID: "tenant", DeviceID: "1"},
+				{Action: model.ActionReindex, TenantID: "tenant", DeviceID: "2"},
+				{Action: model.ActionReindex, TenantID: "tenant", DeviceID: "3"},
+				{Action: model.ActionReindexDeployment, TenantID: "tenant", ID: "dd1"},
+				{Action: model.ActionReindexDeployment, TenantID: "tenant", ID: "dd3"},
+			}, jobs)
+		})
+	}
+}
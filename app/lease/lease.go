@@ -0,0 +1,101 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package lease runs the tasks which must not run concurrently in several
+// processes, like the migrations, holding a lease in the data store
+package lease
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/reporting/store"
+)
+
+// Owner returns the name identifying this process as the owner of leases
+func Owner() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d/%d", hostname, os.Getpid(), time.Now().UnixNano())
+}
+
+// Run waits for the named lease, and runs the task while holding it; the
+// lease is renewed every third of the time to live, and the task is
+// canceled if a renewal fails, so that it never runs without the lease.
+// A process dying with the lease lets the others acquire it once expired.
+func Run(ctx context.Context, ds store.DataStore, name string, ttl time.Duration,
+	task func(ctx context.Context) error) error {
+	l := log.FromContext(ctx)
+	owner := Owner()
+	for {
+		acquired, err := ds.AcquireLease(ctx, name, owner, ttl)
+		if err != nil {
+			return err
+		} else if acquired {
+			break
+		}
+		l.Infof("waiting for the %s lease, held by another process", name)
+		select {
+		case <-time.After(ttl / 3):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	taskCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	renewErr := make(chan error, 1)
+	renewDone := make(chan struct{})
+	go func() {
+		defer close(renewDone)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				acquired, err := ds.AcquireLease(taskCtx, name, owner, ttl)
+				if err == nil && !acquired {
+					err = errors.Errorf("the %s lease was taken over", name)
+				}
+				if err != nil {
+					renewErr <- errors.Wrapf(err, "failed to renew the %s lease", name)
+					cancel()
+					return
+				}
+			case <-taskCtx.Done():
+				return
+			}
+		}
+	}()
+
+	err := task(taskCtx)
+	cancel()
+	<-renewDone
+	if err != nil {
+		// the task failed because the lease was lost
+		select {
+		case err = <-renewErr:
+		default:
+		}
+	}
+	if releaseErr := ds.ReleaseLease(ctx, name, owner); releaseErr != nil {
+		l.Warnf("failed to release the %s lease: %s", name, releaseErr)
+	}
+	return err
+}
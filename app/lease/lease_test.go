@@ -0,0 +1,114 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package lease
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	store_mocks "github.com/mendersoftware/reporting/store/mocks"
+)
+
+func TestRun(t *testing.T) {
+	const (
+		name = "migrations"
+		ttl  = 30 * time.Millisecond
+	)
+	anyCtx := mock.MatchedBy(func(context.Context) bool { return true })
+	anyOwner := mock.AnythingOfType("string")
+	testCases := map[string]struct {
+		setup   func(ds *store_mocks.DataStore)
+		taskErr error
+
+		ran bool
+		err string
+	}{
+		"ok": {
+			setup: func(ds *store_mocks.DataStore) {
+				ds.On("AcquireLease", anyCtx, name, anyOwner, ttl).Return(true, nil)
+				ds.On("ReleaseLease", anyCtx, name, anyOwner).Return(nil)
+			},
+			ran: true,
+		},
+		"ok, waits for the lease": {
+			setup: func(ds *store_mocks.DataStore) {
+				ds.On("AcquireLease", anyCtx, name, anyOwner, ttl).
+					Return(false, nil).Twice()
+				ds.On("AcquireLease", anyCtx, name, anyOwner, ttl).Return(true, nil)
+				ds.On("ReleaseLease", anyCtx, name, anyOwner).Return(nil)
+			},
+			ran: true,
+		},
+		"ko, task error": {
+			setup: func(ds *store_mocks.DataStore) {
+				ds.On("AcquireLease", anyCtx, name, anyOwner, ttl).Return(true, nil)
+				ds.On("ReleaseLease", anyCtx, name, anyOwner).Return(nil)
+			},
+			taskErr: errors.New("migration error"),
+			ran:     true,
+			err:     "migration error",
+		},
+		"ko, acquire error": {
+			setup: func(ds *store_mocks.DataStore) {
+				ds.On("AcquireLease", anyCtx, name, anyOwner, ttl).
+					Return(false, errors.New("mongo error"))
+			},
+			err: "mongo error",
+		},
+		"ko, lease taken over": {
+			setup: func(ds *store_mocks.DataStore) {
+				ds.On("AcquireLease", anyCtx, name, anyOwner, ttl).
+					Return(true, nil).Once()
+				ds.On("AcquireLease", anyCtx, name, anyOwner, ttl).Return(false, nil)
+				ds.On("ReleaseLease", anyCtx, name, anyOwner).Return(nil)
+			},
+			taskErr: context.Canceled,
+			ran:     true,
+			err: "failed to renew the migrations lease: " +
+				"the migrations lease was taken over",
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ds := &store_mocks.DataStore{}
+			defer ds.AssertExpectations(t)
+			tc.setup(ds)
+
+			ran := false
+			err := Run(context.Background(), ds, "migrations", ttl,
+				func(ctx context.Context) error {
+					ran = true
+					if tc.taskErr == context.Canceled {
+						// runs until the lease is lost
+						<-ctx.Done()
+						return ctx.Err()
+					}
+					return tc.taskErr
+				})
+			assert.Equal(t, tc.ran, ran)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package placement manages the placement of the tenants on the shared or
+// dedicated devices and deployments indices
+package placement
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/reporting/model"
+	"github.com/mendersoftware/reporting/store"
+)
+
+// Refresh loads the tenant placements from the data store into the store
+func Refresh(ctx context.Context, s store.Store, ds store.DataStore) error {
+	placements, err := ds.GetTenantPlacements(ctx)
+	if err != nil {
+		return err
+	}
+	s.SetTenantPlacements(placements)
+	return nil
+}
+
+// Watch refreshes the tenant placements at every interval, until the
+// context is canceled
+func Watch(ctx context.Context, s store.Store, ds store.DataStore, interval time.Duration) {
+	l := log.FromContext(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := Refresh(ctx, s, ds); err != nil {
+				l.Errorf("failed to refresh the tenant placements: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Dedicate moves the tenant from the shared indices to dedicated ones,
+// while the tenant keeps being indexed and searched:
+//  1. the dedicated indices are created;
+//  2. the tenant is marked as migrating, and its documents are written to
+//     both the shared and dedicated indices;
+//  3. the documents are copied from the shared indices to the dedicated ones;
+//  4. the tenant is marked as dedicated, and searched on the dedicated indices;
+//  5. the documents are deleted from the shared indices.
+//
+// The settle delay lets all the processes reload the placement after each
+// change, and must be longer than the max age of the placements in the
+// stores, which refuse to write with placements older than that: a process
+// failing to reload the placement stops writing before the next step, and
+// the documents are never written to the shared indices after step 5.
+// An interrupted migration is resumed by calling Dedicate again.
+func Dedicate(ctx context.Context, s store.Store, ds store.DataStore,
+	placement *model.TenantPlacement, settle time.Duration) error {
+	l := log.FromContext(ctx)
+
+	current, err := ds.GetTenantPlacement(ctx, placement.TenantID)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.State != model.TenantPlacementDedicated {
+		l.Infof("migrating tenant %q to the dedicated indices", placement.TenantID)
+		err = s.CreateTenantIndices(ctx, placement)
+		if err != nil {
+			return errors.Wrap(err, "failed to create the dedicated indices")
+		}
+		err = setState(ctx, s, ds, placement, model.TenantPlacementMigrating, settle)
+		if err != nil {
+			return err
+		}
+		err = s.CopyTenantDocuments(ctx, placement.TenantID)
+		if err != nil {
+			return errors.Wrap(err, "failed to copy the documents")
+		}
+		err = setState(ctx, s, ds, placement, model.TenantPlacementDedicated, settle)
+		if err != nil {
+			return err
+		}
+	} else {
+		*placement = *current
+	}
+	err = s.DeleteSharedTenantDocuments(ctx, placement.TenantID)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete the documents from the shared indices")
+	}
+	l.Infof("tenant %q moved to the dedicated indices", placement.TenantID)
+	return nil
+}
+
+func setState(ctx context.Context, s store.Store, ds store.DataStore,
+	placement *model.TenantPlacement, state string, settle time.Duration) error {
+	placement.State = state
+	placement.UpdatedAt = time.Now()
+	err := ds.SetTenantPlacement(ctx, placement)
+	if err != nil {
+		return err
+	}
+	err = Refresh(ctx, s, ds)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).Infof("tenant %q is %s, waiting %s for the processes to reload",
+		placement.TenantID, state, settle)
+	select {
+	case <-time.After(settle):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
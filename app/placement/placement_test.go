@@ -0,0 +1,166 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package placement
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/model"
+	"github.com/mendersoftware/reporting/store/mocks"
+	"github.com/mendersoftware/reporting/store/opensearch"
+)
+
+func TestRefresh(t *testing.T) {
+	placements := []model.TenantPlacement{{
+		TenantID: "tenant",
+		State:    model.TenantPlacementDedicated,
+	}}
+	ds := &mocks.DataStore{}
+	ds.On("GetTenantPlacements", mock.Anything).Return(placements, nil).Once()
+	ds.On("GetTenantPlacements", mock.Anything).Return(nil, errors.New("abort")).Once()
+	s := &mocks.Store{}
+	s.On("SetTenantPlacements", placements).Once()
+
+	err := Refresh(context.Background(), s, ds)
+	assert.NoError(t, err)
+
+	err = Refresh(context.Background(), s, ds)
+	assert.EqualError(t, err, "abort")
+
+	ds.AssertExpectations(t)
+	s.AssertExpectations(t)
+}
+
+func TestWatch(t *testing.T) {
+	const maxAge = 50 * time.Millisecond
+	ds := &mocks.DataStore{}
+	ds.On("GetTenantPlacements", mock.Anything).Return(nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a process running longer than the max age of the placements, such as
+	// a reindex, keeps writing as long as it reloads them
+	watched, err := opensearch.NewStore(opensearch.WithPlacementsMaxAge(maxAge))
+	assert.NoError(t, err)
+	assert.NoError(t, Refresh(ctx, watched, ds))
+	go Watch(ctx, watched, ds, maxAge/5)
+	outdated, err := opensearch.NewStore(opensearch.WithPlacementsMaxAge(maxAge))
+	assert.NoError(t, err)
+	assert.NoError(t, Refresh(ctx, outdated, ds))
+
+	time.Sleep(2 * maxAge)
+	_, err = watched.BulkIndexDevices(ctx, nil, nil)
+	assert.NoError(t, err)
+	_, err = outdated.BulkIndexDevices(ctx, nil, nil)
+	assert.ErrorIs(t, err, opensearch.ErrPlacementsOutdated)
+}
+
+func TestDedicate(t *testing.T) {
+	const tenantID = "tenant"
+	testCases := map[string]struct {
+		current *model.TenantPlacement
+
+		createErr error
+		copyErr   error
+		deleteErr error
+
+		states []string
+		err    error
+	}{
+		"ok": {
+			states: []string{
+				model.TenantPlacementMigrating,
+				model.TenantPlacementDedicated,
+			},
+		},
+		"ok, resume the migration": {
+			current: &model.TenantPlacement{
+				TenantID: tenantID,
+				State:    model.TenantPlacementMigrating,
+			},
+			states: []string{
+				model.TenantPlacementMigrating,
+				model.TenantPlacementDedicated,
+			},
+		},
+		"ok, resume the cleanup": {
+			current: &model.TenantPlacement{
+				TenantID: tenantID,
+				State:    model.TenantPlacementDedicated,
+			},
+		},
+		"ko, create the indices": {
+			createErr: errors.New("abort"),
+			err:       errors.New("failed to create the dedicated indices: abort"),
+		},
+		"ko, copy the documents": {
+			copyErr: errors.New("abort"),
+			states:  []string{model.TenantPlacementMigrating},
+			err:     errors.New("failed to copy the documents: abort"),
+		},
+		"ko, delete the documents": {
+			deleteErr: errors.New("abort"),
+			states: []string{
+				model.TenantPlacementMigrating,
+				model.TenantPlacementDedicated,
+			},
+			err: errors.New(
+				"failed to delete the documents from the shared indices: abort"),
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			placement := &model.TenantPlacement{
+				TenantID:          tenantID,
+				DevicesShards:     2,
+				DeploymentsShards: 3,
+			}
+
+			var states []string
+			ds := &mocks.DataStore{}
+			ds.On("GetTenantPlacement", ctx, tenantID).Return(tc.current, nil)
+			ds.On("SetTenantPlacement", ctx, placement).
+				Run(func(args mock.Arguments) {
+					p := args.Get(1).(*model.TenantPlacement)
+					states = append(states, p.State)
+				}).
+				Return(nil)
+			ds.On("GetTenantPlacements", ctx).Return([]model.TenantPlacement{}, nil)
+
+			s := &mocks.Store{}
+			s.On("CreateTenantIndices", ctx, placement).Return(tc.createErr)
+			s.On("SetTenantPlacements", []model.TenantPlacement{})
+			s.On("CopyTenantDocuments", ctx, tenantID).Return(tc.copyErr)
+			s.On("DeleteSharedTenantDocuments", ctx, tenantID).Return(tc.deleteErr)
+
+			err := Dedicate(ctx, s, ds, placement, 0)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, model.TenantPlacementDedicated, placement.State)
+			}
+			assert.Equal(t, tc.states, states)
+		})
+	}
+}
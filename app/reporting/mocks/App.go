@@ -30,6 +30,29 @@ type App struct {
 	mock.Mock
 }
 
+// AggregateDeploymentSummaries provides a mock function with given fields: ctx, aggregateParams
+func (_m *App) AggregateDeploymentSummaries(ctx context.Context, aggregateParams *model.AggregateDeploymentsParams) ([]model.DeviceAggregation, error) {
+	ret := _m.Called(ctx, aggregateParams)
+
+	var r0 []model.DeviceAggregation
+	if rf, ok := ret.Get(0).(func(context.Context, *model.AggregateDeploymentsParams) []model.DeviceAggregation); ok {
+		r0 = rf(ctx, aggregateParams)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeviceAggregation)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.AggregateDeploymentsParams) error); ok {
+		r1 = rf(ctx, aggregateParams)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // AggregateDeployments provides a mock function with given fields: ctx, aggregateParams
 func (_m *App) AggregateDeployments(ctx context.Context, aggregateParams *model.AggregateDeploymentsParams) ([]model.DeviceAggregation, error) {
 	ret := _m.Called(ctx, aggregateParams)
@@ -136,6 +159,50 @@ func (_m *App) HealthCheck(ctx context.Context) error {
 	return r0
 }
 
+// ReindexTenant provides a mock function with given fields: ctx, tid
+func (_m *App) ReindexTenant(ctx context.Context, tid string) error {
+	ret := _m.Called(ctx, tid)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, tid)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SearchDeploymentSummaries provides a mock function with given fields: ctx, searchParams
+func (_m *App) SearchDeploymentSummaries(ctx context.Context, searchParams *model.DeploymentsSearchParams) ([]model.DeploymentSummary, int, error) {
+	ret := _m.Called(ctx, searchParams)
+
+	var r0 []model.DeploymentSummary
+	if rf, ok := ret.Get(0).(func(context.Context, *model.DeploymentsSearchParams) []model.DeploymentSummary); ok {
+		r0 = rf(ctx, searchParams)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeploymentSummary)
+		}
+	}
+
+	var r1 int
+	if rf, ok := ret.Get(1).(func(context.Context, *model.DeploymentsSearchParams) int); ok {
+		r1 = rf(ctx, searchParams)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, *model.DeploymentsSearchParams) error); ok {
+		r2 = rf(ctx, searchParams)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // SearchDeployments provides a mock function with given fields: ctx, searchParams
 func (_m *App) SearchDeployments(ctx context.Context, searchParams *model.DeploymentsSearchParams) ([]model.Deployment, int, error) {
 	ret := _m.Called(ctx, searchParams)
@@ -195,3 +262,26 @@ func (_m *App) SearchDevices(ctx context.Context, searchParams *model.SearchPara
 
 	return r0, r1, r2
 }
+
+// VerifyTenant provides a mock function with given fields: ctx, tid, sample
+func (_m *App) VerifyTenant(ctx context.Context, tid string, sample int) (*model.DriftReport, error) {
+	ret := _m.Called(ctx, tid, sample)
+
+	var r0 *model.DriftReport
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) *model.DriftReport); ok {
+		r0 = rf(ctx, tid, sample)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DriftReport)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, tid, sample)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
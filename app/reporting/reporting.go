@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/mendersoftware/go-lib-micro/log"
@@ -41,20 +42,51 @@ type App interface {
 		[]model.DeviceAggregation, error)
 	SearchDeployments(ctx context.Context, searchParams *model.DeploymentsSearchParams) (
 		[]model.Deployment, int, error)
+	AggregateDeploymentSummaries(ctx context.Context,
+		aggregateParams *model.AggregateDeploymentsParams) ([]model.DeviceAggregation, error)
+	SearchDeploymentSummaries(ctx context.Context, searchParams *model.DeploymentsSearchParams) (
+		[]model.DeploymentSummary, int, error)
+	ReindexTenant(ctx context.Context, tid string) error
+	VerifyTenant(ctx context.Context, tid string, sample int) (*model.DriftReport, error)
 }
 
+// Reindexer reindexes the devices and deployments from the source services,
+// and verifies the index against them
+type Reindexer interface {
+	ReindexTenant(ctx context.Context, tenantID string) error
+	VerifyTenant(ctx context.Context, tenantID string, sample int) (*model.DriftReport, error)
+}
+
+// maxConcurrentReindex is the maximum number of tenants reindexed in the
+// background at the same time
+const maxConcurrentReindex = 2
+
+var (
+	ErrReindexUnavailable = errors.New("reindexing is not available")
+	ErrVerifyUnavailable  = errors.New("verification is not available")
+)
+
 type app struct {
-	store  store.Store
-	mapper mapping.Mapper
-	ds     store.DataStore
+	store     store.Store
+	mapper    mapping.Mapper
+	ds        store.DataStore
+	reindexer Reindexer
+
+	// reindexing holds the tenants being reindexed, or waiting for a slot
+	reindexing   map[string]bool
+	reindexMutex sync.Mutex
+	reindexSlots chan struct{}
 }
 
-func NewApp(store store.Store, ds store.DataStore) App {
+func NewApp(store store.Store, ds store.DataStore, reindexer Reindexer) App {
 	mapper := mapping.NewMapper(ds)
 	return &app{
-		store:  store,
-		mapper: mapper,
-		ds:     ds,
+		store:        store,
+		mapper:       mapper,
+		ds:           ds,
+		reindexer:    reindexer,
+		reindexing:   make(map[string]bool),
+		reindexSlots: make(chan struct{}, maxConcurrentReindex),
 	}
 }
 
@@ -67,6 +99,52 @@ func (a *app) HealthCheck(ctx context.Context) error {
 	return err
 }
 
+// ReindexTenant starts reindexing all the devices and deployments of the
+// tenant in the background; the requests for a tenant already being
+// reindexed are ignored, and at most maxConcurrentReindex tenants are
+// reindexed at the same time, the others waiting for their turn
+func (app *app) ReindexTenant(ctx context.Context, tid string) error {
+	if app.reindexer == nil {
+		return ErrReindexUnavailable
+	}
+	l := log.FromContext(ctx)
+	app.reindexMutex.Lock()
+	defer app.reindexMutex.Unlock()
+	if app.reindexing[tid] {
+		l.Infof("tenant %q is already being reindexed", tid)
+		return nil
+	}
+	app.reindexing[tid] = true
+	go func() {
+		defer func() {
+			app.reindexMutex.Lock()
+			delete(app.reindexing, tid)
+			app.reindexMutex.Unlock()
+		}()
+		app.reindexSlots <- struct{}{}
+		defer func() { <-app.reindexSlots }()
+		ctx := log.WithContext(context.Background(), l)
+		err := app.reindexer.ReindexTenant(ctx, tid)
+		if err != nil {
+			l.Errorf("failed to reindex tenant %q: %s", tid, err)
+		}
+	}()
+	return nil
+}
+
+// VerifyTenant compares the documents indexed for the tenant with the
+// source services, either all of them or a random sample
+func (app *app) VerifyTenant(
+	ctx context.Context,
+	tid string,
+	sample int,
+) (*model.DriftReport, error) {
+	if app.reindexer == nil {
+		return nil, ErrVerifyUnavailable
+	}
+	return app.reindexer.VerifyTenant(ctx, tid, sample)
+}
+
 // GetMapping returns the mapping for the specified tenant
 func (app *app) GetMapping(ctx context.Context, tid string) (*model.Mapping, error) {
 	return app.ds.GetMapping(ctx, tid)
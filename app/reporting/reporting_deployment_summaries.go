@@ -0,0 +1,156 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package reporting
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+// AggregateDeploymentSummaries aggregates the deployment summaries
+func (app *app) AggregateDeploymentSummaries(
+	ctx context.Context,
+	aggregateParams *model.AggregateDeploymentsParams,
+) ([]model.DeviceAggregation, error) {
+	searchParams := &model.DeploymentsSearchParams{
+		Filters:          aggregateParams.Filters,
+		DeploymentGroups: aggregateParams.DeploymentGroups,
+		TenantID:         aggregateParams.TenantID,
+	}
+	query, err := model.BuildDeploymentsQuery(*searchParams)
+	if err != nil {
+		return nil, err
+	}
+	if searchParams.TenantID != "" {
+		query = query.Must(model.M{
+			"term": model.M{
+				model.FieldNameTenantID: searchParams.TenantID,
+			},
+		})
+	}
+
+	aggregations, err := model.BuildDeploymentsAggregations(aggregateParams.Aggregations)
+	if err != nil {
+		return nil, err
+	}
+
+	query = query.WithSize(0).With(map[string]interface{}{
+		"aggs": aggregations,
+	})
+	esRes, err := app.store.AggregateDeploymentSummaries(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregationsS, ok := esRes["aggregations"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("can't process store aggregations slice")
+	}
+	return app.storeToDeviceAggregations(ctx, searchParams.TenantID, aggregationsS)
+}
+
+// SearchDeploymentSummaries searches the deployment summaries
+func (app *app) SearchDeploymentSummaries(
+	ctx context.Context,
+	searchParams *model.DeploymentsSearchParams,
+) ([]model.DeploymentSummary, int, error) {
+	query, err := model.BuildDeploymentsQuery(*searchParams)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if searchParams.TenantID != "" {
+		query = query.Must(model.M{
+			"term": model.M{
+				model.FieldNameTenantID: searchParams.TenantID,
+			},
+		})
+	}
+
+	if len(searchParams.DeploymentIDs) > 0 {
+		query = query.Must(model.M{
+			"terms": model.M{
+				model.FieldNameDeploymentID: searchParams.DeploymentIDs,
+			},
+		})
+	}
+
+	esRes, err := app.store.SearchDeploymentSummaries(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return storeToDeploymentSummaries(esRes)
+}
+
+// storeToDeploymentSummaries translates ES results to deployment summaries
+func storeToDeploymentSummaries(
+	storeRes map[string]interface{},
+) ([]model.DeploymentSummary, int, error) {
+	summaries := []model.DeploymentSummary{}
+
+	hitsM, ok := storeRes["hits"].(map[string]interface{})
+	if !ok {
+		return nil, 0, errors.New("can't process store hits map")
+	}
+
+	hitsTotalM, ok := hitsM["total"].(map[string]interface{})
+	if !ok {
+		return nil, 0, errors.New("can't process total hits struct")
+	}
+
+	total, ok := hitsTotalM["value"].(float64)
+	if !ok {
+		return nil, 0, errors.New("can't process total hits value")
+	}
+
+	hitsS, ok := hitsM["hits"].([]interface{})
+	if !ok {
+		return nil, 0, errors.New("can't process store hits slice")
+	}
+
+	for _, v := range hitsS {
+		resM, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, 0, errors.New("can't process individual hit")
+		}
+
+		// if query has a 'fields' clause, use 'fields' instead of '_source'
+		sourceM, ok := resM["_source"].(map[string]interface{})
+		if !ok {
+			sourceM, ok = resM["fields"].(map[string]interface{})
+			if !ok {
+				return nil, 0, errors.New("can't process hit's '_source' nor 'fields'")
+			}
+		}
+
+		source, err := json.Marshal(sourceM)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "unable to marshal result into JSON")
+		}
+
+		var summary model.DeploymentSummary
+		if err := json.Unmarshal(source, &summary); err != nil {
+			return nil, 0, errors.Wrap(err, "unable to unmarshal result from JSON")
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, int(total), nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package reporting
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+	mstore "github.com/mendersoftware/reporting/store/mocks"
+)
+
+func TestAggregateDeploymentSummaries(t *testing.T) {
+	const tenantID = "tenant_id"
+	t.Parallel()
+	type testCase struct {
+		Name string
+
+		Params *model.AggregateDeploymentsParams
+		Store  func(*testing.T, testCase) *mstore.Store
+
+		Result []model.DeviceAggregation
+		Error  error
+	}
+	testCases := []testCase{{
+		Name: "ok",
+
+		Params: &model.AggregateDeploymentsParams{
+			Aggregations: []model.DeploymentsAggregationTerm{{
+				Name:      "by_status",
+				Attribute: "deployment_status",
+			}},
+			TenantID: tenantID,
+		},
+		Store: func(t *testing.T, self testCase) *mstore.Store {
+			store := new(mstore.Store)
+			q, _ := model.BuildDeploymentsQuery(model.DeploymentsSearchParams{})
+			q = q.Must(model.M{
+				"term": model.M{
+					model.FieldNameTenantID: tenantID,
+				},
+			})
+			aggrs, _ := model.BuildDeploymentsAggregations(self.Params.Aggregations)
+			q = q.WithSize(0).With(map[string]interface{}{
+				"aggs": aggrs,
+			})
+			store.On("AggregateDeploymentSummaries", contextMatcher, q).
+				Return(model.M{
+					"aggregations": map[string]interface{}{
+						"by_status": map[string]interface{}{
+							"sum_other_doc_count": float64(0),
+							"buckets": []interface{}{
+								map[string]interface{}{
+									"key":       "finished",
+									"doc_count": float64(3),
+								},
+							},
+						},
+					},
+				}, nil)
+			return store
+		},
+		Result: []model.DeviceAggregation{{
+			Name: "by_status",
+			Items: []model.DeviceAggregationItem{{
+				Key:   "finished",
+				Count: 3,
+			}},
+		}},
+	}, {
+		Name: "error, internal storage-layer error",
+
+		Params: &model.AggregateDeploymentsParams{
+			Aggregations: []model.DeploymentsAggregationTerm{{
+				Name:      "by_status",
+				Attribute: "deployment_status",
+			}},
+		},
+		Store: func(t *testing.T, self testCase) *mstore.Store {
+			store := new(mstore.Store)
+			q, _ := model.BuildDeploymentsQuery(model.DeploymentsSearchParams{})
+			aggrs, _ := model.BuildDeploymentsAggregations(self.Params.Aggregations)
+			q = q.WithSize(0).With(map[string]interface{}{
+				"aggs": aggrs,
+			})
+			store.On("AggregateDeploymentSummaries", contextMatcher, q).
+				Return(nil, errors.New("internal error"))
+			return store
+		},
+		Error: errors.New("internal error"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			store := tc.Store(t, tc)
+			defer store.AssertExpectations(t)
+
+			app := NewApp(store, nil, nil)
+			res, err := app.AggregateDeploymentSummaries(context.Background(), tc.Params)
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t, tc.Error.Error(), err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Result, res)
+			}
+		})
+	}
+}
+
+func TestSearchDeploymentSummaries(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		Name string
+
+		Params *model.DeploymentsSearchParams
+		Store  func(*testing.T, testCase) *mstore.Store
+
+		Result     []model.DeploymentSummary
+		TotalCount int
+		Error      error
+	}
+	testCases := []testCase{{
+		Name: "ok",
+
+		Params: &model.DeploymentsSearchParams{
+			Sort: []model.DeploymentsSortCriteria{{
+				Attribute: "success_ratio",
+				Order:     "desc",
+			}},
+			DeploymentIDs: []string{"194d1060-1717-44dc-a783-00038f4a8013"},
+			TenantID:      "123456789012345678901234",
+		},
+		Store: func(t *testing.T, self testCase) *mstore.Store {
+			store := new(mstore.Store)
+			q, _ := model.BuildDeploymentsQuery(*self.Params)
+			q = q.Must(model.M{"term": model.M{model.FieldNameTenantID: self.Params.TenantID}})
+			q = q.Must(model.M{
+				"terms": model.M{model.FieldNameDeploymentID: self.Params.DeploymentIDs},
+			})
+			store.On("SearchDeploymentSummaries", contextMatcher, q).
+				Return(model.M{"hits": map[string]interface{}{"hits": []interface{}{
+					map[string]interface{}{"_source": map[string]interface{}{
+						"id":            "194d1060-1717-44dc-a783-00038f4a8013",
+						"tenant_id":     "123456789012345678901234",
+						"device_counts": map[string]interface{}{"success": float64(2)},
+						"success_ratio": float64(1),
+					}}},
+					"total": map[string]interface{}{
+						"value": float64(1),
+					}},
+				}, nil)
+			return store
+		},
+		TotalCount: 1,
+		Result: []model.DeploymentSummary{{
+			ID:           "194d1060-1717-44dc-a783-00038f4a8013",
+			TenantID:     "123456789012345678901234",
+			DeviceCounts: map[string]int{"success": 2},
+			SuccessRatio: 1,
+		}},
+	}, {
+		Name: "error, internal storage-layer error",
+
+		Params: &model.DeploymentsSearchParams{},
+		Store: func(t *testing.T, self testCase) *mstore.Store {
+			store := new(mstore.Store)
+			q, _ := model.BuildDeploymentsQuery(*self.Params)
+			store.On("SearchDeploymentSummaries", contextMatcher, q).
+				Return(nil, errors.New("internal error"))
+			return store
+		},
+		Error: errors.New("internal error"),
+	}, {
+		Name: "error, parsing elastic result",
+
+		Params: &model.DeploymentsSearchParams{},
+		Store: func(t *testing.T, self testCase) *mstore.Store {
+			store := new(mstore.Store)
+			q, _ := model.BuildDeploymentsQuery(*self.Params)
+			store.On("SearchDeploymentSummaries", contextMatcher, q).
+				Return(model.M{
+					"hits": map[string]interface{}{
+						"hits": []interface{}{},
+						"total": map[string]interface{}{
+							"value": "doh!",
+						},
+					},
+				}, nil)
+			return store
+		},
+		Error: errors.New("can't process total hits value"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			store := tc.Store(t, tc)
+			defer store.AssertExpectations(t)
+
+			app := NewApp(store, nil, nil)
+			res, cnt, err := app.SearchDeploymentSummaries(context.Background(), tc.Params)
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t, tc.Error.Error(), err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.TotalCount, cnt)
+				assert.Equal(t, tc.Result, res)
+			}
+		})
+	}
+}
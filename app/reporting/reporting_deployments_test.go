@@ -265,7 +265,7 @@ func TestAggregateDeployments(t *testing.T) {
 				tenantID,
 			).Return(&tc.Mapping, nil).Once()
 
-			app := NewApp(store, ds)
+			app := NewApp(store, ds, nil)
 			res, err := app.AggregateDeployments(context.Background(), tc.Params)
 			if tc.Error != nil {
 				if assert.Error(t, err) {
@@ -553,7 +553,7 @@ func TestSearchDeployments(t *testing.T) {
 				"",
 			).Return(&tc.Mapping, nil).Once()
 
-			app := NewApp(store, ds)
+			app := NewApp(store, ds, nil)
 			res, cnt, err := app.SearchDeployments(context.Background(), tc.Params)
 			if tc.Error != nil {
 				if assert.Error(t, err) {
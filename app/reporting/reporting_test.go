@@ -17,12 +17,14 @@ package reporting
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	indexer_mocks "github.com/mendersoftware/reporting/app/indexer/mocks"
 	"github.com/mendersoftware/reporting/client/inventory"
 	"github.com/mendersoftware/reporting/model"
 	mstore "github.com/mendersoftware/reporting/store/mocks"
@@ -66,7 +68,7 @@ func TestHealthCheck(t *testing.T) {
 			if tc.DatastoreErr == nil {
 				store.On("Ping", ctx).Return(tc.StoreErr)
 			}
-			app := NewApp(store, ds)
+			app := NewApp(store, ds, nil)
 
 			err := app.HealthCheck(ctx)
 			if tc.Error != nil {
@@ -89,7 +91,7 @@ func TestGetMapping(t *testing.T) {
 	ds := &mstore.DataStore{}
 	ds.On("GetMapping", ctx, tenantID).Return(mapping, nil)
 
-	app := NewApp(nil, ds)
+	app := NewApp(nil, ds, nil)
 	res, err := app.GetMapping(ctx, tenantID)
 	assert.NoError(t, err)
 	assert.Equal(t, mapping, res)
@@ -361,7 +363,7 @@ func TestAggregateDevices(t *testing.T) {
 				tenantID,
 			).Return(&tc.Mapping, nil).Once()
 
-			app := NewApp(store, ds)
+			app := NewApp(store, ds, nil)
 			res, err := app.AggregateDevices(context.Background(), tc.Params)
 			if tc.Error != nil {
 				if assert.Error(t, err) {
@@ -618,7 +620,7 @@ func TestSearchDevices(t *testing.T) {
 				"",
 			).Return(&tc.Mapping, nil).Once()
 
-			app := NewApp(store, ds)
+			app := NewApp(store, ds, nil)
 			res, cnt, err := app.SearchDevices(context.Background(), tc.Params)
 			if tc.Error != nil {
 				if assert.Error(t, err) {
@@ -712,7 +714,7 @@ func TestGetSearchableInvAttrs(t *testing.T) {
 				tenantID,
 			).Return(&tc.Mapping, nil).Once()
 
-			app := NewApp(store, ds)
+			app := NewApp(store, ds, nil)
 			res, err := app.GetSearchableInvAttrs(context.Background(), tenantID)
 			if tc.Error != nil {
 				if assert.Error(t, err) {
@@ -795,3 +797,176 @@ func TestGetTime(t *testing.T) {
 		})
 	}
 }
+
+func TestReindexTenant(t *testing.T) {
+	const tenantID = "tenant"
+
+	testCases := map[string]struct {
+		reindexer    bool
+		reindexerErr error
+
+		err error
+	}{
+		"ok": {
+			reindexer: true,
+		},
+		"ok, reindex failure is only logged": {
+			reindexer:    true,
+			reindexerErr: errors.New("reindex error"),
+		},
+		"ko, no reindexer": {
+			err: ErrReindexUnavailable,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			var app App
+			done := make(chan struct{})
+			if tc.reindexer {
+				reindexer := &indexer_mocks.Indexer{}
+				defer reindexer.AssertExpectations(t)
+				reindexer.On("ReindexTenant",
+					contextMatcher,
+					tenantID,
+				).Run(func(args mock.Arguments) {
+					close(done)
+				}).Return(tc.reindexerErr)
+				app = NewApp(nil, nil, reindexer)
+			} else {
+				close(done)
+				app = NewApp(nil, nil, nil)
+			}
+
+			err := app.ReindexTenant(ctx, tenantID)
+			assert.Equal(t, tc.err, err)
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("timeout waiting for the reindexer")
+			}
+		})
+	}
+}
+
+func TestReindexTenantConcurrency(t *testing.T) {
+	tenantIDs := []string{"t1", "t2", "t3"}
+
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	finished := make(chan struct{}, 10)
+
+	reindexer := &indexer_mocks.Indexer{}
+	defer reindexer.AssertExpectations(t)
+	for _, tenantID := range tenantIDs {
+		reindexer.On("ReindexTenant",
+			contextMatcher,
+			tenantID,
+		).Run(func(args mock.Arguments) {
+			mutex.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mutex.Unlock()
+			started <- args.String(1)
+			<-release
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+			finished <- struct{}{}
+		}).Return(nil).Once()
+	}
+	app := NewApp(nil, nil, reindexer)
+
+	ctx := context.Background()
+	for _, tenantID := range tenantIDs {
+		assert.NoError(t, app.ReindexTenant(ctx, tenantID))
+	}
+	for i := 0; i < maxConcurrentReindex; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for the reindexer")
+		}
+	}
+	// the tenants already reindexed or waiting are not reindexed twice
+	for _, tenantID := range tenantIDs {
+		assert.NoError(t, app.ReindexTenant(ctx, tenantID))
+	}
+	select {
+	case tenantID := <-started:
+		t.Fatalf("tenant %q reindexed beyond the concurrency limit", tenantID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	for range tenantIDs {
+		select {
+		case <-finished:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for the reindexer")
+		}
+	}
+	assert.Equal(t, maxConcurrentReindex, maxRunning)
+}
+
+func TestVerifyTenant(t *testing.T) {
+	const tenantID = "tenant"
+
+	report := &model.DriftReport{
+		TenantID: tenantID,
+		Sample:   10,
+	}
+	testCases := map[string]struct {
+		reindexer    bool
+		reindexerErr error
+
+		report *model.DriftReport
+		err    error
+	}{
+		"ok": {
+			reindexer: true,
+			report:    report,
+		},
+		"ko, verification failure": {
+			reindexer:    true,
+			reindexerErr: errors.New("verify error"),
+			err:          errors.New("verify error"),
+		},
+		"ko, no reindexer": {
+			err: ErrVerifyUnavailable,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			app := NewApp(nil, nil, nil)
+			if tc.reindexer {
+				reindexer := &indexer_mocks.Indexer{}
+				defer reindexer.AssertExpectations(t)
+				reindexer.On("VerifyTenant",
+					contextMatcher,
+					tenantID,
+					10,
+				).Return(tc.report, tc.reindexerErr)
+				app = NewApp(nil, nil, reindexer)
+			}
+
+			res, err := app.VerifyTenant(ctx, tenantID, 10)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.report, res)
+		})
+	}
+}
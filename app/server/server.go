@@ -29,6 +29,7 @@ import (
 	"github.com/mendersoftware/go-lib-micro/log"
 
 	api "github.com/mendersoftware/reporting/api/http"
+	"github.com/mendersoftware/reporting/app/indexer"
 	"github.com/mendersoftware/reporting/app/reporting"
 	dconfig "github.com/mendersoftware/reporting/config"
 	"github.com/mendersoftware/reporting/store"
@@ -48,7 +49,8 @@ func InitAndRun(conf config.Reader, store store.Store, ds store.DataStore) error
 
 	l := log.FromContext(ctx)
 
-	reporting := reporting.NewApp(store, ds)
+	reindexer := indexer.NewIndexerFromConfig(conf, store, ds, nil)
+	reporting := reporting.NewApp(store, ds, reindexer)
 
 	var listen = conf.GetString(dconfig.SettingListen)
 	var router = api.NewRouter(reporting)
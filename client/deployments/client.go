@@ -28,10 +28,13 @@ import (
 
 	"github.com/mendersoftware/go-lib-micro/log"
 
+	"github.com/mendersoftware/reporting/metrics"
+	"github.com/mendersoftware/reporting/model"
 	"github.com/mendersoftware/reporting/utils"
 )
 
 const (
+	urlDeployments          = "/api/internal/v1/deployments/tenants/:tid/deployments"
 	urlDeviceDeployments    = "/api/internal/v1/deployments/tenants/:tid/deployments/devices"
 	urlLastDeviceDeployment = "/api/internal/v1/deployments/tenants/:tid/devices/deployments/last"
 	defaultTimeout          = 10 * time.Second
@@ -45,6 +48,19 @@ type Client interface {
 		tenantID string,
 		IDs []string,
 	) ([]*DeviceDeployment, error)
+	// ListDeployments retrieves the deployments, with their statistics,
+	// by deployment ID
+	ListDeployments(
+		ctx context.Context,
+		tenantID string,
+		deploymentIDs []string,
+	) ([]*Deployment, error)
+	// ListDeviceDeployments retrieves a page of all the tenant's device deployments
+	ListDeviceDeployments(
+		ctx context.Context,
+		tenantID string,
+		page, perPage int,
+	) ([]*DeviceDeployment, error)
 	// GetLatestDeployment retrieves the latest deployment for a given devices
 	GetLatestFinishedDeployment(
 		ctx context.Context,
@@ -60,7 +76,7 @@ type client struct {
 
 func NewClient(urlBase string) Client {
 	return &client{
-		client:  &http.Client{},
+		client:  &http.Client{Transport: metrics.NewTransport(model.ServiceDeployments, nil)},
 		urlBase: urlBase,
 	}
 }
@@ -147,6 +163,120 @@ func (c *client) GetDeployments(
 	return devDevs, err
 }
 
+func (c *client) ListDeployments(
+	ctx context.Context,
+	tenantID string,
+	deploymentIDs []string,
+) ([]*Deployment, error) {
+	const maxDeploymentIDs = 20 // API constraint
+	url := utils.JoinURL(c.urlBase, urlDeployments)
+	url = strings.Replace(url, ":tid", tenantID, 1)
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var depls []*Deployment
+	for i := 0; i < len(deploymentIDs); i += maxDeploymentIDs {
+		j := i + maxDeploymentIDs
+		if j > len(deploymentIDs) {
+			j = len(deploymentIDs)
+		}
+		batch, err := c.listDeployments(ctx, url, deploymentIDs[i:j])
+		if err != nil {
+			return nil, err
+		}
+		depls = append(depls, batch...)
+	}
+	return depls, nil
+}
+
+func (c *client) listDeployments(
+	ctx context.Context,
+	url string,
+	deploymentIDs []string,
+) ([]*Deployment, error) {
+	l := log.FromContext(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request")
+	}
+	q := req.URL.Query()
+	q.Set("page", "1")
+	q.Set("per_page", strconv.Itoa(len(deploymentIDs)))
+	for _, id := range deploymentIDs {
+		q.Add("id", id)
+	}
+	req.URL.RawQuery = q.Encode()
+
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to submit %s %s", req.Method, req.URL)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	} else if rsp.StatusCode != http.StatusOK {
+		err := errors.Errorf("%s %s request failed with status %v",
+			req.Method, req.URL, rsp.Status)
+		l.Errorf(err.Error())
+		return nil, err
+	}
+
+	dec := json.NewDecoder(rsp.Body)
+	var depls []*Deployment
+	if err = dec.Decode(&depls); err != nil {
+		return nil, errors.Wrap(err, "failed to parse request body")
+	}
+	return depls, nil
+}
+
+func (c *client) ListDeviceDeployments(
+	ctx context.Context,
+	tenantID string,
+	page, perPage int,
+) ([]*DeviceDeployment, error) {
+	l := log.FromContext(ctx)
+
+	url := utils.JoinURL(c.urlBase, urlDeviceDeployments)
+	url = strings.Replace(url, ":tid", tenantID, 1)
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request")
+	}
+	q := req.URL.Query()
+	q.Set("page", strconv.Itoa(page))
+	q.Set("per_page", strconv.Itoa(perPage))
+	req.URL.RawQuery = q.Encode()
+
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to submit %s %s", req.Method, req.URL)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	} else if rsp.StatusCode != http.StatusOK {
+		err := errors.Errorf("%s %s request failed with status %v",
+			req.Method, req.URL, rsp.Status)
+		l.Errorf(err.Error())
+		return nil, err
+	}
+
+	dec := json.NewDecoder(rsp.Body)
+	var devDevs []*DeviceDeployment
+	if err = dec.Decode(&devDevs); err != nil {
+		return nil, errors.Wrap(err, "failed to parse request body")
+	}
+	return devDevs, nil
+}
+
 func (c *client) GetLatestFinishedDeployment(
 	ctx context.Context,
 	tenantID string,
@@ -21,6 +21,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -531,3 +532,215 @@ func TestGetLatestFinishedDeployment(t *testing.T) {
 		})
 	}
 }
+
+func TestListDeployments(t *testing.T) {
+	t.Parallel()
+	ids := make([]string, 25)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i)
+	}
+	testCases := []struct {
+		Name string
+
+		TenantID      string
+		DeploymentIDs []string
+
+		ResponseCode []int
+		ResponseBody []interface{}
+
+		Res   []*Deployment
+		Error error
+	}{{
+		Name: "ok",
+
+		TenantID:      "123456789012345678901234",
+		DeploymentIDs: ids,
+
+		ResponseCode: []int{http.StatusOK, http.StatusOK},
+		ResponseBody: []interface{}{
+			[]*Deployment{{
+				Id: "0",
+				Statistics: &DeploymentStatistics{
+					Status: map[string]int{"success": 2},
+				},
+			}},
+			[]*Deployment{{
+				Id: "24",
+			}},
+		},
+
+		Res: []*Deployment{{
+			Id: "0",
+			Statistics: &DeploymentStatistics{
+				Status: map[string]int{"success": 2},
+			},
+		}, {
+			Id: "24",
+		}},
+	}, {
+		Name: "ok, not found",
+
+		TenantID:      "123456789012345678901234",
+		DeploymentIDs: []string{"1"},
+
+		ResponseCode: []int{http.StatusNotFound},
+		ResponseBody: []interface{}{nil},
+	}, {
+		Name: "error, unexpected status code",
+
+		TenantID:      "123456789012345678901234",
+		DeploymentIDs: []string{"1"},
+
+		ResponseCode: []int{http.StatusInternalServerError},
+		ResponseBody: []interface{}{rest.Error{Err: "something went wrong..."}},
+		Error:        errors.New(`^GET .+ request failed with status 500`),
+	}, {
+		Name: "error, invalid response schema",
+
+		TenantID:      "123456789012345678901234",
+		DeploymentIDs: []string{"1"},
+
+		ResponseCode: []int{http.StatusOK},
+		ResponseBody: []interface{}{"bad response"},
+		Error:        errors.New("failed to parse request body"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			rspChan := make(chan *http.Response, len(tc.ResponseCode))
+			reqChan := make(chan *http.Request, len(tc.ResponseCode))
+			srv := newTestServer(t, rspChan, reqChan)
+			defer srv.Close()
+
+			client := NewClient(srv.URL)
+
+			for i, code := range tc.ResponseCode {
+				rsp := &http.Response{
+					StatusCode: code,
+				}
+				if tc.ResponseBody[i] != nil {
+					b, _ := json.Marshal(tc.ResponseBody[i])
+					rsp.Body = io.NopCloser(bytes.NewReader(b))
+				}
+				rspChan <- rsp
+			}
+			depls, err := client.ListDeployments(context.Background(),
+				tc.TenantID, tc.DeploymentIDs)
+
+			var requested []string
+			for range tc.ResponseCode {
+				req := <-reqChan
+				assert.Equal(t,
+					"/api/internal/v1/deployments/tenants/"+tc.TenantID+"/deployments",
+					req.URL.Path,
+				)
+				requested = append(requested, req.URL.Query()["id"]...)
+			}
+			assert.Equal(t, tc.DeploymentIDs, requested)
+
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t,
+						tc.Error.Error(),
+						err.Error(),
+						"error message does not match expected pattern",
+					)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Res, depls)
+			}
+		})
+	}
+}
+
+func TestListDeviceDeployments(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name string
+
+		TenantID string
+		Page     int
+		PerPage  int
+
+		ResponseCode int
+		ResponseBody interface{}
+
+		Res   []*DeviceDeployment
+		Error error
+	}{{
+		Name: "ok",
+
+		TenantID: "123456789012345678901234",
+		Page:     2,
+		PerPage:  10,
+
+		ResponseCode: http.StatusOK,
+		ResponseBody: []*DeviceDeployment{{
+			ID: "c5e37ef5-160e-401a-aec3-9dbef94855c0",
+		}},
+
+		Res: []*DeviceDeployment{{
+			ID: "c5e37ef5-160e-401a-aec3-9dbef94855c0",
+		}},
+	}, {
+		Name: "ok, not found",
+
+		TenantID: "123456789012345678901234",
+		Page:     1,
+		PerPage:  10,
+
+		ResponseCode: http.StatusNotFound,
+	}, {
+		Name: "error, unexpected status code",
+
+		TenantID: "123456789012345678901234",
+		Page:     1,
+		PerPage:  10,
+
+		ResponseCode: http.StatusInternalServerError,
+		ResponseBody: rest.Error{Err: "something went wrong..."},
+		Error:        errors.New(`^GET .+ request failed with status 500`),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			rspChan := make(chan *http.Response, 1)
+			reqChan := make(chan *http.Request, 1)
+			srv := newTestServer(t, rspChan, reqChan)
+			defer srv.Close()
+
+			client := NewClient(srv.URL)
+
+			rsp := &http.Response{
+				StatusCode: tc.ResponseCode,
+			}
+			if tc.ResponseBody != nil {
+				b, _ := json.Marshal(tc.ResponseBody)
+				rsp.Body = io.NopCloser(bytes.NewReader(b))
+			}
+			rspChan <- rsp
+			devs, err := client.ListDeviceDeployments(context.Background(),
+				tc.TenantID, tc.Page, tc.PerPage)
+
+			req := <-reqChan
+			assert.Equal(t, strconv.Itoa(tc.Page), req.URL.Query().Get("page"))
+			assert.Equal(t, strconv.Itoa(tc.PerPage), req.URL.Query().Get("per_page"))
+
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t,
+						tc.Error.Error(),
+						err.Error(),
+						"error message does not match expected pattern",
+					)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Res, devs)
+			}
+		})
+	}
+}
@@ -73,3 +73,49 @@ func (_m *Client) GetLatestFinishedDeployment(ctx context.Context, tenantID stri
 
 	return r0, r1
 }
+
+// ListDeployments provides a mock function with given fields: ctx, tenantID, deploymentIDs
+func (_m *Client) ListDeployments(ctx context.Context, tenantID string, deploymentIDs []string) ([]*deployments.Deployment, error) {
+	ret := _m.Called(ctx, tenantID, deploymentIDs)
+
+	var r0 []*deployments.Deployment
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) []*deployments.Deployment); ok {
+		r0 = rf(ctx, tenantID, deploymentIDs)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*deployments.Deployment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string) error); ok {
+		r1 = rf(ctx, tenantID, deploymentIDs)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListDeviceDeployments provides a mock function with given fields: ctx, tenantID, page, perPage
+func (_m *Client) ListDeviceDeployments(ctx context.Context, tenantID string, page int, perPage int) ([]*deployments.DeviceDeployment, error) {
+	ret := _m.Called(ctx, tenantID, page, perPage)
+
+	var r0 []*deployments.DeviceDeployment
+	if rf, ok := ret.Get(0).(func(context.Context, string, int, int) []*deployments.DeviceDeployment); ok {
+		r0 = rf(ctx, tenantID, page, perPage)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*deployments.DeviceDeployment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int, int) error); ok {
+		r1 = rf(ctx, tenantID, page, perPage)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
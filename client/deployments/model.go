@@ -16,6 +16,9 @@ package deployments
 
 import "time"
 
+// DeviceDeploymentStatusFailure is the status of failed device deployments
+const DeviceDeploymentStatusFailure = "failure"
+
 // DeviceDeployment stores a device deployment
 type DeviceDeployment struct {
 	ID         string      `json:"id"`
@@ -47,6 +50,22 @@ type Deployment struct {
 	DeviceList         []string                 `json:"device_list"`
 	Type               string                   `json:"type,omitempty"`
 	AutogenerateDelta  bool                     `json:"autogenerate_delta,omitempty"`
+	Statistics         *DeploymentStatistics    `json:"statistics,omitempty"`
+	Phases             []DeploymentPhase        `json:"phases,omitempty"`
+}
+
+// DeploymentStatistics contains the device counts of a deployment
+type DeploymentStatistics struct {
+	// Status is the number of devices by device deployment status
+	Status map[string]int `json:"status"`
+}
+
+// DeploymentPhase describes a phase of a phased deployment
+type DeploymentPhase struct {
+	Id          string     `json:"id"`
+	BatchSize   int        `json:"batch_size"`
+	StartTs     *time.Time `json:"start_ts,omitempty"`
+	DeviceCount int        `json:"device_count"`
 }
 
 // Device contains the device-specific information for a device deployment
@@ -98,6 +117,10 @@ type GetLastDeviceDeploymentRsp struct {
 type LastDeviceDeployment struct {
 	// Device id
 	DeviceID string `json:"device_id"`
+	// Device deployment id
+	DeviceDeploymentID string `json:"device_deployment_id,omitempty"`
+	// Deployment id
+	DeploymentID string `json:"deployment_id,omitempty"`
 	// Status
 	DeviceDeploymentStatus string `json:"device_deployment_status"`
 }
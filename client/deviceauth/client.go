@@ -25,6 +25,7 @@ import (
 
 	"github.com/mendersoftware/go-lib-micro/log"
 
+	"github.com/mendersoftware/reporting/metrics"
 	"github.com/mendersoftware/reporting/model"
 	"github.com/mendersoftware/reporting/utils"
 )
@@ -52,7 +53,7 @@ type client struct {
 
 func NewClient(urlBase string) Client {
 	return &client{
-		client:  &http.Client{},
+		client:  &http.Client{Transport: metrics.NewTransport(model.ServiceDeviceauth, nil)},
 		urlBase: urlBase,
 	}
 }
@@ -0,0 +1,109 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package devicemonitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/reporting/metrics"
+	"github.com/mendersoftware/reporting/model"
+	"github.com/mendersoftware/reporting/utils"
+)
+
+const (
+	urlLatestAlerts = "/api/internal/v1/devicemonitor/tenants/:tid/alerts/latest"
+	defaultTimeout  = 10 * time.Second
+)
+
+//go:generate ../../x/mockgen.sh
+type Client interface {
+	// GetLatestAlerts returns the latest alert for each monitored service
+	// of the given devices, grouped by device ID
+	GetLatestAlerts(
+		ctx context.Context,
+		tid string,
+		deviceIDs []string,
+	) (map[string][]Alert, error)
+}
+
+type client struct {
+	client  *http.Client
+	urlBase string
+}
+
+func NewClient(urlBase string) Client {
+	return &client{
+		client:  &http.Client{Transport: metrics.NewTransport(model.ServiceMonitor, nil)},
+		urlBase: urlBase,
+	}
+}
+
+func (c *client) GetLatestAlerts(
+	ctx context.Context,
+	tid string,
+	deviceIDs []string,
+) (map[string][]Alert, error) {
+	l := log.FromContext(ctx)
+
+	url := utils.JoinURL(c.urlBase, urlLatestAlerts)
+	url = strings.Replace(url, ":tid", tid, 1)
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request")
+	}
+
+	q := req.URL.Query()
+	for _, deviceID := range deviceIDs {
+		q.Add("device_id", deviceID)
+	}
+	req.URL.RawQuery = q.Encode()
+
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to submit %s %s", req.Method, req.URL)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		err := errors.Errorf("%s %s request failed with status %v",
+			req.Method, req.URL, rsp.Status)
+		l.Errorf(err.Error())
+		return nil, err
+	}
+
+	dec := json.NewDecoder(rsp.Body)
+	var alerts []Alert
+	if err = dec.Decode(&alerts); err != nil {
+		return nil, errors.Wrap(err, "failed to parse request body")
+	}
+
+	devices := make(map[string][]Alert, len(deviceIDs))
+	for _, alert := range alerts {
+		devices[alert.DeviceID] = append(devices[alert.DeviceID], alert)
+	}
+	return devices, nil
+}
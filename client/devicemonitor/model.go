@@ -0,0 +1,48 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package devicemonitor
+
+import (
+	"time"
+)
+
+const (
+	AlertLevelOK       = "OK"
+	AlertLevelWarning  = "WARNING"
+	AlertLevelCritical = "CRITICAL"
+)
+
+// Alert is the latest alert raised by a device for a monitored service
+type Alert struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	DeviceID  string       `json:"device_id"`
+	Level     string       `json:"level"`
+	Subject   AlertSubject `json:"subject"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// AlertSubject describes the monitored service the alert refers to
+type AlertSubject struct {
+	Name    string                 `json:"name"`
+	Type    string                 `json:"type"`
+	Status  string                 `json:"status"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Open returns true if the alert has not been cleared yet
+func (a Alert) Open() bool {
+	return a.Level != AlertLevelOK
+}
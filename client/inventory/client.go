@@ -25,6 +25,8 @@ import (
 
 	"github.com/mendersoftware/go-lib-micro/log"
 
+	"github.com/mendersoftware/reporting/metrics"
+	"github.com/mendersoftware/reporting/model"
 	"github.com/mendersoftware/reporting/utils"
 )
 
@@ -38,6 +40,8 @@ const (
 type Client interface {
 	//GetDevices uses the search endpoint to get devices just by ids (not filters)
 	GetDevices(ctx context.Context, tid string, deviceIDs []string) ([]Device, error)
+	//ListDevices uses the search endpoint to get a page of all the tenant's devices
+	ListDevices(ctx context.Context, tid string, page, perPage int) ([]Device, error)
 }
 
 type client struct {
@@ -47,7 +51,7 @@ type client struct {
 
 func NewClient(urlBase string) Client {
 	return &client{
-		client:  &http.Client{},
+		client:  &http.Client{Transport: metrics.NewTransport(model.ServiceInventory, nil)},
 		urlBase: urlBase,
 	}
 }
@@ -57,14 +61,32 @@ func (c *client) GetDevices(
 	tid string,
 	deviceIDs []string,
 ) ([]Device, error) {
-	l := log.FromContext(ctx)
-
-	perPage := uint(len(deviceIDs))
 	getReq := &GetDevsReq{
 		DeviceIDs: deviceIDs,
 		Page:      defaultPage,
-		PerPage:   perPage,
+		PerPage:   uint(len(deviceIDs)),
 	}
+	return c.search(ctx, tid, getReq)
+}
+
+func (c *client) ListDevices(
+	ctx context.Context,
+	tid string,
+	page, perPage int,
+) ([]Device, error) {
+	getReq := &GetDevsReq{
+		Page:    uint(page),
+		PerPage: uint(perPage),
+	}
+	return c.search(ctx, tid, getReq)
+}
+
+func (c *client) search(
+	ctx context.Context,
+	tid string,
+	getReq *GetDevsReq,
+) ([]Device, error) {
+	l := log.FromContext(ctx)
 
 	body, err := json.Marshal(getReq)
 	if err != nil {
@@ -211,3 +211,87 @@ func TestGetDevices(t *testing.T) {
 		})
 	}
 }
+
+func TestListDevices(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name string
+
+		TenantID string
+		Page     int
+		PerPage  int
+
+		ResponseCode int
+		ResponseBody interface{}
+
+		Error error
+	}{{
+		Name: "ok",
+
+		TenantID: "123456789012345678901234",
+		Page:     2,
+		PerPage:  1,
+
+		ResponseCode: http.StatusOK,
+		ResponseBody: []Device{{
+			ID: DeviceID("9acfe595-78ff-456a-843a-0fa08bfd7c7a"),
+			Attributes: DeviceAttributes{{
+				Name:  "foo",
+				Value: "bar",
+				Scope: "baz",
+			}},
+			UpdatedTs: time.Now().Add(-time.Minute).UTC().Round(0),
+		}},
+	}, {
+		Name: "error, unexpected status code",
+
+		TenantID: "123456789012345678901234",
+		Page:     1,
+		PerPage:  20,
+
+		ResponseCode: http.StatusInternalServerError,
+		ResponseBody: rest.Error{Err: "something went wrong..."},
+		Error:        errors.New(`^POST [A-Za-z:0-9/\.]+ request failed with status 500`),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			rspChan := make(chan *http.Response, 1)
+			reqChan := make(chan *http.Request, 1)
+			srv := newTestServer(rspChan, reqChan)
+			defer srv.Close()
+
+			client := NewClient(srv.URL)
+
+			b, _ := json.Marshal(tc.ResponseBody)
+			rspChan <- &http.Response{
+				StatusCode: tc.ResponseCode,
+				Body:       io.NopCloser(bytes.NewReader(b)),
+			}
+			devs, err := client.ListDevices(context.Background(),
+				tc.TenantID, tc.Page, tc.PerPage)
+
+			req := <-reqChan
+			var getReq GetDevsReq
+			_ = json.NewDecoder(req.Body).Decode(&getReq)
+			assert.Equal(t, GetDevsReq{
+				Page:    uint(tc.Page),
+				PerPage: uint(tc.PerPage),
+			}, getReq)
+
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t,
+						tc.Error.Error(),
+						err.Error(),
+						"error message does not match expected pattern",
+					)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.ResponseBody, devs)
+			}
+		})
+	}
+}
@@ -51,3 +51,26 @@ func (_m *Client) GetDevices(ctx context.Context, tid string, deviceIDs []string
 
 	return r0, r1
 }
+
+// ListDevices provides a mock function with given fields: ctx, tid, page, perPage
+func (_m *Client) ListDevices(ctx context.Context, tid string, page int, perPage int) ([]inventory.Device, error) {
+	ret := _m.Called(ctx, tid, page, perPage)
+
+	var r0 []inventory.Device
+	if rf, ok := ret.Get(0).(func(context.Context, string, int, int) []inventory.Device); ok {
+		r0 = rf(ctx, tid, page, perPage)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]inventory.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int, int) error); ok {
+		r1 = rf(ctx, tid, page, perPage)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -16,7 +16,7 @@ package inventory
 // GetDevsReq is a stripped down inventory search query
 // default max 20 devices
 type GetDevsReq struct {
-	DeviceIDs []string `json:"device_ids"`
+	DeviceIDs []string `json:"device_ids,omitempty"`
 	Page      uint     `json:"page"`
 	PerPage   uint     `json:"per_page"`
 }
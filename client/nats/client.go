@@ -18,11 +18,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/mendersoftware/go-lib-micro/log"
 	"github.com/nats-io/nats.go"
 
+	"github.com/mendersoftware/reporting/metrics"
 	"github.com/mendersoftware/reporting/model"
 )
 
@@ -31,15 +34,27 @@ const (
 	reconnectBufSize = 10 * 1024 * 1024
 	// Set reconnect interval to 1 second
 	reconnectWaitTimeSeconds = 1 * time.Second
-	// Set the number of redeliveries for a message
+	// Set the number of redeliveries for a message; a message which is
+	// not acknowledged within the ack wait for as many times is dropped
 	maxRedeliverCount = 3
-	// Set the number of inflight messages; setting it to 1 we explicitly
-	// tell the NATS server that we want to process jobs serially, one by one
-	maxAckPending = 10
-	// Set the ACK wait
-	ackWaitSeconds = 30 * time.Second
+	// MaxAckPending is the number of inflight messages; messages are
+	// acknowledged only after the jobs have been indexed, so this is also
+	// the maximum number of jobs held by all the indexers, buffered, queued
+	// or being processed. The indexers serve the tenants fairly within this
+	// window only: a tenant publishing more jobs at once fills it, and the
+	// jobs of the other tenants wait for enough of them to be processed
+	MaxAckPending = 10000
+	// AckWait is the time the server waits for the acknowledgement of a
+	// message before redelivering it
+	AckWait = 30 * time.Second
 
 	replicas = 2
+
+	// Set the default time to wait for a fetch batch to fill up
+	defaultFetchMaxWait = 5 * time.Second
+	// Set the time to wait for the acknowledgements of the messages
+	// published asynchronously
+	publishAckTimeout = 5 * time.Second
 )
 
 var (
@@ -50,14 +65,40 @@ var (
 
 type UnsubscribeFunc func() error
 
+// SubscribeOptions configures a JetStream pull subscription
+type SubscribeOptions struct {
+	// DeadLetterSubject is the subject the jobs which can't be processed
+	// are published to; empty disables dead-lettering
+	DeadLetterSubject string
+	// FetchBatchSize is the maximum number of messages fetched at once
+	FetchBatchSize int
+	// FetchMaxWait is the maximum time to wait for a fetch batch to fill up
+	FetchMaxWait time.Duration
+	// Filter selects the jobs delivered to the channel, if set: the other
+	// jobs are acknowledged right away, as another consumer processes them.
+	// It is called with a nil job for the messages which can't be decoded
+	Filter func(job *model.Job) bool
+}
+
 // Client is the nats client
 //
 //go:generate ../../x/mockgen.sh
 type Client interface {
 	Close()
 	IsConnected() bool
-	JetStreamSubscribe(ctx context.Context, sub, dur string, q chan model.Job) error
+	IsSubscribed() bool
+	Flush(ctx context.Context) error
+	JetStreamSubscribe(
+		ctx context.Context,
+		sub, dur string,
+		opts SubscribeOptions,
+		q chan model.Job,
+	) error
 	JetStreamPublish(string, []byte) error
+	JetStreamPublishBatch(ctx context.Context, subj string, msgs [][]byte) []error
+	JetStreamDeadLetters(ctx context.Context, dlq string) ([]model.DeadLetter, error)
+	JetStreamDeleteDeadLetter(ctx context.Context, dlq string, seq uint64) error
+	JetStreamPurgeDeadLetters(ctx context.Context, dlq string) error
 	Migrate(ctx context.Context, sub, dur string, recreate bool) error
 }
 
@@ -83,6 +124,8 @@ func NewClient(url string) (Client, error) {
 type client struct {
 	nats *nats.Conn
 	js   nats.JetStreamContext
+	// subscriptions is the number of running JetStream fetch loops
+	subscriptions int32
 }
 
 // Close closes the connection to nats
@@ -95,15 +138,25 @@ func (c *client) IsConnected() bool {
 	return c.nats.IsConnected()
 }
 
+// Flush sends the pending acknowledgements and messages to the server
+func (c *client) Flush(ctx context.Context) error {
+	return c.nats.FlushWithContext(ctx)
+}
+
+// IsSubscribed returns true if a JetStream pull subscription is running
+func (c *client) IsSubscribed() bool {
+	return atomic.LoadInt32(&c.subscriptions) > 0
+}
+
 func (c *client) Migrate(ctx context.Context, sub, dur string, recreate bool) error {
 	cfg := &nats.ConsumerConfig{
 		Name:          dur,
 		Durable:       dur,
-		Description:   "reporting/v2", // pull mode
+		Description:   "reporting/v3", // pull mode, deferred ack
 		FilterSubject: sub,
 		AckPolicy:     nats.AckExplicitPolicy,
-		AckWait:       ackWaitSeconds,
-		MaxAckPending: maxAckPending,
+		AckWait:       AckWait,
+		MaxAckPending: MaxAckPending,
 		MaxDeliver:    maxRedeliverCount,
 		Replicas:      replicas,
 	}
@@ -131,16 +184,31 @@ func (c *client) Migrate(ctx context.Context, sub, dur string, recreate bool) er
 		}
 		l.Info("recreating consumer configuration")
 		_, err = c.js.AddConsumer(stream, cfg)
+	} else if info.Config.MaxAckPending != cfg.MaxAckPending {
+		// the window can be updated in place, without redelivering the jobs
+		_, err = c.js.UpdateConsumer(stream, cfg)
 	}
 	return err
 }
 
-// JetStreamSubscribe subscribes to messages from the given subject with a durable subscriber
+// JetStreamSubscribe subscribes to messages from the given subject with a durable subscriber;
+// the messages are fetched in batches, and the jobs which can't be processed are published
+// to the dead-letter subject, if not empty
 func (c *client) JetStreamSubscribe(
 	ctx context.Context,
 	subj, durable string,
+	opts SubscribeOptions,
 	q chan model.Job,
 ) error {
+	dlq := opts.DeadLetterSubject
+	batchSize := opts.FetchBatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	maxWait := opts.FetchMaxWait
+	if maxWait <= 0 {
+		maxWait = defaultFetchMaxWait
+	}
 	if q == nil {
 		return errors.New("nats: nil subscription channel")
 	}
@@ -156,38 +224,51 @@ func (c *client) JetStreamSubscribe(
 		}
 		return err
 	}
+	atomic.AddInt32(&c.subscriptions, 1)
 	go func() (err error) {
 		l := log.FromContext(ctx)
 		defer func() {
+			atomic.AddInt32(&c.subscriptions, -1)
 			_ = sub.Unsubscribe()
 			if err != nil {
 				l.Error(err)
 			}
 		}()
-		opt := nats.Context(ctx)
 		done := ctx.Done()
 		var msgs []*nats.Msg
 		for {
-			msgs, err = sub.Fetch(1, opt)
+			fetchCtx, cancel := context.WithTimeout(ctx, maxWait)
+			msgs, err = sub.Fetch(batchSize, nats.Context(fetchCtx))
+			cancel()
 			if err != nil {
-				if err == context.DeadlineExceeded {
+				if err == context.DeadlineExceeded || err == nats.ErrTimeout {
 					continue
 				}
 				close(q)
 				return err
 			}
 			for _, msg := range msgs {
-				var job model.Job
-				err = msg.Ack(opt)
-				if err != nil {
-					close(q)
-					return err
+				if meta, err := msg.Metadata(); err == nil {
+					metrics.NatsPending.Set(float64(meta.NumPending))
 				}
+				var job model.Job
 				err = json.Unmarshal(msg.Data, &job)
-				if err != nil {
-					close(q)
-					return err
+				if err != nil && opts.Filter != nil && !opts.Filter(nil) {
+					skip(ctx, msg)
+					continue
+				} else if err != nil {
+					l.Errorf("failed to decode the job: %s", err)
+					m := newMessage(c.js, msg, nil, dlq)
+					if err = m.DeadLetter(ctx, err); err != nil {
+						l.Error(err)
+					}
+					continue
 				}
+				if opts.Filter != nil && !opts.Filter(&job) {
+					skip(ctx, msg)
+					continue
+				}
+				job.Acknowledger = newMessage(c.js, msg, &job, dlq)
 				select {
 				case q <- job:
 
@@ -202,8 +283,207 @@ func (c *client) JetStreamSubscribe(
 	return nil
 }
 
+// skip acknowledges a message filtered out of the subscription; if the
+// acknowledgement is lost, the message is redelivered and skipped again
+func skip(ctx context.Context, msg *nats.Msg) {
+	if err := msg.Ack(); err != nil {
+		log.FromContext(ctx).Warnf("failed to acknowledge a skipped message: %s", err)
+	}
+}
+
+// jsMsg is the subset of the JetStream message methods used to settle it
+type jsMsg interface {
+	Ack(opts ...nats.AckOpt) error
+	NakWithDelay(delay time.Duration, opts ...nats.AckOpt) error
+	Term(opts ...nats.AckOpt) error
+	Metadata() (*nats.MsgMetadata, error)
+}
+
+// jsPublisher publishes messages to JetStream
+type jsPublisher interface {
+	Publish(subj string, data []byte, opts ...nats.PubOpt) (*nats.PubAck, error)
+}
+
+// message acknowledges the job received with the wrapped JetStream message
+type message struct {
+	pub  jsPublisher
+	msg  jsMsg
+	data []byte
+	job  *model.Job
+	dlq  string
+}
+
+func newMessage(pub jsPublisher, msg *nats.Msg, job *model.Job, dlq string) *message {
+	return &message{
+		pub:  pub,
+		msg:  msg,
+		data: msg.Data,
+		job:  job,
+		dlq:  dlq,
+	}
+}
+
+// Ack acknowledges the message asynchronously; the acknowledgements are
+// sent to the server in bulk on Flush
+func (m *message) Ack(ctx context.Context) error {
+	return settled(metrics.ResultAck, m.msg.Ack())
+}
+
+func (m *message) Nak(ctx context.Context, delay time.Duration, cause error) error {
+	meta, err := m.msg.Metadata()
+	if err == nil && meta.NumDelivered >= maxRedeliverCount {
+		return m.DeadLetter(ctx, cause)
+	}
+	return settled(metrics.ResultNak, m.msg.NakWithDelay(delay))
+}
+
+// DeadLetter publishes the job to the dead-letter subject and terminates
+// the message, so that it won't be redelivered
+func (m *message) DeadLetter(ctx context.Context, cause error) error {
+	if m.dlq != "" {
+		letter := model.DeadLetter{
+			Job:       m.job,
+			Timestamp: time.Now(),
+		}
+		if cause != nil {
+			letter.Error = cause.Error()
+		}
+		if m.job == nil {
+			letter.Data = m.data
+		}
+		if meta, err := m.msg.Metadata(); err == nil {
+			letter.Attempts = meta.NumDelivered
+		}
+		data, err := json.Marshal(letter)
+		if err != nil {
+			return err
+		}
+		_, err = m.pub.Publish(m.dlq, data, nats.Context(ctx))
+		if err != nil {
+			return settled(metrics.ResultDeadLetter,
+				fmt.Errorf("failed to publish the dead letter: %w", err))
+		}
+	}
+	return settled(metrics.ResultDeadLetter, m.msg.Term())
+}
+
+// settled counts the settled message with the given result
+func settled(result string, err error) error {
+	if err != nil {
+		result = metrics.ResultError
+	}
+	metrics.NatsAcks.WithLabelValues(result).Inc()
+	return err
+}
+
 // JetStreamPublish publishes a message to the given subject
 func (c *client) JetStreamPublish(subj string, data []byte) error {
 	_, err := c.js.Publish(subj, data)
 	return err
 }
+
+// JetStreamPublishBatch publishes the messages to the given subject without
+// waiting for each acknowledgement, then waits for all of them; it returns
+// the error of each message, nil if it was published
+func (c *client) JetStreamPublishBatch(
+	ctx context.Context,
+	subj string,
+	msgs [][]byte,
+) []error {
+	ctx, cancel := context.WithTimeout(ctx, publishAckTimeout)
+	defer cancel()
+	errs := make([]error, len(msgs))
+	futures := make([]nats.PubAckFuture, len(msgs))
+	for i, data := range msgs {
+		futures[i], errs[i] = c.js.PublishAsync(subj, data)
+	}
+	for i, future := range futures {
+		if future == nil {
+			continue
+		}
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			errs[i] = err
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+		}
+	}
+	return errs
+}
+
+// JetStreamDeadLetters returns the dead letters published to the dlq subject
+func (c *client) JetStreamDeadLetters(
+	ctx context.Context,
+	dlq string,
+) ([]model.DeadLetter, error) {
+	stream, err := c.js.StreamNameBySubject(dlq)
+	if err != nil {
+		return nil, err
+	}
+	info, err := c.js.StreamInfo(stream, &nats.StreamInfoRequest{
+		SubjectsFilter: dlq,
+	}, nats.Context(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if info.State.Subjects[dlq] == 0 {
+		return nil, nil
+	}
+
+	sub, err := c.js.SubscribeSync(dlq,
+		nats.OrderedConsumer(),
+		nats.DeliverAll(),
+		nats.Context(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	letters := make([]model.DeadLetter, 0, info.State.Subjects[dlq])
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		meta, err := msg.Metadata()
+		if err != nil {
+			return nil, err
+		}
+		var letter model.DeadLetter
+		if err := json.Unmarshal(msg.Data, &letter); err != nil {
+			letter = model.DeadLetter{
+				Data:      msg.Data,
+				Error:     "failed to decode the dead letter: " + err.Error(),
+				Timestamp: meta.Timestamp,
+			}
+		}
+		letter.Sequence = meta.Sequence.Stream
+		letters = append(letters, letter)
+		if meta.NumPending == 0 {
+			break
+		}
+	}
+	return letters, nil
+}
+
+// JetStreamDeleteDeadLetter deletes the dead letter with the given sequence number
+func (c *client) JetStreamDeleteDeadLetter(ctx context.Context, dlq string, seq uint64) error {
+	stream, err := c.js.StreamNameBySubject(dlq)
+	if err != nil {
+		return err
+	}
+	return c.js.DeleteMsg(stream, seq, nats.Context(ctx))
+}
+
+// JetStreamPurgeDeadLetters deletes all the dead letters published to the dlq subject
+func (c *client) JetStreamPurgeDeadLetters(ctx context.Context, dlq string) error {
+	stream, err := c.js.StreamNameBySubject(dlq)
+	if err != nil {
+		return err
+	}
+	return c.js.PurgeStream(stream, &nats.StreamPurgeRequest{
+		Subject: dlq,
+	})
+}
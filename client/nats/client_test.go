@@ -0,0 +1,233 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+type testMsg struct {
+	delivered uint64
+	err       error
+
+	acked    bool
+	nakDelay time.Duration
+	naked    bool
+	termed   bool
+}
+
+func (m *testMsg) Ack(opts ...nats.AckOpt) error {
+	m.acked = true
+	return m.err
+}
+
+func (m *testMsg) NakWithDelay(delay time.Duration, opts ...nats.AckOpt) error {
+	m.naked = true
+	m.nakDelay = delay
+	return m.err
+}
+
+func (m *testMsg) Term(opts ...nats.AckOpt) error {
+	m.termed = true
+	return m.err
+}
+
+func (m *testMsg) Metadata() (*nats.MsgMetadata, error) {
+	return &nats.MsgMetadata{NumDelivered: m.delivered}, nil
+}
+
+type testPublisher struct {
+	err error
+
+	subject string
+	letter  *model.DeadLetter
+}
+
+func (p *testPublisher) Publish(
+	subj string,
+	data []byte,
+	opts ...nats.PubOpt,
+) (*nats.PubAck, error) {
+	p.subject = subj
+	p.letter = &model.DeadLetter{}
+	if err := json.Unmarshal(data, p.letter); err != nil {
+		return nil, err
+	}
+	return &nats.PubAck{}, p.err
+}
+
+func TestMessageSettle(t *testing.T) {
+	job := &model.Job{
+		Action:   model.ActionReindex,
+		TenantID: "tenant",
+		ID:       "device",
+	}
+	cause := errors.New("failed to index")
+
+	testCases := map[string]struct {
+		msg    *testMsg
+		pub    *testPublisher
+		job    *model.Job
+		data   []byte
+		dlq    string
+		settle func(context.Context, *message) error
+
+		acked    bool
+		naked    bool
+		termed   bool
+		letter   *model.DeadLetter
+		errMatch string
+	}{
+		"ok, ack": {
+			msg: &testMsg{delivered: 1},
+			job: job,
+			settle: func(ctx context.Context, m *message) error {
+				return m.Ack(ctx)
+			},
+			acked: true,
+		},
+		"ko, ack": {
+			msg: &testMsg{delivered: 1, err: nats.ErrConnectionClosed},
+			job: job,
+			settle: func(ctx context.Context, m *message) error {
+				return m.Ack(ctx)
+			},
+			acked:    true,
+			errMatch: nats.ErrConnectionClosed.Error(),
+		},
+		"ok, nak": {
+			msg: &testMsg{delivered: maxRedeliverCount - 1},
+			job: job,
+			dlq: "dlq",
+			settle: func(ctx context.Context, m *message) error {
+				return m.Nak(ctx, time.Second, cause)
+			},
+			naked: true,
+		},
+		"ok, nak after the last delivery dead-letters the job": {
+			msg: &testMsg{delivered: maxRedeliverCount},
+			job: job,
+			dlq: "dlq",
+			settle: func(ctx context.Context, m *message) error {
+				return m.Nak(ctx, time.Second, cause)
+			},
+			termed: true,
+			letter: &model.DeadLetter{
+				Job:      job,
+				Error:    cause.Error(),
+				Attempts: maxRedeliverCount,
+			},
+		},
+		"ok, dead letter": {
+			msg: &testMsg{delivered: 1},
+			job: job,
+			dlq: "dlq",
+			settle: func(ctx context.Context, m *message) error {
+				return m.DeadLetter(ctx, cause)
+			},
+			termed: true,
+			letter: &model.DeadLetter{
+				Job:      job,
+				Error:    cause.Error(),
+				Attempts: 1,
+			},
+		},
+		"ok, dead letter with the undecodable data": {
+			msg:  &testMsg{delivered: 1},
+			data: []byte("garbage"),
+			dlq:  "dlq",
+			settle: func(ctx context.Context, m *message) error {
+				return m.DeadLetter(ctx, cause)
+			},
+			termed: true,
+			letter: &model.DeadLetter{
+				Data:     []byte("garbage"),
+				Error:    cause.Error(),
+				Attempts: 1,
+			},
+		},
+		"ok, dead-lettering disabled": {
+			msg: &testMsg{delivered: 1},
+			job: job,
+			settle: func(ctx context.Context, m *message) error {
+				return m.DeadLetter(ctx, cause)
+			},
+			termed: true,
+		},
+		"ko, failed to publish the dead letter": {
+			msg: &testMsg{delivered: 1},
+			pub: &testPublisher{err: nats.ErrNoResponders},
+			job: job,
+			dlq: "dlq",
+			settle: func(ctx context.Context, m *message) error {
+				return m.DeadLetter(ctx, cause)
+			},
+			letter: &model.DeadLetter{
+				Job:      job,
+				Error:    cause.Error(),
+				Attempts: 1,
+			},
+			errMatch: "failed to publish the dead letter",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			pub := tc.pub
+			if pub == nil {
+				pub = &testPublisher{}
+			}
+			m := &message{
+				pub:  pub,
+				msg:  tc.msg,
+				data: tc.data,
+				job:  tc.job,
+				dlq:  tc.dlq,
+			}
+			err := tc.settle(context.Background(), m)
+			if tc.errMatch != "" {
+				assert.ErrorContains(t, err, tc.errMatch)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.acked, tc.msg.acked)
+			assert.Equal(t, tc.naked, tc.msg.naked)
+			if tc.naked {
+				assert.Equal(t, time.Second, tc.msg.nakDelay)
+			}
+			assert.Equal(t, tc.termed, tc.msg.termed)
+			if tc.letter == nil {
+				assert.Nil(t, pub.letter)
+				return
+			}
+			if assert.NotNil(t, pub.letter) {
+				assert.Equal(t, tc.dlq, pub.subject)
+				assert.WithinDuration(t, time.Now(), pub.letter.Timestamp, time.Minute)
+				pub.letter.Timestamp = time.Time{}
+				assert.Equal(t, tc.letter, pub.letter)
+			}
+		})
+	}
+}
@@ -20,6 +20,9 @@ import (
 	context "context"
 
 	model "github.com/mendersoftware/reporting/model"
+
+	nats "github.com/mendersoftware/reporting/client/nats"
+
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -33,6 +36,20 @@ func (_m *Client) Close() {
 	_m.Called()
 }
 
+// Flush provides a mock function with given fields: ctx
+func (_m *Client) Flush(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // IsConnected provides a mock function with given fields:
 func (_m *Client) IsConnected() bool {
 	ret := _m.Called()
@@ -47,6 +64,57 @@ func (_m *Client) IsConnected() bool {
 	return r0
 }
 
+// IsSubscribed provides a mock function with given fields:
+func (_m *Client) IsSubscribed() bool {
+	ret := _m.Called()
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func() bool); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
+// JetStreamDeadLetters provides a mock function with given fields: ctx, dlq
+func (_m *Client) JetStreamDeadLetters(ctx context.Context, dlq string) ([]model.DeadLetter, error) {
+	ret := _m.Called(ctx, dlq)
+
+	var r0 []model.DeadLetter
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.DeadLetter); ok {
+		r0 = rf(ctx, dlq)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeadLetter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, dlq)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// JetStreamDeleteDeadLetter provides a mock function with given fields: ctx, dlq, seq
+func (_m *Client) JetStreamDeleteDeadLetter(ctx context.Context, dlq string, seq uint64) error {
+	ret := _m.Called(ctx, dlq, seq)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, uint64) error); ok {
+		r0 = rf(ctx, dlq, seq)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // JetStreamPublish provides a mock function with given fields: _a0, _a1
 func (_m *Client) JetStreamPublish(_a0 string, _a1 []byte) error {
 	ret := _m.Called(_a0, _a1)
@@ -61,13 +129,43 @@ func (_m *Client) JetStreamPublish(_a0 string, _a1 []byte) error {
 	return r0
 }
 
-// JetStreamSubscribe provides a mock function with given fields: ctx, sub, dur, q
-func (_m *Client) JetStreamSubscribe(ctx context.Context, sub string, dur string, q chan model.Job) error {
-	ret := _m.Called(ctx, sub, dur, q)
+// JetStreamPublishBatch provides a mock function with given fields: ctx, subj, msgs
+func (_m *Client) JetStreamPublishBatch(ctx context.Context, subj string, msgs [][]byte) []error {
+	ret := _m.Called(ctx, subj, msgs)
+
+	var r0 []error
+	if rf, ok := ret.Get(0).(func(context.Context, string, [][]byte) []error); ok {
+		r0 = rf(ctx, subj, msgs)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]error)
+		}
+	}
+
+	return r0
+}
+
+// JetStreamPurgeDeadLetters provides a mock function with given fields: ctx, dlq
+func (_m *Client) JetStreamPurgeDeadLetters(ctx context.Context, dlq string) error {
+	ret := _m.Called(ctx, dlq)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, dlq)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// JetStreamSubscribe provides a mock function with given fields: ctx, sub, dur, opts, q
+func (_m *Client) JetStreamSubscribe(ctx context.Context, sub string, dur string, opts nats.SubscribeOptions, q chan model.Job) error {
+	ret := _m.Called(ctx, sub, dur, opts, q)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, chan model.Job) error); ok {
-		r0 = rf(ctx, sub, dur, q)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, nats.SubscribeOptions, chan model.Job) error); ok {
+		r0 = rf(ctx, sub, dur, opts, q)
 	} else {
 		r0 = ret.Error(0)
 	}
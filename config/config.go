@@ -24,11 +24,74 @@ const (
 	// SettingListenDefault is the default value for the listen address
 	SettingListenDefault = ":8080"
 
+	// SettingIndexerListen is the config key for the listen address of the
+	// indexer health and metrics endpoints; empty disables the listener
+	SettingIndexerListen = "indexer_listen"
+	// SettingIndexerListenDefault is the default value for the indexer
+	// listen address
+	SettingIndexerListenDefault = ""
+
 	// SettingOpenSearchAddresses is the config key for the opensearch addresses
 	SettingOpenSearchAddresses = "opensearch_addresses"
 	// SettingOpenSearchAddressesDefault is the default value for the opensearch addresses
 	SettingOpenSearchAddressesDefault = "http://localhost:9200"
 
+	// SettingOpenSearchUsername is the config key for the opensearch basic
+	// authentication username
+	SettingOpenSearchUsername = "opensearch_username"
+
+	// SettingOpenSearchPassword is the config key for the opensearch basic
+	// authentication password
+	SettingOpenSearchPassword = "opensearch_password"
+
+	// SettingOpenSearchCACertificate is the config key for the path to the
+	// PEM bundle of certificate authorities trusted by the opensearch client,
+	// in addition to the system ones
+	SettingOpenSearchCACertificate = "opensearch_ca_certificate"
+
+	// SettingOpenSearchClientCertificate is the config key for the path to
+	// the PEM certificate presented by the opensearch client (mutual TLS)
+	SettingOpenSearchClientCertificate = "opensearch_client_certificate"
+
+	// SettingOpenSearchClientKey is the config key for the path to the PEM
+	// private key of the opensearch client certificate
+	SettingOpenSearchClientKey = "opensearch_client_key"
+
+	// SettingOpenSearchTLSSkipVerify is the config key for skipping the
+	// verification of the opensearch server certificate
+	SettingOpenSearchTLSSkipVerify = "opensearch_tls_skipverify"
+	// SettingOpenSearchTLSSkipVerifyDefault is the default value for skipping
+	// the verification of the opensearch server certificate
+	SettingOpenSearchTLSSkipVerifyDefault = false
+
+	// SettingOpenSearchBulkMaxItems is the config key for the maximum number
+	// of operations in a single bulk request
+	SettingOpenSearchBulkMaxItems = "opensearch_bulk_max_items"
+	// SettingOpenSearchBulkMaxItemsDefault is the default value for the maximum
+	// number of operations in a single bulk request
+	SettingOpenSearchBulkMaxItemsDefault = 1000
+
+	// SettingOpenSearchBulkMaxBytes is the config key for the maximum size, in
+	// bytes, of a single bulk request before compression
+	SettingOpenSearchBulkMaxBytes = "opensearch_bulk_max_bytes"
+	// SettingOpenSearchBulkMaxBytesDefault is the default value for the maximum
+	// size, in bytes, of a single bulk request before compression
+	SettingOpenSearchBulkMaxBytesDefault = 5 << 20
+
+	// SettingOpenSearchBulkConcurrency is the config key for the maximum number
+	// of bulk requests sent concurrently
+	SettingOpenSearchBulkConcurrency = "opensearch_bulk_concurrency"
+	// SettingOpenSearchBulkConcurrencyDefault is the default value for the
+	// maximum number of bulk requests sent concurrently
+	SettingOpenSearchBulkConcurrencyDefault = 2
+
+	// SettingOpenSearchBulkGzip is the config key for compressing the bulk
+	// requests with gzip
+	SettingOpenSearchBulkGzip = "opensearch_bulk_gzip"
+	// SettingOpenSearchBulkGzipDefault is the default value for compressing
+	// the bulk requests with gzip
+	SettingOpenSearchBulkGzipDefault = false
+
 	// SettingOpenSearchDevicesIndexName is the config key for the opensearch devices
 	// index name
 	SettingOpenSearchDevicesIndexName = "opensearch_devices_index_name"
@@ -71,6 +134,55 @@ const (
 	// opensearch deployments index replicas
 	SettingOpenSearchDeploymentsIndexReplicasDefault = 0
 
+	// SettingOpenSearchDeploymentsIndexMonthly is the config key for
+	// partitioning the opensearch deployments index in monthly indices
+	SettingOpenSearchDeploymentsIndexMonthly = "opensearch_deployments_index_monthly"
+	// SettingOpenSearchDeploymentsIndexMonthlyDefault is the default value for
+	// partitioning the opensearch deployments index in monthly indices
+	SettingOpenSearchDeploymentsIndexMonthlyDefault = false
+
+	// SettingOpenSearchDeploymentsRetentionMonths is the config key for the
+	// number of months the monthly deployments indices are kept for
+	SettingOpenSearchDeploymentsRetentionMonths = "opensearch_deployments_retention_months"
+	// SettingOpenSearchDeploymentsRetentionMonthsDefault is the default value
+	// for the deployments retention (0 means forever)
+	SettingOpenSearchDeploymentsRetentionMonthsDefault = 0
+
+	// SettingOpenSearchSummariesIndexName is the config key for the opensearch
+	// deployment summaries index name
+	SettingOpenSearchSummariesIndexName = "opensearch_deployment_summaries_index_name"
+	// SettingOpenSearchSummariesIndexNameDefault is the default value for the
+	// opensearch deployment summaries index name
+	SettingOpenSearchSummariesIndexNameDefault = "deployment_summaries"
+
+	// SettingOpenSearchSummariesIndexShards is the config key for the opensearch
+	// deployment summaries index shards
+	SettingOpenSearchSummariesIndexShards = "opensearch_deployment_summaries_index_shards"
+	// SettingOpenSearchSummariesIndexShardsDefault is the default value for the
+	// opensearch deployment summaries index shards
+	SettingOpenSearchSummariesIndexShardsDefault = 1
+
+	// SettingOpenSearchSummariesIndexReplicas is the config key for the opensearch
+	// deployment summaries index replicas
+	SettingOpenSearchSummariesIndexReplicas = "opensearch_deployment_summaries_index_replicas"
+	// SettingOpenSearchSummariesIndexReplicasDefault is the default value for the
+	// opensearch deployment summaries index replicas
+	SettingOpenSearchSummariesIndexReplicasDefault = 0
+
+	// SettingOpenSearchAliasesRefreshSec is the interval between the reloads
+	// of the physical indices behind the opensearch write aliases
+	SettingOpenSearchAliasesRefreshSec = "opensearch_aliases_refresh_sec"
+	// SettingOpenSearchAliasesRefreshSecDefault is the default value for the
+	// opensearch aliases refresh interval
+	SettingOpenSearchAliasesRefreshSecDefault = 30
+
+	// SettingTenantPlacementRefreshSec is the interval between the reloads of
+	// the placements of the tenants on dedicated indices
+	SettingTenantPlacementRefreshSec = "tenant_placement_refresh_sec"
+	// SettingTenantPlacementRefreshSecDefault is the default value for the
+	// tenant placement refresh interval
+	SettingTenantPlacementRefreshSecDefault = 30
+
 	// SettingDeploymentsAddr is the config key for the deviceauth service address
 	SettingDeploymentsAddr = "deployments_addr"
 	// SettingDeploymentsAddrDefault is the default value for the deployments service address
@@ -81,11 +193,37 @@ const (
 	// SettingDeviceAuthAddrDefault is the default value for the deviceauth service address
 	SettingDeviceAuthAddrDefault = "http://mender-device-auth:8080/"
 
+	// SettingDeviceConnectAddr is the config key for the deviceconnect service address
+	SettingDeviceConnectAddr = "deviceconnect_addr"
+	// SettingDeviceConnectAddrDefault is the default value for the deviceconnect
+	// service address; empty means the connectivity attributes are not indexed
+	SettingDeviceConnectAddrDefault = ""
+
+	// SettingDeviceMonitorAddr is the config key for the devicemonitor service address
+	SettingDeviceMonitorAddr = "devicemonitor_addr"
+	// SettingDeviceMonitorAddrDefault is the default value for the devicemonitor
+	// service address; empty means the monitor attributes are not indexed
+	SettingDeviceMonitorAddrDefault = ""
+
 	// SettingInventoryAddr is the config key for the inventory service address
 	SettingInventoryAddr = "inventory_addr"
 	// SettingInventoryAddrDefault is the default value for the inventory service address
 	SettingInventoryAddrDefault = "http://mender-inventory:8080/"
 
+	// SettingFailedDeploymentsWindowDays is the config key for the number of
+	// days the failed deployments of each device are counted within
+	SettingFailedDeploymentsWindowDays = "failed_deployments_window_days"
+	// SettingFailedDeploymentsWindowDaysDefault is the default value for the number
+	// of days the failed deployments are counted within; zero disables the count
+	SettingFailedDeploymentsWindowDaysDefault = 30
+
+	// SettingDeploymentsDeviceAttributes is the config key for the device
+	// attributes copied onto the deployments at index time
+	SettingDeploymentsDeviceAttributes = "deployments_device_attributes"
+	// SettingDeploymentsDeviceAttributesDefault is the default value for the device
+	// attributes copied onto the deployments at index time
+	SettingDeploymentsDeviceAttributesDefault = ""
+
 	// SettingMongo is the config key for the mongo URL
 	SettingMongo = "mongo_url"
 	// SettingMongoDefault is the default value for the mongo URL
@@ -127,18 +265,46 @@ const (
 	// SettingNatsSubscriberTopicDefault is the default value for the nats subscriber topic name
 	SettingNatsSubscriberTopicDefault = "reporting"
 
-	// SettingNatsSubscriberDurable is the config key for the nats subscriber durable name
+	// SettingNatsSubscriberDurable is the config key for the nats subscriber durable name;
+	// the deployments lane uses a second durable, with the "-deployments" suffix
 	SettingNatsSubscriberDurable = "nats_subscriber_durable"
 	// SettingNatsSubscriberDurableDefault is the default value for the nats subscriber durable
 	// name
 	SettingNatsSubscriberDurableDefault = "reporting"
 
+	// SettingNatsDeadLetterTopic is the config key for the nats topic where the jobs
+	// which can't be processed are published; an empty value disables dead-lettering
+	SettingNatsDeadLetterTopic = "nats_dead_letter_topic"
+	// SettingNatsDeadLetterTopicDefault is the default value for the nats dead-letter
+	// topic name
+	SettingNatsDeadLetterTopicDefault = "reporting-dead-letter"
+
+	// SettingNatsChangeEventsTopic is the config key for the nats topic where the
+	// change events of the indexed documents are published
+	SettingNatsChangeEventsTopic = "nats_change_events_topic"
+	// SettingNatsChangeEventsTopicDefault is the default value for the nats change
+	// events topic; empty disables the change events
+	SettingNatsChangeEventsTopicDefault = ""
+
+	// SettingNatsFetchBatchSize is the config key for the maximum number of messages
+	// fetched from nats at once; zero uses the reindex batch size
+	SettingNatsFetchBatchSize = "nats_fetch_batch_size"
+	// SettingNatsFetchBatchSizeDefault is the default value for the nats fetch batch size
+	SettingNatsFetchBatchSizeDefault = 0
+
+	// SettingNatsFetchMaxWaitMsec is the config key for the maximum time to wait for a
+	// fetch batch to fill up; zero uses the reindex max time
+	SettingNatsFetchMaxWaitMsec = "nats_fetch_max_wait_msec"
+	// SettingNatsFetchMaxWaitMsecDefault is the default value for the nats fetch max wait
+	SettingNatsFetchMaxWaitMsecDefault = 0
+
 	// SettingReindexBatchSize is the num of buffered requests processed together
 	SettingReindexBatchSize        = "reindex_batch_size"
 	SettingReindexBatchSizeDefault = 100
 
 	// SettingWorkerConcurrency defines the number of concurrent worker
-	// threads that exist at the same time (defaults to 10)
+	// threads that exist at the same time, split evenly across the lanes
+	// without their own worker concurrency (defaults to 10)
 	SettingWorkerConcurrency        = "worker_concurrency"
 	SettingWorkerConcurrencyDefault = 10
 
@@ -147,6 +313,42 @@ const (
 	SettingReindexMaxTimeMsec        = "reindex_max_time_msec"
 	SettingReindexMaxTimeMsecDefault = 1000
 
+	// SettingReindexDebounceMsec is the window during which repeated jobs
+	// for the same device or deployment are coalesced (0 disables it); it
+	// must not exceed a third of the NATS ack wait (10 seconds)
+	SettingReindexDebounceMsec        = "reindex_debounce_msec"
+	SettingReindexDebounceMsecDefault = 0
+
+	// SettingReindexDevicesBatchSize, SettingReindexDevicesWorkerConcurrency
+	// and SettingReindexDevicesMaxTimeMsec override the reindex batch size,
+	// worker concurrency and max time for the device jobs (0 means not set)
+	SettingReindexDevicesBatchSize                = "reindex_devices_batch_size"
+	SettingReindexDevicesBatchSizeDefault         = 0
+	SettingReindexDevicesWorkerConcurrency        = "reindex_devices_worker_concurrency"
+	SettingReindexDevicesWorkerConcurrencyDefault = 0
+	SettingReindexDevicesMaxTimeMsec              = "reindex_devices_max_time_msec"
+	SettingReindexDevicesMaxTimeMsecDefault       = 0
+
+	// SettingReindexDeploymentsBatchSize, SettingReindexDeploymentsWorkerConcurrency
+	// and SettingReindexDeploymentsMaxTimeMsec override the reindex batch size,
+	// worker concurrency and max time for the deployment jobs (0 means not set)
+	SettingReindexDeploymentsBatchSize                = "reindex_deployments_batch_size"
+	SettingReindexDeploymentsBatchSizeDefault         = 0
+	SettingReindexDeploymentsWorkerConcurrency        = "reindex_deployments_worker_concurrency"
+	SettingReindexDeploymentsWorkerConcurrencyDefault = 0
+	SettingReindexDeploymentsMaxTimeMsec              = "reindex_deployments_max_time_msec"
+	SettingReindexDeploymentsMaxTimeMsecDefault       = 0
+
+	// SettingReindexTenantQuantum is the number of jobs taken from a tenant
+	// before moving to the next one, when building the worker batches
+	SettingReindexTenantQuantum        = "reindex_tenant_quantum"
+	SettingReindexTenantQuantumDefault = 20
+
+	// SettingReindexTenantMaxInFlight is the maximum number of jobs per
+	// tenant sent to the workers and not yet processed (0 means unlimited)
+	SettingReindexTenantMaxInFlight        = "reindex_tenant_max_in_flight"
+	SettingReindexTenantMaxInFlightDefault = 0
+
 	// SettingDebugLog is the config key for the truning on the debug log
 	SettingDebugLog = "debug_log"
 	// SettingDebugLogDefault is the default value for the debug log enabling
@@ -157,7 +359,14 @@ var (
 	// Defaults are the default configuration settings
 	Defaults = []config.Default{
 		{Key: SettingListen, Value: SettingListenDefault},
+		{Key: SettingIndexerListen, Value: SettingIndexerListenDefault},
 		{Key: SettingOpenSearchAddresses, Value: SettingOpenSearchAddressesDefault},
+		{Key: SettingOpenSearchTLSSkipVerify, Value: SettingOpenSearchTLSSkipVerifyDefault},
+		{Key: SettingOpenSearchBulkMaxItems, Value: SettingOpenSearchBulkMaxItemsDefault},
+		{Key: SettingOpenSearchBulkMaxBytes, Value: SettingOpenSearchBulkMaxBytesDefault},
+		{Key: SettingOpenSearchBulkConcurrency,
+			Value: SettingOpenSearchBulkConcurrencyDefault},
+		{Key: SettingOpenSearchBulkGzip, Value: SettingOpenSearchBulkGzipDefault},
 		{Key: SettingOpenSearchDevicesIndexName,
 			Value: SettingOpenSearchDevicesIndexNameDefault},
 		{Key: SettingOpenSearchDevicesIndexShards,
@@ -170,18 +379,52 @@ var (
 			Value: SettingOpenSearchDeploymentsIndexShardsDefault},
 		{Key: SettingOpenSearchDeploymentsIndexReplicas,
 			Value: SettingOpenSearchDeploymentsIndexReplicasDefault},
+		{Key: SettingOpenSearchDeploymentsIndexMonthly,
+			Value: SettingOpenSearchDeploymentsIndexMonthlyDefault},
+		{Key: SettingOpenSearchDeploymentsRetentionMonths,
+			Value: SettingOpenSearchDeploymentsRetentionMonthsDefault},
+		{Key: SettingOpenSearchSummariesIndexName,
+			Value: SettingOpenSearchSummariesIndexNameDefault},
+		{Key: SettingOpenSearchSummariesIndexShards,
+			Value: SettingOpenSearchSummariesIndexShardsDefault},
+		{Key: SettingOpenSearchSummariesIndexReplicas,
+			Value: SettingOpenSearchSummariesIndexReplicasDefault},
+		{Key: SettingOpenSearchAliasesRefreshSec,
+			Value: SettingOpenSearchAliasesRefreshSecDefault},
+		{Key: SettingTenantPlacementRefreshSec, Value: SettingTenantPlacementRefreshSecDefault},
 		{Key: SettingDebugLog, Value: SettingDebugLogDefault},
 		{Key: SettingDeploymentsAddr, Value: SettingDeploymentsAddrDefault},
 		{Key: SettingDeviceAuthAddr, Value: SettingDeviceAuthAddrDefault},
+		{Key: SettingDeviceConnectAddr, Value: SettingDeviceConnectAddrDefault},
+		{Key: SettingDeviceMonitorAddr, Value: SettingDeviceMonitorAddrDefault},
 		{Key: SettingInventoryAddr, Value: SettingInventoryAddrDefault},
+		{Key: SettingFailedDeploymentsWindowDays, Value: SettingFailedDeploymentsWindowDaysDefault},
+		{Key: SettingDeploymentsDeviceAttributes, Value: SettingDeploymentsDeviceAttributesDefault},
 		{Key: SettingMongo, Value: SettingMongoDefault},
 		{Key: SettingDbName, Value: SettingDbNameDefault},
 		{Key: SettingNatsURI, Value: SettingNatsURIDefault},
 		{Key: SettingNatsStreamName, Value: SettingNatsStreamNameDefault},
 		{Key: SettingNatsSubscriberTopic, Value: SettingNatsSubscriberTopicDefault},
 		{Key: SettingNatsSubscriberDurable, Value: SettingNatsSubscriberDurableDefault},
+		{Key: SettingNatsDeadLetterTopic, Value: SettingNatsDeadLetterTopicDefault},
+		{Key: SettingNatsChangeEventsTopic, Value: SettingNatsChangeEventsTopicDefault},
+		{Key: SettingNatsFetchBatchSize, Value: SettingNatsFetchBatchSizeDefault},
+		{Key: SettingNatsFetchMaxWaitMsec, Value: SettingNatsFetchMaxWaitMsecDefault},
 		{Key: SettingReindexMaxTimeMsec, Value: SettingReindexMaxTimeMsecDefault},
 		{Key: SettingReindexBatchSize, Value: SettingReindexBatchSizeDefault},
 		{Key: SettingWorkerConcurrency, Value: SettingWorkerConcurrencyDefault},
+		{Key: SettingReindexDebounceMsec, Value: SettingReindexDebounceMsecDefault},
+		{Key: SettingReindexDevicesBatchSize, Value: SettingReindexDevicesBatchSizeDefault},
+		{Key: SettingReindexDevicesWorkerConcurrency,
+			Value: SettingReindexDevicesWorkerConcurrencyDefault},
+		{Key: SettingReindexDevicesMaxTimeMsec, Value: SettingReindexDevicesMaxTimeMsecDefault},
+		{Key: SettingReindexDeploymentsBatchSize,
+			Value: SettingReindexDeploymentsBatchSizeDefault},
+		{Key: SettingReindexDeploymentsWorkerConcurrency,
+			Value: SettingReindexDeploymentsWorkerConcurrencyDefault},
+		{Key: SettingReindexDeploymentsMaxTimeMsec,
+			Value: SettingReindexDeploymentsMaxTimeMsecDefault},
+		{Key: SettingReindexTenantQuantum, Value: SettingReindexTenantQuantumDefault},
+		{Key: SettingReindexTenantMaxInFlight, Value: SettingReindexTenantMaxInFlightDefault},
 	}
 )
@@ -16,6 +16,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"os"
@@ -30,9 +31,12 @@ import (
 	mlog "github.com/mendersoftware/go-lib-micro/log"
 
 	"github.com/mendersoftware/reporting/app/indexer"
+	"github.com/mendersoftware/reporting/app/lease"
+	"github.com/mendersoftware/reporting/app/placement"
 	"github.com/mendersoftware/reporting/app/server"
 	"github.com/mendersoftware/reporting/client/nats"
 	dconfig "github.com/mendersoftware/reporting/config"
+	"github.com/mendersoftware/reporting/model"
 	"github.com/mendersoftware/reporting/store"
 	"github.com/mendersoftware/reporting/store/mongo"
 	"github.com/mendersoftware/reporting/store/opensearch"
@@ -41,6 +45,11 @@ import (
 const (
 	opensearchMaxWaitingTime      = 300
 	opensearchRetryDelayInSeconds = 1
+
+	// migrationsLease is the lease held while running the migrations, so
+	// that the processes started with --automigrate run them one at a time
+	migrationsLease    = "migrations"
+	migrationsLeaseTTL = time.Minute
 )
 
 func main() {
@@ -88,6 +97,109 @@ func doMain(args []string) int {
 				Usage:  "Run the migrations",
 				Action: cmdMigrate,
 			},
+			{
+				Name:   "reindex",
+				Usage:  "Reindex the devices and deployments from the source services",
+				Action: cmdReindex,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name: "tenant",
+						Usage: "Reindex only the tenant with the given `ID`; " +
+							"can be repeated. Defaults to all the tenants with a " +
+							"mapping, that is indexed at least once.",
+					},
+				},
+			},
+			{
+				Name: "verify",
+				Usage: "Compare the indexed devices and deployments with the source " +
+					"services, and print the drift report of each tenant",
+				Action: cmdVerify,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name: "tenant",
+						Usage: "Verify only the tenant with the given `ID`; " +
+							"can be repeated. Defaults to all the tenants with a " +
+							"mapping, that is indexed at least once.",
+					},
+					&cli.IntFlag{
+						Name: "sample",
+						Usage: "Compare a random sample of `N` indexed documents " +
+							"per index, rather than scanning the source services.",
+					},
+					&cli.BoolFlag{
+						Name:  "repair",
+						Usage: "Publish reindex jobs for the entities which drifted.",
+					},
+				},
+			},
+			{
+				Name: "prune",
+				Usage: "Delete the monthly deployments indices ended before " +
+					"the retention period",
+				Action: cmdPrune,
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name: "months",
+						Usage: "Keep the device deployments of the last `N` months. " +
+							"Defaults to the opensearch_deployments_retention_months setting.",
+					},
+				},
+			},
+			{
+				Name:  "placement",
+				Usage: "Manage the placement of the tenants on dedicated indices",
+				Subcommands: []cli.Command{
+					{
+						Name:   "list",
+						Usage:  "List the tenants placed on dedicated indices",
+						Action: cmdPlacementList,
+					},
+					{
+						Name: "dedicate",
+						Usage: "Move a tenant from the shared indices to dedicated ones, " +
+							"while it keeps being indexed and searched",
+						Action: cmdPlacementDedicate,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "tenant",
+								Usage: "Move the tenant with the given `ID`.",
+							},
+							&cli.IntFlag{
+								Name: "devices-shards",
+								Usage: "Number of shards of the dedicated devices index. " +
+									"Defaults to the one of the shared index.",
+							},
+							&cli.IntFlag{
+								Name: "deployments-shards",
+								Usage: "Number of shards of the dedicated deployments index. " +
+									"Defaults to the one of the shared index.",
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:  "dlq",
+				Usage: "Manage the jobs in the dead-letter queue",
+				Subcommands: []cli.Command{
+					{
+						Name:   "list",
+						Usage:  "List the jobs in the dead-letter queue",
+						Action: cmdDLQList,
+					},
+					{
+						Name:   "replay",
+						Usage:  "Publish the jobs in the dead-letter queue for reindexing",
+						Action: cmdDLQReplay,
+					},
+					{
+						Name:   "purge",
+						Usage:  "Delete all the jobs in the dead-letter queue",
+						Action: cmdDLQPurge,
+					},
+				},
+			},
 		},
 	}
 	app.Usage = "Reporting"
@@ -143,6 +255,13 @@ func cmdServer(args *cli.Context) error {
 			return err
 		}
 	}
+	err = watchTenantPlacements(ctx, store, ds)
+	if err == nil {
+		err = watchIndices(ctx, store)
+	}
+	if err != nil {
+		return err
+	}
 	return server.InitAndRun(config.Config, store, ds)
 }
 
@@ -178,6 +297,17 @@ func cmdIndexer(args *cli.Context) error {
 		}
 
 	}
+	err = watchTenantPlacements(ctx, store, ds)
+	if err == nil {
+		err = watchIndices(ctx, store)
+	}
+	if err != nil {
+		return err
+	}
+	if months := config.Config.GetInt(
+		dconfig.SettingOpenSearchDeploymentsRetentionMonths); months > 0 {
+		go pruneDeploymentsDaily(ctx, store, months)
+	}
 	return indexer.InitAndRun(config.Config, store, ds, nats)
 }
 
@@ -198,8 +328,356 @@ func cmdMigrate(args *cli.Context) error {
 	return migrate(ctx, store, ds, nats)
 }
 
+func cmdReindex(args *cli.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store, err := getStore(args)
+	if err != nil {
+		return err
+	}
+	ds, err := getDatastore(args)
+	if err != nil {
+		return err
+	}
+	defer ds.Close(ctx)
+	// a reindex may run longer than the max age of the tenant placements,
+	// past which the writes are refused, and through an index cutover:
+	// reload both in background, like the indexers do, until it returns
+	err = watchTenantPlacements(ctx, store, ds)
+	if err == nil {
+		err = watchIndices(ctx, store)
+	}
+	if err != nil {
+		return err
+	}
+	indexer := indexer.NewIndexerFromConfig(config.Config, store, ds, nil)
+	tenantIDs := args.StringSlice("tenant")
+	if len(tenantIDs) == 0 {
+		return indexer.ReindexAll(ctx)
+	}
+	for _, tenantID := range tenantIDs {
+		err = indexer.ReindexTenant(ctx, tenantID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdVerify(args *cli.Context) error {
+	ctx := context.Background()
+	store, err := getStore(args)
+	if err != nil {
+		return err
+	}
+	ds, err := getDatastore(args)
+	if err != nil {
+		return err
+	}
+	defer ds.Close(ctx)
+	err = placement.Refresh(ctx, store, ds)
+	if err != nil {
+		return err
+	}
+	sample := args.Int("sample")
+	if sample < 0 {
+		return errors.New("sample: must be a non-negative integer")
+	}
+	repair := args.Bool("repair")
+	var natsClient nats.Client
+	if repair {
+		natsClient, err = getNatsClient()
+		if err != nil {
+			return err
+		}
+		defer natsClient.Close()
+	}
+	stream := config.Config.GetString(dconfig.SettingNatsStreamName)
+	topic := config.Config.GetString(dconfig.SettingNatsSubscriberTopic)
+
+	verifier := indexer.NewIndexerFromConfig(config.Config, store, ds, nil)
+	tenantIDs := args.StringSlice("tenant")
+	if len(tenantIDs) == 0 {
+		tenantIDs, err = indexer.TenantIDs(ctx, ds)
+		if err != nil {
+			return err
+		}
+	}
+	l := log.FromContext(ctx)
+	enc := json.NewEncoder(os.Stdout)
+	drifted, failed := 0, 0
+	for _, tenantID := range tenantIDs {
+		// a tenant failing the verification does not stop the others
+		report, err := verifier.VerifyTenant(ctx, tenantID, sample)
+		if err != nil {
+			l.Error(errors.Wrapf(err, "failed to verify tenant %q", tenantID))
+			failed++
+			continue
+		}
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+		if report.InSync() {
+			continue
+		}
+		drifted++
+		if repair {
+			_, err = indexer.RepairDrift(ctx, natsClient, stream+"."+topic, report)
+			if err != nil {
+				l.Error(errors.Wrapf(err, "failed to repair tenant %q", tenantID))
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("failed to verify %d of %d tenants", failed, len(tenantIDs))
+	} else if drifted > 0 && !repair {
+		return errors.Errorf("found drift in %d of %d tenants", drifted, len(tenantIDs))
+	}
+	return nil
+}
+
+// getAliasesRefresh returns the interval between the reloads of the physical
+// indices behind the write aliases
+func getAliasesRefresh() (time.Duration, error) {
+	refreshSec := config.Config.GetInt(dconfig.SettingOpenSearchAliasesRefreshSec)
+	if refreshSec <= 0 {
+		return 0, errors.Errorf("%s: must be a positive integer",
+			dconfig.SettingOpenSearchAliasesRefreshSec)
+	}
+	return time.Duration(refreshSec) * time.Second, nil
+}
+
+// watchIndices loads the physical indices behind the write aliases, and
+// reloads them in background at every refresh interval
+func watchIndices(ctx context.Context, store store.Store) error {
+	refresh, err := getAliasesRefresh()
+	if err != nil {
+		return err
+	}
+	err = store.RefreshIndices(ctx)
+	if err != nil {
+		return err
+	}
+	go func() {
+		l := log.FromContext(ctx)
+		ticker := time.NewTicker(refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := store.RefreshIndices(ctx); err != nil {
+					l.Errorf("failed to refresh the write aliases: %s", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func cmdPrune(args *cli.Context) error {
+	ctx := context.Background()
+	months := args.Int("months")
+	if months == 0 {
+		months = config.Config.GetInt(dconfig.SettingOpenSearchDeploymentsRetentionMonths)
+	}
+	if months <= 0 {
+		return errors.New("months: must be a positive integer")
+	}
+	store, err := getStore(args)
+	if err != nil {
+		return err
+	}
+	return pruneDeployments(ctx, store, months)
+}
+
+// pruneDeployments deletes the monthly deployments indices ended more than
+// the given number of months ago
+func pruneDeployments(ctx context.Context, store store.Store, months int) error {
+	before := time.Now().UTC().AddDate(0, -months, 0)
+	pruned, err := store.PruneDeployments(ctx, before)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).Infof("deleted %d monthly deployments indices ended before %s",
+		len(pruned), before.Format(time.RFC3339))
+	return nil
+}
+
+// pruneDeploymentsDaily deletes daily the monthly deployments indices ended
+// before the retention period, until the context is canceled
+func pruneDeploymentsDaily(ctx context.Context, store store.Store, months int) {
+	l := log.FromContext(ctx)
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		if err := pruneDeployments(ctx, store, months); err != nil {
+			l.Errorf("failed to prune the deployments indices: %s", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// getTenantPlacementRefresh returns the interval between the reloads of the
+// tenant placements
+func getTenantPlacementRefresh() (time.Duration, error) {
+	refreshSec := config.Config.GetInt(dconfig.SettingTenantPlacementRefreshSec)
+	if refreshSec <= 0 {
+		return 0, errors.Errorf("%s: must be a positive integer",
+			dconfig.SettingTenantPlacementRefreshSec)
+	}
+	return time.Duration(refreshSec) * time.Second, nil
+}
+
+// watchTenantPlacements loads the tenant placements, and reloads them in
+// background at every refresh interval
+func watchTenantPlacements(ctx context.Context, store store.Store, ds store.DataStore) error {
+	refresh, err := getTenantPlacementRefresh()
+	if err != nil {
+		return err
+	}
+	err = placement.Refresh(ctx, store, ds)
+	if err != nil {
+		return err
+	}
+	go placement.Watch(ctx, store, ds, refresh)
+	return nil
+}
+
+func cmdPlacementList(args *cli.Context) error {
+	ctx := context.Background()
+	ds, err := getDatastore(args)
+	if err != nil {
+		return err
+	}
+	defer ds.Close(ctx)
+	placements, err := ds.GetTenantPlacements(ctx)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for _, tenant := range placements {
+		if err := enc.Encode(tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdPlacementDedicate(args *cli.Context) error {
+	ctx := context.Background()
+	tenantID := args.String("tenant")
+	if tenantID == "" {
+		return errors.New("tenant: must be specified")
+	}
+	devicesShards := args.Int("devices-shards")
+	deploymentsShards := args.Int("deployments-shards")
+	if devicesShards < 0 || deploymentsShards < 0 {
+		return errors.New("shards: must be a non-negative integer")
+	}
+	refresh, err := getTenantPlacementRefresh()
+	if err != nil {
+		return err
+	}
+	store, err := getStore(args)
+	if err != nil {
+		return err
+	}
+	ds, err := getDatastore(args)
+	if err != nil {
+		return err
+	}
+	defer ds.Close(ctx)
+	return placement.Dedicate(ctx, store, ds, &model.TenantPlacement{
+		TenantID:          tenantID,
+		DevicesShards:     devicesShards,
+		DeploymentsShards: deploymentsShards,
+	}, 2*refresh)
+}
+
+func getDeadLetterSubject() (string, error) {
+	dlq := indexer.DeadLetterSubject(config.Config)
+	if dlq == "" {
+		return "", errors.Errorf("%s: dead-lettering is disabled",
+			dconfig.SettingNatsDeadLetterTopic)
+	}
+	return dlq, nil
+}
+
+func cmdDLQList(args *cli.Context) error {
+	dlq, err := getDeadLetterSubject()
+	if err != nil {
+		return err
+	}
+	nats, err := getNatsClient()
+	if err != nil {
+		return err
+	}
+	defer nats.Close()
+	letters, err := nats.JetStreamDeadLetters(context.Background(), dlq)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for _, letter := range letters {
+		if err := enc.Encode(letter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdDLQReplay(args *cli.Context) error {
+	dlq, err := getDeadLetterSubject()
+	if err != nil {
+		return err
+	}
+	nats, err := getNatsClient()
+	if err != nil {
+		return err
+	}
+	defer nats.Close()
+	stream := config.Config.GetString(dconfig.SettingNatsStreamName)
+	topic := config.Config.GetString(dconfig.SettingNatsSubscriberTopic)
+	ctx := context.Background()
+	replayed, err := indexer.ReplayDeadLetters(ctx, nats, dlq, stream+"."+topic)
+	log.FromContext(ctx).Infof("replayed %d jobs from the dead-letter queue", replayed)
+	return err
+}
+
+func cmdDLQPurge(args *cli.Context) error {
+	dlq, err := getDeadLetterSubject()
+	if err != nil {
+		return err
+	}
+	nats, err := getNatsClient()
+	if err != nil {
+		return err
+	}
+	defer nats.Close()
+	return nats.JetStreamPurgeDeadLetters(context.Background(), dlq)
+}
+
 func migrate(ctx context.Context, store store.Store, ds store.DataStore, nats nats.Client) error {
-	err := store.Migrate(ctx)
+	return lease.Run(ctx, ds, migrationsLease, migrationsLeaseTTL,
+		func(ctx context.Context) error {
+			return doMigrate(ctx, store, ds, nats)
+		})
+}
+
+func doMigrate(ctx context.Context, store store.Store, ds store.DataStore,
+	nats nats.Client) error {
+	// the dedicated indices of the tenants are migrated too
+	err := placement.Refresh(ctx, store, ds)
+	if err == nil {
+		err = store.Migrate(ctx)
+	}
 	if err != nil {
 		return err
 	}
@@ -207,14 +685,26 @@ func migrate(ctx context.Context, store store.Store, ds store.DataStore, nats na
 	if err != nil {
 		return err
 	}
-	dur := config.Config.GetString(dconfig.SettingNatsSubscriberDurable)
 	stream := config.Config.GetString(dconfig.SettingNatsStreamName)
 	topic := config.Config.GetString(dconfig.SettingNatsSubscriberTopic)
 	sub := stream + "." + topic
-	return nats.Migrate(ctx, sub, dur, true)
+	for _, dur := range indexer.LaneDurables(config.Config) {
+		if err := nats.Migrate(ctx, sub, dur, true); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func getStore(args *cli.Context) (store.Store, error) {
+	aliasesRefresh, err := getAliasesRefresh()
+	if err != nil {
+		return nil, err
+	}
+	placementRefresh, err := getTenantPlacementRefresh()
+	if err != nil {
+		return nil, err
+	}
 	addresses := config.Config.GetStringSlice(dconfig.SettingOpenSearchAddresses)
 	devicesIndexName := config.Config.GetString(dconfig.SettingOpenSearchDevicesIndexName)
 	devicesIndexShards := config.Config.GetInt(dconfig.SettingOpenSearchDevicesIndexShards)
@@ -224,6 +714,12 @@ func getStore(args *cli.Context) (store.Store, error) {
 	deploymentsIndexShards := config.Config.GetInt(dconfig.SettingOpenSearchDeploymentsIndexShards)
 	deploymentsIndexReplicas := config.Config.GetInt(
 		dconfig.SettingOpenSearchDeploymentsIndexReplicas)
+	summariesIndexName := config.Config.GetString(
+		dconfig.SettingOpenSearchSummariesIndexName)
+	summariesIndexShards := config.Config.GetInt(
+		dconfig.SettingOpenSearchSummariesIndexShards)
+	summariesIndexReplicas := config.Config.GetInt(
+		dconfig.SettingOpenSearchSummariesIndexReplicas)
 	store, err := opensearch.NewStore(
 		opensearch.WithServerAddresses(addresses),
 		opensearch.WithDevicesIndexName(devicesIndexName),
@@ -232,6 +728,34 @@ func getStore(args *cli.Context) (store.Store, error) {
 		opensearch.WithDeploymentsIndexName(deploymentsIndexName),
 		opensearch.WithDeploymentsIndexShards(deploymentsIndexShards),
 		opensearch.WithDeploymentsIndexReplicas(deploymentsIndexReplicas),
+		opensearch.WithDeploymentSummariesIndexName(summariesIndexName),
+		opensearch.WithDeploymentSummariesIndexShards(summariesIndexShards),
+		opensearch.WithDeploymentSummariesIndexReplicas(summariesIndexReplicas),
+		opensearch.WithCutoverSettle(2*aliasesRefresh),
+		// shorter than the placement settle delay, with room for a late reload
+		opensearch.WithPlacementsMaxAge(placementRefresh+placementRefresh/2),
+		opensearch.WithDeploymentsMonthlyIndices(
+			config.Config.GetBool(dconfig.SettingOpenSearchDeploymentsIndexMonthly)),
+		opensearch.WithBasicAuth(
+			config.Config.GetString(dconfig.SettingOpenSearchUsername),
+			config.Config.GetString(dconfig.SettingOpenSearchPassword),
+		),
+		opensearch.WithCACertificate(
+			config.Config.GetString(dconfig.SettingOpenSearchCACertificate)),
+		opensearch.WithClientCertificate(
+			config.Config.GetString(dconfig.SettingOpenSearchClientCertificate),
+			config.Config.GetString(dconfig.SettingOpenSearchClientKey),
+		),
+		opensearch.WithTLSSkipVerify(
+			config.Config.GetBool(dconfig.SettingOpenSearchTLSSkipVerify)),
+		opensearch.WithBulkLimits(
+			config.Config.GetInt(dconfig.SettingOpenSearchBulkMaxItems),
+			config.Config.GetInt(dconfig.SettingOpenSearchBulkMaxBytes),
+		),
+		opensearch.WithBulkConcurrency(
+			config.Config.GetInt(dconfig.SettingOpenSearchBulkConcurrency)),
+		opensearch.WithBulkCompression(
+			config.Config.GetBool(dconfig.SettingOpenSearchBulkGzip)),
 	)
 	if err != nil {
 		return nil, err
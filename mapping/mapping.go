@@ -224,6 +224,6 @@ func fieldsToAttributes(attrs []string) map[string]string {
 }
 
 func shouldMapScope(scope, attribute string) bool {
-	return scope != model.ScopeSystem &&
+	return scope != model.ScopeSystem && scope != model.ScopeMonitor &&
 		!(scope == model.ScopeIdentity && attribute == model.AttrNameStatus)
 }
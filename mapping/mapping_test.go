@@ -48,6 +48,7 @@ func TestMapInventoryAttributes(t *testing.T) {
 				{Name: "a1", Value: "v1", Scope: model.ScopeInventory},
 				{Name: "a2", Value: "v2", Scope: model.ScopeInventory},
 				{Name: "a3", Value: "v3", Scope: model.ScopeSystem},
+				{Name: "a4", Value: "v4", Scope: model.ScopeMonitor},
 			},
 			update: true,
 			mapping: &model.Mapping{
@@ -61,6 +62,7 @@ func TestMapInventoryAttributes(t *testing.T) {
 				{Name: fmt.Sprintf(inventoryAttributeTemplate, 1), Value: "v1", Scope: model.ScopeInventory},
 				{Name: fmt.Sprintf(inventoryAttributeTemplate, 2), Value: "v2", Scope: model.ScopeInventory},
 				{Name: "a3", Value: "v3", Scope: model.ScopeSystem},
+				{Name: "a4", Value: "v4", Scope: model.ScopeMonitor},
 			},
 		},
 		"ok, no update": {
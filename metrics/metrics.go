@@ -0,0 +1,198 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package metrics defines the Prometheus metrics exported by the indexer
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "reporting"
+
+const (
+	LabelAction  = "action"
+	LabelTenant  = "tenant"
+	LabelService = "service"
+	LabelCode    = "code"
+	LabelResult  = "result"
+	LabelType    = "type"
+	LabelLane    = "lane"
+)
+
+const (
+	ResultOK         = "ok"
+	ResultAck        = "ack"
+	ResultNak        = "nak"
+	ResultDeadLetter = "dead_letter"
+	ResultError      = "error"
+)
+
+var (
+	// JobsReceived counts the jobs received from NATS
+	JobsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "jobs_received_total",
+		Help:      "Number of jobs received, per action and tenant.",
+	}, []string{LabelAction, LabelTenant})
+
+	// JobsCoalesced counts the jobs coalesced with a previous job for the
+	// same entity within the debounce window
+	JobsCoalesced = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "jobs_coalesced_total",
+		Help:      "Number of jobs coalesced with a previous job for the same entity.",
+	})
+
+	// JobPayloadsUsed counts the devices indexed from the data published
+	// inline with the jobs rather than fetched from the upstream services
+	JobPayloadsUsed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "job_payloads_used_total",
+		Help:      "Number of devices indexed from the inline job payloads, per service.",
+	}, []string{LabelService})
+
+	// ChangeEventsPublished counts the change events published, per result
+	ChangeEventsPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "change_events_published_total",
+		Help:      "Number of change events published, per result (ok, error).",
+	}, []string{LabelResult})
+
+	// EnrichmentsSkipped counts the device batches indexed without the
+	// attributes of an optional upstream service, because it failed
+	EnrichmentsSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "enrichments_skipped_total",
+		Help: "Number of device batches indexed without the attributes of an " +
+			"optional service because it failed, per service.",
+	}, []string{LabelService})
+
+	// JobsQueued is the number of jobs waiting for a worker in the
+	// per-tenant queues, per lane
+	JobsQueued = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "jobs_queued",
+		Help:      "Number of jobs waiting for a worker in the per-tenant queues, per lane.",
+	}, []string{LabelLane})
+
+	// BatchSize observes the size of the batches processed by the workers
+	BatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "batch_size",
+		Help:      "Number of jobs in the batches processed by the workers.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	// WorkersBusy is the number of workers currently processing a batch
+	WorkersBusy = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "workers_busy",
+		Help:      "Number of workers currently processing a batch.",
+	})
+
+	// Workers is the number of workers
+	Workers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "workers",
+		Help:      "Number of workers.",
+	})
+
+	// WorkersBusySeconds counts the time spent by the workers processing
+	// batches; its rate divided by the number of workers is the utilization
+	WorkersBusySeconds = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "workers_busy_seconds_total",
+		Help:      "Time spent by the workers processing batches.",
+	})
+
+	// UpstreamRequestDuration observes the latency of the requests to the
+	// upstream services
+	UpstreamRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the requests to the upstream services.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{LabelService, LabelCode})
+
+	// UpstreamRequestErrors counts the failed requests to the upstream
+	// services, either because of a transport error or a 5xx status code
+	UpstreamRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "request_errors_total",
+		Help:      "Number of failed requests to the upstream services.",
+	}, []string{LabelService})
+
+	// StoreBulkDuration observes the latency of the OpenSearch bulk requests
+	StoreBulkDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "store",
+		Name:      "bulk_duration_seconds",
+		Help:      "Latency of the OpenSearch bulk requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{LabelCode})
+
+	// StoreBulkItemFailures counts the bulk operations which failed
+	StoreBulkItemFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "store",
+		Name:      "bulk_item_failures_total",
+		Help:      "Number of failed bulk operations, per error type.",
+	}, []string{LabelType})
+
+	// StoreBulkItemsStale counts the bulk operations skipped as stale
+	StoreBulkItemsStale = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "store",
+		Name:      "bulk_items_stale_total",
+		Help:      "Number of bulk operations skipped because the document is stale.",
+	})
+
+	// NatsPending is the number of messages pending for the consumer
+	NatsPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "nats",
+		Name:      "pending_messages",
+		Help:      "Number of messages pending for the consumer, as of the last fetch.",
+	})
+
+	// NatsAcks counts the settled messages, per result
+	NatsAcks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "nats",
+		Name:      "acks_total",
+		Help:      "Number of settled messages, per result (ack, nak, dead_letter, error).",
+	}, []string{LabelResult})
+)
+
+// Handler returns the HTTP handler exposing the metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type transport struct {
+	service string
+	next    http.RoundTripper
+}
+
+// NewTransport returns an http.RoundTripper observing the latency and the
+// errors of the requests to the given upstream service
+func NewTransport(service string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{
+		service: service,
+		next:    next,
+	}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	rsp, err := t.next.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(rsp.StatusCode)
+	}
+	UpstreamRequestDuration.WithLabelValues(t.service, code).
+		Observe(time.Since(start).Seconds())
+	if err != nil || rsp.StatusCode >= http.StatusInternalServerError {
+		UpstreamRequestErrors.WithLabelValues(t.service).Inc()
+	}
+	return rsp, err
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport(t *testing.T) {
+	const service = "test"
+
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/error" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		},
+	))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewTransport(service, nil)}
+	for _, path := range []string{"/", "/error", "/"} {
+		rsp, err := client.Get(srv.URL + path)
+		if assert.NoError(t, err) {
+			rsp.Body.Close()
+		}
+	}
+
+	_, err := client.Get("http://127.0.0.1:0/")
+	assert.Error(t, err)
+
+	assert.Equal(t, float64(2),
+		testutil.ToFloat64(UpstreamRequestErrors.WithLabelValues(service)))
+	assert.Equal(t, 3, testutil.CollectAndCount(UpstreamRequestDuration))
+}
@@ -43,6 +43,27 @@ const (
 	AttrNameLatestDeploymentStatus = "latest_deployment_status"
 	AttrNameGeoLatitude            = "geo-lat"
 	AttrNameGeoLongitude           = "geo-lon"
+	AttrNameConnectStatus          = "connect_status"
+	AttrNameConnectUpdatedAt       = "connect_updated_ts"
+	AttrNameAlertsOpen             = "alerts_open"
+	AttrNameAlertsLastTimestamp    = "alerts_last_ts"
+	AttrNameAlertsOpenNames        = "alerts_open_names"
+	AttrNameAlertsOpenLevels       = "alerts_open_levels"
+	// AttrNameAlertLevels holds the alert level of each monitored service,
+	// as "<service>:<level>" values; a single attribute rather than one per
+	// service keeps the number of fields in the index mapping bounded
+	AttrNameAlertLevels = "alert_levels"
+)
+
+// attributes of the latest deployment of the device
+const (
+	AttrNameLatestDeploymentID       = "latest_deployment_id"
+	AttrNameLatestDeploymentName     = "latest_deployment_name"
+	AttrNameLatestDeploymentArtifact = "latest_deployment_artifact_name"
+	AttrNameLatestDeploymentFinished = "latest_deployment_finished_ts"
+	// AttrNameFailedDeployments is the number of deployments which
+	// failed within the configured window
+	AttrNameFailedDeployments = "failed_deployments_count"
 )
 
 const (
@@ -50,6 +71,7 @@ const (
 	FieldNameDeploymentID     = "deployment_id"
 	FieldNameDeviceID         = "device_id"
 	FieldNameDeploymentGroups = "deployment_groups"
+	FieldNameDeviceAttributes = "device_attributes"
 	FieldNameTenantID         = "tenant_id"
 	FieldNameLocation         = "location"
 	FieldNameCheckIn          = "check_in_time"
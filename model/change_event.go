@@ -0,0 +1,36 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import "time"
+
+const (
+	EntityTypeDevice     = "device"
+	EntityTypeDeployment = "deployment"
+)
+
+// ChangeEvent notifies the downstream consumers that a document changed
+// in the index
+type ChangeEvent struct {
+	TenantID   string `json:"tenant_id"`
+	EntityType string `json:"entity_type"`
+	ID         string `json:"id"`
+	// Deleted is true if the document was removed from the index
+	Deleted bool `json:"deleted,omitempty"`
+	// ChangedAttributes are the names of the document fields which were
+	// added, removed or updated
+	ChangedAttributes []string  `json:"changed_attributes,omitempty"`
+	IndexedAt         time.Time `json:"indexed_at"`
+}
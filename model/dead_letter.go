@@ -0,0 +1,32 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import "time"
+
+// DeadLetter is a job which could not be processed, as published to the
+// dead-letter subject
+type DeadLetter struct {
+	// Sequence is the sequence number of the dead letter in the stream;
+	// it is set only when reading the dead letters back
+	Sequence uint64 `json:"sequence,omitempty"`
+	// Job is the original job, nil if the message could not be decoded
+	Job *Job `json:"job,omitempty"`
+	// Data is the raw message data, set if the message could not be decoded
+	Data      []byte    `json:"data,omitempty"`
+	Error     string    `json:"error"`
+	Attempts  uint64    `json:"attempts"`
+	Timestamp time.Time `json:"timestamp"`
+}
@@ -54,4 +54,5 @@ type Deployment struct {
 	ImageDepends                map[string]interface{} `json:"image_depends,omitempty"`
 	ImageClearsProvides         []string               `json:"image_clears_provides,omitempty"`
 	ImageSize                   int64                  `json:"image_size,omitempty"`
+	DeviceAttributes            map[string]interface{} `json:"device_attributes,omitempty"`
 }
@@ -0,0 +1,50 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import "time"
+
+// DeploymentSummary is the per-deployment document, summarizing the
+// status of all the device deployments of a deployment
+//
+//nolint:lll
+type DeploymentSummary struct {
+	ID                     string                   `json:"id"`
+	TenantID               string                   `json:"tenant_id"`
+	DeploymentID           string                   `json:"deployment_id"`
+	DeploymentName         string                   `json:"deployment_name"`
+	DeploymentArtifactName string                   `json:"deployment_artifact_name"`
+	DeploymentType         string                   `json:"deployment_type"`
+	DeploymentStatus       string                   `json:"deployment_status"`
+	DeploymentCreated      *time.Time               `json:"deployment_created"`
+	DeploymentFinished     *time.Time               `json:"deployment_finished,omitempty"`
+	DeploymentFilterID     string                   `json:"deployment_filter_id,omitempty"`
+	DeploymentAllDevices   bool                     `json:"deployment_all_devices"`
+	DeploymentGroups       []string                 `json:"deployment_groups,omitempty"`
+	DeploymentPhased       bool                     `json:"deployment_phased"`
+	DeploymentPhases       []DeploymentSummaryPhase `json:"deployment_phases,omitempty"`
+	InitialDeviceCount     int                      `json:"initial_device_count"`
+	DeviceCount            int                      `json:"device_count"`
+	DeviceCounts           map[string]int           `json:"device_counts,omitempty"`
+	SuccessRatio           float64                  `json:"success_ratio"`
+}
+
+// DeploymentSummaryPhase is a phase of a phased deployment
+type DeploymentSummaryPhase struct {
+	ID          string     `json:"id"`
+	BatchSize   int        `json:"batch_size"`
+	StartTs     *time.Time `json:"start_ts,omitempty"`
+	DeviceCount int        `json:"device_count"`
+}
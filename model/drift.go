@@ -0,0 +1,57 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+// DriftReport is the result of the comparison of the documents indexed for
+// a tenant with the source services
+type DriftReport struct {
+	TenantID string `json:"tenant_id"`
+	// Sample is the number of documents sampled from each index, or zero
+	// if the tenant was fully scanned
+	Sample      int         `json:"sample,omitempty"`
+	Devices     EntityDrift `json:"devices"`
+	Deployments EntityDrift `json:"deployments"`
+}
+
+// EntityDrift lists the entities of a type whose documents do not match
+// the source services
+type EntityDrift struct {
+	// Checked is the number of entities compared
+	Checked int `json:"checked"`
+	// Missing are the IDs of the entities not indexed
+	Missing []string `json:"missing,omitempty"`
+	// Stale are the IDs of the documents indexed for entities which are
+	// not found in the source services
+	Stale []string `json:"stale,omitempty"`
+	// Differing are the documents whose fields do not match the source
+	Differing []DocumentDrift `json:"differing,omitempty"`
+}
+
+// DocumentDrift lists the fields of a document which do not match the
+// source services
+type DocumentDrift struct {
+	ID     string   `json:"id"`
+	Fields []string `json:"fields"`
+}
+
+// InSync returns true if no drift was found
+func (d *EntityDrift) InSync() bool {
+	return len(d.Missing) == 0 && len(d.Stale) == 0 && len(d.Differing) == 0
+}
+
+// InSync returns true if no drift was found
+func (r *DriftReport) InSync() bool {
+	return r.Devices.InSync() && r.Deployments.InSync()
+}
@@ -14,6 +14,22 @@
 
 package model
 
+import (
+	"context"
+	"time"
+)
+
+// JobAcknowledger settles a job with the message broker it was received from
+type JobAcknowledger interface {
+	// Ack acknowledges the job as successfully processed
+	Ack(ctx context.Context) error
+	// Nak requests the redelivery of the job after the given delay; jobs
+	// which exhausted their deliveries are dead-lettered with the cause
+	Nak(ctx context.Context, delay time.Duration, cause error) error
+	// DeadLetter dead-letters the job right away, without redelivery
+	DeadLetter(ctx context.Context, cause error) error
+}
+
 type Job struct {
 	Action       string `json:"action"`
 	RequestID    string `json:"request_id"`
@@ -22,4 +38,89 @@ type Job struct {
 	DeviceID     string `json:"device_id"`
 	DeploymentID string `json:"deployment_id"`
 	Service      string `json:"service"`
+
+	// Payload is the optional device data published inline with the job
+	Payload *JobPayload `json:"payload,omitempty"`
+
+	// Acknowledger is set for jobs received from the message broker
+	Acknowledger JobAcknowledger `json:"-"`
+}
+
+// Ack acknowledges the job, if it was received from the message broker
+func (job *Job) Ack(ctx context.Context) error {
+	if job.Acknowledger == nil {
+		return nil
+	}
+	return job.Acknowledger.Ack(ctx)
+}
+
+// Nak requests the redelivery of the job, if it was received from the
+// message broker
+func (job *Job) Nak(ctx context.Context, delay time.Duration, cause error) error {
+	if job.Acknowledger == nil {
+		return nil
+	}
+	return job.Acknowledger.Nak(ctx, delay, cause)
+}
+
+// DeadLetter dead-letters the job, if it was received from the message broker
+func (job *Job) DeadLetter(ctx context.Context, cause error) error {
+	if job.Acknowledger == nil {
+		return nil
+	}
+	return job.Acknowledger.DeadLetter(ctx, cause)
+}
+
+// JobPayloadVersion is the version of the job payloads understood by the
+// indexer; payloads of any other version are ignored
+const JobPayloadVersion = 1
+
+// JobPayload carries the device data, from one or more upstream services,
+// published inline with a reindex job; the data of the services left out
+// is fetched by the indexer
+type JobPayload struct {
+	Version     int                    `json:"version"`
+	DeviceAuth  *JobPayloadDeviceAuth  `json:"deviceauth,omitempty"`
+	Inventory   *JobPayloadInventory   `json:"inventory,omitempty"`
+	Deployments *JobPayloadDeployments `json:"deployments,omitempty"`
+}
+
+// JobPayloadDeviceAuth is the device data from deviceauth
+type JobPayloadDeviceAuth struct {
+	Status       string            `json:"status"`
+	IdentityData map[string]string `json:"identity_data,omitempty"`
+	LastCheckIn  time.Time         `json:"check_in_time,omitempty"`
+}
+
+// JobPayloadInventory is the device data from inventory; unless marked as
+// complete, it holds only the changed attributes, which the indexer merges
+// with the device attributes fetched from inventory
+type JobPayloadInventory struct {
+	Attributes []JobPayloadAttribute `json:"attributes"`
+	UpdatedTs  time.Time             `json:"updated_ts"`
+	// Complete marks the payloads holding all the inventory attributes of
+	// the device, which are indexed as is, without fetching the device
+	Complete bool `json:"complete,omitempty"`
+}
+
+// JobPayloadAttribute is an inventory attribute; the scope defaults to
+// the inventory scope
+type JobPayloadAttribute struct {
+	Name  string      `json:"name"`
+	Scope string      `json:"scope,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// JobPayloadDeployments is the latest finished deployment of the device
+// from deployments; an empty status means the device has none
+type JobPayloadDeployments struct {
+	DeviceDeploymentID string `json:"device_deployment_id,omitempty"`
+	DeploymentID       string `json:"deployment_id,omitempty"`
+	Status             string `json:"device_deployment_status,omitempty"`
+}
+
+// Valid returns true if the payload is of the version understood by the
+// indexer
+func (p *JobPayload) Valid() bool {
+	return p != nil && p.Version == JobPayloadVersion
 }
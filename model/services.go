@@ -15,13 +15,17 @@
 package model
 
 const (
-	ServiceDeviceauth  = "deviceauth"
-	ServiceMonitor     = "devicemonitor"
-	ServiceInventory   = "inventory"
-	ServiceDeployments = "deployments"
+	ServiceDeviceauth    = "deviceauth"
+	ServiceDeviceconnect = "deviceconnect"
+	ServiceMonitor       = "devicemonitor"
+	ServiceInventory     = "inventory"
+	ServiceDeployments   = "deployments"
 )
 
 const (
 	ActionReindex           = "reindex"
 	ActionReindexDeployment = "reindex_deployment"
+	// ActionReindexConnectivity is sent by deviceconnect when the connection
+	// state of a device changes; the device is reindexed as a whole
+	ActionReindexConnectivity = "reindex_connectivity"
 )
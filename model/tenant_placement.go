@@ -0,0 +1,37 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import "time"
+
+const (
+	// TenantPlacementMigrating is the state of a tenant being moved to the
+	// dedicated indices: the documents are written to both the shared and
+	// dedicated indices, and read from the shared ones
+	TenantPlacementMigrating = "migrating"
+	// TenantPlacementDedicated is the state of a tenant on the dedicated
+	// indices: the documents are written to and read from them only
+	TenantPlacementDedicated = "dedicated"
+)
+
+// TenantPlacement places the devices and device deployments of a tenant
+// on dedicated indices, rather than on the shared ones
+type TenantPlacement struct {
+	TenantID          string    `json:"tenant_id" bson:"_id"`
+	State             string    `json:"state" bson:"state"`
+	DevicesShards     int       `json:"devices_shards" bson:"devices_shards"`
+	DeploymentsShards int       `json:"deployments_shards" bson:"deployments_shards"`
+	UpdatedAt         time.Time `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const (
+	errTypeVersionConflict = "version_conflict_engine_exception"
+
+	// ErrTypeRequestFailed is the error type of the operations of a bulk
+	// request which failed as a whole, or was never sent; they are retryable,
+	// as the store may not have processed them
+	ErrTypeRequestFailed = "bulk_request_failed"
+)
+
+// BulkItemResult is the outcome of a single operation of a bulk request
+type BulkItemResult struct {
+	Action string
+	ID     string
+	Index  string
+	Status int
+	Error  *BulkItemError
+}
+
+// BulkItemError describes why a single operation of a bulk request failed
+type BulkItemError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// Failed returns true if the operation failed; deleting a document
+// which does not exist, or skipping a stale one, is not considered a failure
+func (r *BulkItemResult) Failed() bool {
+	return (r.Error != nil || r.Retryable()) && !r.Stale()
+}
+
+// Stale returns true if the document was skipped because the store already
+// holds a newer version of it
+func (r *BulkItemResult) Stale() bool {
+	return r.Status == http.StatusConflict && r.Error != nil &&
+		r.Error.Type == errTypeVersionConflict
+}
+
+// Retryable returns true if the operation failed with a transient error
+// and can be retried later
+func (r *BulkItemResult) Retryable() bool {
+	return r.Status == http.StatusTooManyRequests ||
+		r.Status == http.StatusServiceUnavailable ||
+		(r.Error != nil && r.Error.Type == ErrTypeRequestFailed)
+}
+
+func (r *BulkItemResult) String() string {
+	if r.Error == nil {
+		return fmt.Sprintf("%s %s: status %d", r.Action, r.ID, r.Status)
+	}
+	return fmt.Sprintf("%s %s: status %d, %s: %s",
+		r.Action, r.ID, r.Status, r.Error.Type, r.Error.Reason)
+}
+
+// BulkError is returned by the bulk operations when one or more documents
+// could not be written to the store
+type BulkError struct {
+	Items []BulkItemResult
+}
+
+func (e *BulkError) Error() string {
+	if len(e.Items) == 0 {
+		return "failed to write the documents"
+	} else if len(e.Items) == 1 {
+		return "failed to write 1 document: " + e.Items[0].String()
+	}
+	return fmt.Sprintf("failed to write %d documents, first failure: %s",
+		len(e.Items), e.Items[0].String())
+}
+
+// Item returns the failed operation for the document with the given ID,
+// or nil if the document was written successfully
+func (e *BulkError) Item(id string) *BulkItemResult {
+	for i := range e.Items {
+		if e.Items[i].ID == id {
+			return &e.Items[i]
+		}
+	}
+	return nil
+}
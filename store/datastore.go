@@ -16,6 +16,7 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/mendersoftware/reporting/model"
 )
@@ -31,6 +32,12 @@ type DataStore interface {
 	Migrate(ctx context.Context, version string, automigrate bool) error
 	MigrateLatest(ctx context.Context) error
 	GetMapping(ctx context.Context, tenantID string) (*model.Mapping, error)
+	GetTenantIDs(ctx context.Context) ([]string, error)
 	UpdateAndGetMapping(ctx context.Context, tenantID string, inventory []string) (
 		*model.Mapping, error)
+	GetTenantPlacements(ctx context.Context) ([]model.TenantPlacement, error)
+	GetTenantPlacement(ctx context.Context, tenantID string) (*model.TenantPlacement, error)
+	SetTenantPlacement(ctx context.Context, placement *model.TenantPlacement) error
+	AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name, owner string) error
 }
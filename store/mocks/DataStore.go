@@ -21,6 +21,8 @@ import (
 
 	model "github.com/mendersoftware/reporting/model"
 	mock "github.com/stretchr/testify/mock"
+
+	time "time"
 )
 
 // DataStore is an autogenerated mock type for the DataStore type
@@ -28,6 +30,27 @@ type DataStore struct {
 	mock.Mock
 }
 
+// AcquireLease provides a mock function with given fields: ctx, name, owner, ttl
+func (_m *DataStore) AcquireLease(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	ret := _m.Called(ctx, name, owner, ttl)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Duration) bool); ok {
+		r0 = rf(ctx, name, owner, ttl)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, time.Duration) error); ok {
+		r1 = rf(ctx, name, owner, ttl)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Close provides a mock function with given fields: ctx
 func (_m *DataStore) Close(ctx context.Context) error {
 	ret := _m.Called(ctx)
@@ -79,6 +102,75 @@ func (_m *DataStore) GetMapping(ctx context.Context, tenantID string) (*model.Ma
 	return r0, r1
 }
 
+// GetTenantIDs provides a mock function with given fields: ctx
+func (_m *DataStore) GetTenantIDs(ctx context.Context) ([]string, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context) []string); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTenantPlacement provides a mock function with given fields: ctx, tenantID
+func (_m *DataStore) GetTenantPlacement(ctx context.Context, tenantID string) (*model.TenantPlacement, error) {
+	ret := _m.Called(ctx, tenantID)
+
+	var r0 *model.TenantPlacement
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.TenantPlacement); ok {
+		r0 = rf(ctx, tenantID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.TenantPlacement)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, tenantID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTenantPlacements provides a mock function with given fields: ctx
+func (_m *DataStore) GetTenantPlacements(ctx context.Context) ([]model.TenantPlacement, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.TenantPlacement
+	if rf, ok := ret.Get(0).(func(context.Context) []model.TenantPlacement); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.TenantPlacement)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Migrate provides a mock function with given fields: ctx, version, automigrate
 func (_m *DataStore) Migrate(ctx context.Context, version string, automigrate bool) error {
 	ret := _m.Called(ctx, version, automigrate)
@@ -121,6 +213,34 @@ func (_m *DataStore) Ping(ctx context.Context) error {
 	return r0
 }
 
+// ReleaseLease provides a mock function with given fields: ctx, name, owner
+func (_m *DataStore) ReleaseLease(ctx context.Context, name string, owner string) error {
+	ret := _m.Called(ctx, name, owner)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, name, owner)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetTenantPlacement provides a mock function with given fields: ctx, placement
+func (_m *DataStore) SetTenantPlacement(ctx context.Context, placement *model.TenantPlacement) error {
+	ret := _m.Called(ctx, placement)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.TenantPlacement) error); ok {
+		r0 = rf(ctx, placement)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UpdateAndGetMapping provides a mock function with given fields: ctx, tenantID, inventory
 func (_m *DataStore) UpdateAndGetMapping(ctx context.Context, tenantID string, inventory []string) (*model.Mapping, error) {
 	ret := _m.Called(ctx, tenantID, inventory)
@@ -21,6 +21,8 @@ import (
 
 	model "github.com/mendersoftware/reporting/model"
 	mock "github.com/stretchr/testify/mock"
+
+	time "time"
 )
 
 // Store is an autogenerated mock type for the Store type
@@ -28,6 +30,29 @@ type Store struct {
 	mock.Mock
 }
 
+// AggregateDeploymentSummaries provides a mock function with given fields: ctx, query
+func (_m *Store) AggregateDeploymentSummaries(ctx context.Context, query model.Query) (model.M, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 model.M
+	if rf, ok := ret.Get(0).(func(context.Context, model.Query) model.M); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(model.M)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.Query) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // AggregateDeployments provides a mock function with given fields: ctx, query
 func (_m *Store) AggregateDeployments(ctx context.Context, query model.Query) (model.M, error) {
 	ret := _m.Called(ctx, query)
@@ -74,6 +99,20 @@ func (_m *Store) AggregateDevices(ctx context.Context, query model.Query) (model
 	return r0, r1
 }
 
+// BulkIndexDeploymentSummaries provides a mock function with given fields: ctx, summaries
+func (_m *Store) BulkIndexDeploymentSummaries(ctx context.Context, summaries []*model.DeploymentSummary) error {
+	ret := _m.Called(ctx, summaries)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []*model.DeploymentSummary) error); ok {
+		r0 = rf(ctx, summaries)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // BulkIndexDeployments provides a mock function with given fields: ctx, deployments
 func (_m *Store) BulkIndexDeployments(ctx context.Context, deployments []*model.Deployment) error {
 	ret := _m.Called(ctx, deployments)
@@ -89,12 +128,63 @@ func (_m *Store) BulkIndexDeployments(ctx context.Context, deployments []*model.
 }
 
 // BulkIndexDevices provides a mock function with given fields: ctx, devices, removedDevices
-func (_m *Store) BulkIndexDevices(ctx context.Context, devices []*model.Device, removedDevices []*model.Device) error {
+func (_m *Store) BulkIndexDevices(ctx context.Context, devices []*model.Device, removedDevices []*model.Device) ([]string, error) {
 	ret := _m.Called(ctx, devices, removedDevices)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, []*model.Device, []*model.Device) error); ok {
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, []*model.Device, []*model.Device) []string); ok {
 		r0 = rf(ctx, devices, removedDevices)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []*model.Device, []*model.Device) error); ok {
+		r1 = rf(ctx, devices, removedDevices)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CopyTenantDocuments provides a mock function with given fields: ctx, tid
+func (_m *Store) CopyTenantDocuments(ctx context.Context, tid string) error {
+	ret := _m.Called(ctx, tid)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, tid)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateTenantIndices provides a mock function with given fields: ctx, placement
+func (_m *Store) CreateTenantIndices(ctx context.Context, placement *model.TenantPlacement) error {
+	ret := _m.Called(ctx, placement)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.TenantPlacement) error); ok {
+		r0 = rf(ctx, placement)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteSharedTenantDocuments provides a mock function with given fields: ctx, tid
+func (_m *Store) DeleteSharedTenantDocuments(ctx context.Context, tid string) error {
+	ret := _m.Called(ctx, tid)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, tid)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -102,6 +192,57 @@ func (_m *Store) BulkIndexDevices(ctx context.Context, devices []*model.Device,
 	return r0
 }
 
+// GetDeploymentSummariesIndex provides a mock function with given fields: tid
+func (_m *Store) GetDeploymentSummariesIndex(tid string) string {
+	ret := _m.Called(tid)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(tid)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// GetDeploymentSummariesRoutingKey provides a mock function with given fields: tid
+func (_m *Store) GetDeploymentSummariesRoutingKey(tid string) string {
+	ret := _m.Called(tid)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(tid)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// GetDeployments provides a mock function with given fields: ctx, tenantID, deployments
+func (_m *Store) GetDeployments(ctx context.Context, tenantID string, deployments []*model.Deployment) (map[string]map[string]interface{}, error) {
+	ret := _m.Called(ctx, tenantID, deployments)
+
+	var r0 map[string]map[string]interface{}
+	if rf, ok := ret.Get(0).(func(context.Context, string, []*model.Deployment) map[string]map[string]interface{}); ok {
+		r0 = rf(ctx, tenantID, deployments)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]map[string]interface{})
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []*model.Deployment) error); ok {
+		r1 = rf(ctx, tenantID, deployments)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetDeploymentsIndex provides a mock function with given fields: tid
 func (_m *Store) GetDeploymentsIndex(tid string) string {
 	ret := _m.Called(tid)
@@ -153,6 +294,29 @@ func (_m *Store) GetDeploymentsRoutingKey(tid string) string {
 	return r0
 }
 
+// GetDevices provides a mock function with given fields: ctx, tenantID, ids
+func (_m *Store) GetDevices(ctx context.Context, tenantID string, ids []string) (map[string]map[string]interface{}, error) {
+	ret := _m.Called(ctx, tenantID, ids)
+
+	var r0 map[string]map[string]interface{}
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) map[string]map[string]interface{}); ok {
+		r0 = rf(ctx, tenantID, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]map[string]interface{})
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string) error); ok {
+		r1 = rf(ctx, tenantID, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetDevicesIndex provides a mock function with given fields: tid
 func (_m *Store) GetDevicesIndex(tid string) string {
 	ret := _m.Called(tid)
@@ -232,6 +396,66 @@ func (_m *Store) Ping(ctx context.Context) error {
 	return r0
 }
 
+// PruneDeployments provides a mock function with given fields: ctx, before
+func (_m *Store) PruneDeployments(ctx context.Context, before time.Time) ([]string, error) {
+	ret := _m.Called(ctx, before)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) []string); ok {
+		r0 = rf(ctx, before)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RefreshIndices provides a mock function with given fields: ctx
+func (_m *Store) RefreshIndices(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SearchDeploymentSummaries provides a mock function with given fields: ctx, query
+func (_m *Store) SearchDeploymentSummaries(ctx context.Context, query model.Query) (model.M, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 model.M
+	if rf, ok := ret.Get(0).(func(context.Context, model.Query) model.M); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(model.M)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.Query) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // SearchDeployments provides a mock function with given fields: ctx, query
 func (_m *Store) SearchDeployments(ctx context.Context, query model.Query) (model.M, error) {
 	ret := _m.Called(ctx, query)
@@ -277,3 +501,8 @@ func (_m *Store) SearchDevices(ctx context.Context, query model.Query) (model.M,
 
 	return r0, r1
 }
+
+// SetTenantPlacements provides a mock function with given fields: placements
+func (_m *Store) SetTenantPlacements(placements []model.TenantPlacement) {
+	_m.Called(placements)
+}
@@ -19,6 +19,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
@@ -29,9 +30,11 @@ import (
 )
 
 const (
-	collNameMapping   = "mapping"
-	keyNameTenantID   = "tenant_id"
-	indexNameTenantID = "tenant_id_ndx"
+	collNameMapping         = "mapping"
+	collNameTenantPlacement = "tenant_placement"
+	collNameLeases          = "leases"
+	keyNameTenantID         = "tenant_id"
+	indexNameTenantID       = "tenant_id_ndx"
 )
 
 type MongoStoreConfig struct {
@@ -161,6 +164,24 @@ func (db *MongoStore) GetMapping(ctx context.Context, tenantID string) (*model.M
 	return mapping, nil
 }
 
+// GetTenantIDs returns the IDs of the tenants which have a mapping
+func (db *MongoStore) GetTenantIDs(ctx context.Context) ([]string, error) {
+	res, err := db.client.
+		Database(db.config.DbName).
+		Collection(collNameMapping).
+		Distinct(ctx, keyNameTenantID, bson.M{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the tenant IDs")
+	}
+	tenantIDs := make([]string, 0, len(res))
+	for _, tenantID := range res {
+		if tid, ok := tenantID.(string); ok {
+			tenantIDs = append(tenantIDs, tid)
+		}
+	}
+	return tenantIDs, nil
+}
+
 // UpdateAndGetMapping updates the mapping and returns it
 func (db *MongoStore) UpdateAndGetMapping(ctx context.Context, tenantID string,
 	inventory []string) (*model.Mapping, error) {
@@ -210,3 +231,94 @@ func (db *MongoStore) UpdateAndGetMapping(ctx context.Context, tenantID string,
 	}
 	return mapping, nil
 }
+
+// GetTenantPlacements returns the placements of the tenants on dedicated indices
+func (db *MongoStore) GetTenantPlacements(ctx context.Context) ([]model.TenantPlacement, error) {
+	cur, err := db.client.
+		Database(db.config.DbName).
+		Collection(collNameTenantPlacement).
+		Find(ctx, bson.M{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the tenant placements")
+	}
+	placements := []model.TenantPlacement{}
+	if err := cur.All(ctx, &placements); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the tenant placements")
+	}
+	return placements, nil
+}
+
+// GetTenantPlacement returns the placement of the tenant, or nil if the
+// tenant is on the shared indices
+func (db *MongoStore) GetTenantPlacement(ctx context.Context,
+	tenantID string) (*model.TenantPlacement, error) {
+	placement := &model.TenantPlacement{}
+	err := db.client.
+		Database(db.config.DbName).
+		Collection(collNameTenantPlacement).
+		FindOne(ctx, bson.M{"_id": tenantID}).
+		Decode(placement)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to get the tenant placement")
+	}
+	return placement, nil
+}
+
+// SetTenantPlacement creates or replaces the placement of the tenant
+func (db *MongoStore) SetTenantPlacement(ctx context.Context,
+	placement *model.TenantPlacement) error {
+	_, err := db.client.
+		Database(db.config.DbName).
+		Collection(collNameTenantPlacement).
+		ReplaceOne(ctx, bson.M{"_id": placement.TenantID}, placement,
+			mopts.Replace().SetUpsert(true))
+	if err != nil {
+		return errors.Wrap(err, "failed to set the tenant placement")
+	}
+	return nil
+}
+
+// AcquireLease acquires or renews the named lease for the owner, until the
+// time to live expires; it returns false if another owner holds the lease
+func (db *MongoStore) AcquireLease(ctx context.Context, name, owner string,
+	ttl time.Duration) (bool, error) {
+	now := time.Now()
+	query := bson.M{
+		"_id": name,
+		"$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expires_at": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"owner":      owner,
+			"expires_at": now.Add(ttl),
+		},
+	}
+	_, err := db.client.
+		Database(db.config.DbName).
+		Collection(collNameLeases).
+		UpdateOne(ctx, query, update, mopts.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// the lease exists, and is held by another owner
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "failed to acquire the lease")
+	}
+	return true, nil
+}
+
+// ReleaseLease releases the named lease, if held by the owner
+func (db *MongoStore) ReleaseLease(ctx context.Context, name, owner string) error {
+	_, err := db.client.
+		Database(db.config.DbName).
+		Collection(collNameLeases).
+		DeleteOne(ctx, bson.M{"_id": name, "owner": owner})
+	if err != nil {
+		return errors.Wrap(err, "failed to release the lease")
+	}
+	return nil
+}
@@ -222,3 +222,108 @@ func TestUpdateAndGetMapping(t *testing.T) {
 	assert.Equal(t, tenantID, mapping.TenantID)
 	assert.Len(t, mapping.Inventory, 3+model.MaxMappingInventoryAttributes)
 }
+
+func TestGetTenantIDs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestGetTenantIDs in short mode.")
+	}
+	ds := GetTestDataStore(t)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*10)
+	defer cancel()
+
+	tenantIDs, err := ds.GetTenantIDs(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, tenantIDs)
+
+	for _, tenantID := range []string{"t1", "t2", "t1"} {
+		_, err := ds.UpdateAndGetMapping(ctx, tenantID, []string{"f1"})
+		assert.NoError(t, err)
+	}
+
+	tenantIDs, err = ds.GetTenantIDs(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"t1", "t2"}, tenantIDs)
+}
+
+func TestTenantPlacement(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestTenantPlacement in short mode.")
+	}
+	ds := GetTestDataStore(t)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*10)
+	defer cancel()
+
+	placement, err := ds.GetTenantPlacement(ctx, "t1")
+	assert.NoError(t, err)
+	assert.Nil(t, placement)
+
+	placements, err := ds.GetTenantPlacements(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, placements)
+
+	expected := &model.TenantPlacement{
+		TenantID:          "t1",
+		State:             model.TenantPlacementMigrating,
+		DevicesShards:     2,
+		DeploymentsShards: 3,
+		UpdatedAt:         time.Now().UTC().Truncate(time.Millisecond),
+	}
+	err = ds.SetTenantPlacement(ctx, expected)
+	assert.NoError(t, err)
+
+	expected.State = model.TenantPlacementDedicated
+	err = ds.SetTenantPlacement(ctx, expected)
+	assert.NoError(t, err)
+
+	placement, err = ds.GetTenantPlacement(ctx, "t1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, placement) {
+		placement.UpdatedAt = placement.UpdatedAt.UTC()
+		assert.Equal(t, expected, placement)
+	}
+
+	placements, err = ds.GetTenantPlacements(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, placements, 1)
+}
+
+func TestLease(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestLease in short mode.")
+	}
+	ds := GetTestDataStore(t)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*10)
+	defer cancel()
+
+	acquired, err := ds.AcquireLease(ctx, "migrations", "p1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+
+	// renewed by the owner, held for the others
+	acquired, err = ds.AcquireLease(ctx, "migrations", "p1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	acquired, err = ds.AcquireLease(ctx, "migrations", "p2", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+
+	// released by the owner only
+	err = ds.ReleaseLease(ctx, "migrations", "p2")
+	assert.NoError(t, err)
+	acquired, err = ds.AcquireLease(ctx, "migrations", "p2", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+	err = ds.ReleaseLease(ctx, "migrations", "p1")
+	assert.NoError(t, err)
+	acquired, err = ds.AcquireLease(ctx, "migrations", "p2", -time.Second)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+
+	// expired
+	acquired, err = ds.AcquireLease(ctx, "migrations", "p1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+}
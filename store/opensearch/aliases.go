@@ -0,0 +1,480 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	// writeAliasSuffix is the suffix of the aliases of the physical indices
+	// receiving the writes; during a cutover, both the old and the new
+	// version of an index receive the writes
+	writeAliasSuffix = "_write"
+
+	defaultCutoverSettle = time.Minute
+)
+
+var (
+	// devicesCopyDest keeps the external versions of the devices, so that
+	// copying them never replaces the newer documents written meanwhile
+	devicesCopyDest = model.M{"version_type": "external"}
+	// documentsCopyDest never replaces the documents written meanwhile
+	documentsCopyDest = model.M{"op_type": "create"}
+)
+
+type catAlias struct {
+	Alias string `json:"alias"`
+	Index string `json:"index"`
+}
+
+// versionedIndexName returns the name of the physical index holding the
+// given version of the index template, behind the alias
+func versionedIndexName(alias string, version int) string {
+	return fmt.Sprintf("%s_v%d", alias, version)
+}
+
+func writeAliasName(alias string) string {
+	return alias + writeAliasSuffix
+}
+
+// RefreshIndices loads the physical indices receiving the writes for each
+// alias; it must run at least once per cutover settle delay
+func (s *opensearchStore) RefreshIndices(ctx context.Context) error {
+	aliases, err := s.catAliases(ctx, "*"+writeAliasSuffix)
+	if err != nil {
+		return err
+	}
+	writeIndices := make(map[string][]string, len(aliases))
+	for _, alias := range aliases {
+		name := strings.TrimSuffix(alias.Alias, writeAliasSuffix)
+		writeIndices[name] = append(writeIndices[name], alias.Index)
+	}
+	s.indicesMutex.Lock()
+	defer s.indicesMutex.Unlock()
+	s.writeIndices = writeIndices
+	return nil
+}
+
+// resolveWriteIndices replaces the aliases of the bulk items with the
+// physical indices receiving the writes, or their monthly partitions if they
+// are partitioned, duplicating the items during a cutover; unknown aliases
+// and index names are left untouched, unless the deployments are partitioned,
+// as the partitions are named after the physical index
+func (s *opensearchStore) resolveWriteIndices(items []BulkItem) ([]BulkItem, error) {
+	s.indicesMutex.RLock()
+	defer s.indicesMutex.RUnlock()
+	resolved := make([]BulkItem, 0, len(items))
+	for _, item := range items {
+		desc := item.Action.Desc
+		indices := s.writeIndices[desc.Index]
+		if len(indices) == 0 {
+			if desc.Partition != "" && s.deploymentsMonthly {
+				return nil, errors.Errorf("failed to resolve the write indices of %s: "+
+					"cannot write to the partition %s", desc.Index, desc.Partition)
+			}
+			resolved = append(resolved, resolvedItem(item, desc.Index, ""))
+			continue
+		}
+		for _, index := range indices {
+			if partitioned(index) {
+				resolved = append(resolved, resolvedItem(item, index, desc.Partition))
+			} else {
+				resolved = append(resolved, resolvedItem(item, index, ""))
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// resolvedItem returns a copy of the bulk item writing to the physical index,
+// or to its monthly partition
+func resolvedItem(item BulkItem, indexName, partition string) BulkItem {
+	desc := *item.Action.Desc
+	desc.Index = partitionIndexName(indexName, partition)
+	desc.Partition = partition
+	return BulkItem{
+		Action: &BulkAction{
+			Type: item.Action.Type,
+			Desc: &desc,
+		},
+		Doc: item.Doc,
+	}
+}
+
+// migrateIndex makes the alias point to the physical index holding the given
+// version of the index template. A legacy index named as the alias, or an
+// older version, is replaced without downtime:
+//  1. the new version is created, and receives the writes too;
+//  2. the documents are copied from the old index to the new one;
+//  3. the alias is swapped atomically to the new version;
+//  4. the old index stops receiving the writes, and is deleted.
+//
+// The legacy index is written directly by the processes of the previous
+// versions, rather than through the write alias: before the swap, its writes
+// are blocked and the documents created since the first copy are copied
+// again, see migrateLegacyCatchUp. An interrupted migration is resumed by
+// calling migrateIndex again.
+func (s *opensearchStore) migrateIndex(ctx context.Context, alias string,
+	version, shards int, copyDest model.M) error {
+	l := log.FromContext(ctx)
+	target := versionedIndexName(alias, version)
+
+	current, err := s.getAliasIndices(ctx, alias)
+	if err != nil {
+		return err
+	}
+	for _, index := range current {
+		if index == target {
+			return s.migrateCleanup(ctx, alias, target)
+		}
+	}
+	legacy := false
+	if len(current) == 0 {
+		legacy, err = s.indexExists(ctx, alias)
+		if err != nil {
+			return err
+		}
+		if legacy {
+			current = []string{alias}
+			// an interrupted cutover may have blocked the writes
+			err = s.blockWrites(ctx, alias, false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = s.migrateCreateIndex(ctx, target, shards)
+	if err != nil {
+		return err
+	}
+	if len(current) == 0 {
+		return s.updateAliases(ctx,
+			model.M{"add": model.M{"index": target, "alias": alias, "is_write_index": true}},
+			model.M{"add": model.M{"index": target, "alias": writeAliasName(alias)}},
+		)
+	}
+
+	l.Infof("migrate %s from %s to %s", alias, strings.Join(current, ", "), target)
+	// the writes to the partitions go through their physical index
+	writeIndices := []string{target}
+	for _, index := range current {
+		if !partitionRegexp.MatchString(index) {
+			writeIndices = append(writeIndices, index)
+		}
+	}
+	err = s.updateAliases(ctx,
+		model.M{"add": model.M{
+			"indices": writeIndices,
+			"alias":   writeAliasName(alias),
+		}},
+	)
+	if err == nil {
+		err = s.settle(ctx)
+	}
+	if err == nil {
+		err = s.reindex(ctx, model.M{"index": alias}, target,
+			copyDest, partitionCopyDest(target))
+	}
+	if err == nil && legacy {
+		err = s.migrateLegacyCatchUp(ctx, alias, target, copyDest)
+	}
+	if err != nil {
+		return err
+	}
+
+	var actions []model.M
+	if legacy {
+		// removing the legacy index lets the alias take its name
+		actions = append(actions, model.M{"remove_index": model.M{"index": alias}})
+	} else {
+		// the old version may have new partitions since the copy started
+		current, err = s.getAliasIndices(ctx, alias)
+		if err != nil {
+			return err
+		}
+		actions = append(actions, model.M{"remove": model.M{"indices": current, "alias": alias}})
+	}
+	actions = append(actions,
+		model.M{"add": model.M{"index": target, "alias": alias, "is_write_index": true}})
+	if partitioned(target) {
+		partitions, err := s.getPartitions(ctx, target)
+		if err != nil {
+			return err
+		} else if len(partitions) > 0 {
+			actions = append(actions,
+				model.M{"add": model.M{"indices": partitions, "alias": alias}})
+		}
+	}
+	err = s.updateAliases(ctx, actions...)
+	if err != nil || legacy {
+		return err
+	}
+	return s.migrateCleanup(ctx, alias, target)
+}
+
+// migrateLegacyCatchUp copies again the documents written to the legacy
+// index since the first copy started, by the processes of the previous
+// versions: the legacy index stops receiving the writes through the write
+// alias, then its writes are blocked, so that the copy catches all the
+// writes which succeeded; the later writes of the previous versions fail,
+// and are lost as they are never retried. The copy creates the missing
+// documents, and updates the devices with a newer version, but not the other
+// documents already copied: updates to those are lost too, unless the
+// previous versions are stopped before migrating
+func (s *opensearchStore) migrateLegacyCatchUp(ctx context.Context,
+	alias, target string, copyDest model.M) error {
+	err := s.updateAliases(ctx,
+		model.M{"remove": model.M{"index": alias, "alias": writeAliasName(alias)}},
+	)
+	if err == nil {
+		err = s.settle(ctx)
+	}
+	if err == nil {
+		err = s.blockWrites(ctx, alias, true)
+	}
+	if err == nil {
+		log.FromContext(ctx).Infof("copy the documents written to %s meanwhile", alias)
+		err = s.reindex(ctx, model.M{"index": alias}, target,
+			copyDest, partitionCopyDest(target))
+	}
+	return err
+}
+
+// blockWrites blocks, or unblocks, the writes to the index
+func (s *opensearchStore) blockWrites(ctx context.Context, index string, block bool) error {
+	var value interface{}
+	if block {
+		value = true
+	}
+	body, err := json.Marshal(model.M{"index.blocks.write": value})
+	if err != nil {
+		return err
+	}
+	req := opensearchapi.IndicesPutSettingsRequest{
+		Index: []string{index},
+		Body:  bytes.NewReader(body),
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to block the writes")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		body, _ := ioutil.ReadAll(res.Body)
+		return errors.Errorf("failed to block the writes: %s", string(body))
+	}
+	return nil
+}
+
+// migrateCleanup deletes the old versions of the index, once they stopped
+// receiving the writes
+func (s *opensearchStore) migrateCleanup(ctx context.Context, alias, target string) error {
+	writeIndices, err := s.getAliasIndices(ctx, writeAliasName(alias))
+	if err != nil {
+		return err
+	}
+	var old []string
+	for _, index := range writeIndices {
+		if index != target {
+			old = append(old, index)
+		}
+	}
+	if len(old) == 0 {
+		return nil
+	}
+	err = s.updateAliases(ctx,
+		model.M{"remove": model.M{"indices": old, "alias": writeAliasName(alias)}},
+	)
+	if err == nil {
+		err = s.settle(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	indices := old
+	for _, index := range old {
+		if !partitioned(index) {
+			continue
+		}
+		partitions, err := s.getPartitions(ctx, index)
+		if err != nil {
+			return err
+		}
+		indices = append(indices, partitions...)
+	}
+	log.FromContext(ctx).Infof("delete the indices %s", strings.Join(indices, ", "))
+	return s.deleteIndices(ctx, indices)
+}
+
+// settle refreshes the write indices, and lets the other processes do the
+// same before going ahead with the cutover
+func (s *opensearchStore) settle(ctx context.Context) error {
+	err := s.RefreshIndices(ctx)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).Infof("waiting %s for the processes to reload the aliases",
+		s.cutoverSettle)
+	select {
+	case <-time.After(s.cutoverSettle):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (s *opensearchStore) catAliases(ctx context.Context, name string) ([]catAlias, error) {
+	req := opensearchapi.CatAliasesRequest{
+		Name:   []string{name},
+		Format: "json",
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the aliases")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		body, _ := ioutil.ReadAll(res.Body)
+		return nil, errors.Errorf("failed to get the aliases: %s", string(body))
+	}
+	var aliases []catAlias
+	if err := json.NewDecoder(res.Body).Decode(&aliases); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the aliases")
+	}
+	return aliases, nil
+}
+
+// getAliasIndices returns the physical indices behind the alias
+func (s *opensearchStore) getAliasIndices(ctx context.Context, alias string) ([]string, error) {
+	aliases, err := s.catAliases(ctx, alias)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]string, 0, len(aliases))
+	for _, a := range aliases {
+		if a.Alias == alias {
+			indices = append(indices, a.Index)
+		}
+	}
+	return indices, nil
+}
+
+func (s *opensearchStore) updateAliases(ctx context.Context, actions ...model.M) error {
+	body, err := json.Marshal(model.M{"actions": actions})
+	if err != nil {
+		return err
+	}
+	req := opensearchapi.IndicesUpdateAliasesRequest{
+		Body: bytes.NewReader(body),
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to update the aliases")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		body, _ := ioutil.ReadAll(res.Body)
+		return errors.Errorf("failed to update the aliases: %s", string(body))
+	}
+	return nil
+}
+
+func (s *opensearchStore) indexExists(ctx context.Context, indexName string) (bool, error) {
+	req := opensearchapi.IndicesExistsRequest{
+		Index: []string{indexName},
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to verify the index")
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, errors.New("failed to verify the index")
+	}
+}
+
+// reindex copies the documents matching the source to the destination
+// index, with the given destination options, skipping the conflicting ones
+func (s *opensearchStore) reindex(ctx context.Context, source model.M, destIndex string,
+	destOpts ...model.M) error {
+	l := log.FromContext(ctx)
+	l.Infof("copy the documents from %s to %s", source["index"], destIndex)
+
+	dest := model.M{"index": destIndex}
+	for _, opts := range destOpts {
+		for key, value := range opts {
+			dest[key] = value
+		}
+	}
+	body, err := json.Marshal(model.M{
+		"source":    source,
+		"dest":      dest,
+		"conflicts": "proceed",
+	})
+	if err != nil {
+		return err
+	}
+	refresh := true
+	req := opensearchapi.ReindexRequest{
+		Body:    bytes.NewReader(body),
+		Refresh: &refresh,
+		Slices:  "auto",
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to copy the documents")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return errors.Errorf("failed to copy the documents: %s", string(body))
+	}
+	var reindexRes reindexResponse
+	if err := json.NewDecoder(res.Body).Decode(&reindexRes); err != nil {
+		return errors.Wrap(err, "failed to parse the reindex response")
+	} else if len(reindexRes.Failures) > 0 {
+		return errors.Errorf("failed to copy %d documents: %s",
+			len(reindexRes.Failures), reindexRes.Failures[0])
+	}
+	l.Infof("copied %d of %d documents, %d already up to date",
+		reindexRes.Created, reindexRes.Total, reindexRes.VersionConflicts)
+	return nil
+}
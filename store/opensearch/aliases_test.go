@@ -0,0 +1,354 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package opensearch
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+type aliasesTestResponse struct {
+	status int
+	body   string
+}
+
+func TestMigrateIndex(t *testing.T) {
+	const reindexOK = `{"total":1,"created":1,"failures":[]}`
+	testCases := map[string]struct {
+		alias     string
+		version   int
+		responses map[string][]aliasesTestResponse
+
+		requests []string
+		aliases  []string
+	}{
+		"ok, create": {
+			version: 1,
+			responses: map[string][]aliasesTestResponse{
+				"GET /_cat/aliases/devices": {{body: `[]`}},
+				"HEAD /devices":             {{status: http.StatusNotFound}},
+				"HEAD /devices_v1":          {{status: http.StatusNotFound}},
+			},
+			requests: []string{
+				"GET /_cat/aliases/devices",
+				"HEAD /devices",
+				"HEAD /devices_v1",
+				"PUT /devices_v1",
+				"POST /_aliases",
+			},
+			aliases: []string{
+				`{"actions":[{"add":{"alias":"devices","index":"devices_v1",` +
+					`"is_write_index":true}},` +
+					`{"add":{"alias":"devices_write","index":"devices_v1"}}]}`,
+			},
+		},
+		"ok, up to date": {
+			version: 1,
+			responses: map[string][]aliasesTestResponse{
+				"GET /_cat/aliases/devices": {{
+					body: `[{"alias":"devices","index":"devices_v1"}]`,
+				}},
+				"GET /_cat/aliases/devices_write": {{
+					body: `[{"alias":"devices_write","index":"devices_v1"}]`,
+				}},
+			},
+			requests: []string{
+				"GET /_cat/aliases/devices",
+				"GET /_cat/aliases/devices_write",
+			},
+		},
+		"ok, migrate the legacy index": {
+			version: 1,
+			responses: map[string][]aliasesTestResponse{
+				"GET /_cat/aliases/devices": {{body: `[]`}},
+				"HEAD /devices":             {{}},
+				"HEAD /devices_v1":          {{status: http.StatusNotFound}},
+				"GET /_cat/aliases/*_write": {{
+					body: `[{"alias":"devices_write","index":"devices_v1"},` +
+						`{"alias":"devices_write","index":"devices"}]`,
+				}, {
+					body: `[{"alias":"devices_write","index":"devices_v1"}]`,
+				}},
+				"POST /_reindex": {{body: reindexOK}, {body: reindexOK}},
+			},
+			requests: []string{
+				"GET /_cat/aliases/devices",
+				"HEAD /devices",
+				"PUT /devices/_settings",
+				"HEAD /devices_v1",
+				"PUT /devices_v1",
+				"POST /_aliases",
+				"GET /_cat/aliases/*_write",
+				"POST /_reindex",
+				// the documents written by the previous versions meanwhile
+				"POST /_aliases",
+				"GET /_cat/aliases/*_write",
+				"PUT /devices/_settings",
+				"POST /_reindex",
+				"POST /_aliases",
+			},
+			aliases: []string{
+				`{"actions":[{"add":{"alias":"devices_write",` +
+					`"indices":["devices_v1","devices"]}}]}`,
+				`{"actions":[{"remove":{"alias":"devices_write","index":"devices"}}]}`,
+				`{"actions":[{"remove_index":{"index":"devices"}},` +
+					`{"add":{"alias":"devices","index":"devices_v1","is_write_index":true}}]}`,
+			},
+		},
+		"ok, migrate to a new version": {
+			version: 2,
+			responses: map[string][]aliasesTestResponse{
+				"GET /_cat/aliases/devices": {{
+					body: `[{"alias":"devices","index":"devices_v1"}]`,
+				}, {
+					body: `[{"alias":"devices","index":"devices_v1"}]`,
+				}},
+				"HEAD /devices_v2": {{status: http.StatusNotFound}},
+				"GET /_cat/aliases/*_write": {{
+					body: `[{"alias":"devices_write","index":"devices_v1"},` +
+						`{"alias":"devices_write","index":"devices_v2"}]`,
+				}, {
+					body: `[{"alias":"devices_write","index":"devices_v2"}]`,
+				}},
+				"GET /_cat/aliases/devices_write": {{
+					body: `[{"alias":"devices_write","index":"devices_v1"},` +
+						`{"alias":"devices_write","index":"devices_v2"}]`,
+				}},
+				"POST /_reindex": {{body: reindexOK}},
+			},
+			requests: []string{
+				"GET /_cat/aliases/devices",
+				"HEAD /devices_v2",
+				"PUT /devices_v2",
+				"POST /_aliases",
+				"GET /_cat/aliases/*_write",
+				"POST /_reindex",
+				"GET /_cat/aliases/devices",
+				"POST /_aliases",
+				"GET /_cat/aliases/devices_write",
+				"POST /_aliases",
+				"GET /_cat/aliases/*_write",
+				"DELETE /devices_v1",
+			},
+			aliases: []string{
+				`{"actions":[{"add":{"alias":"devices_write",` +
+					`"indices":["devices_v2","devices_v1"]}}]}`,
+				`{"actions":[{"remove":{"alias":"devices","indices":["devices_v1"]}},` +
+					`{"add":{"alias":"devices","index":"devices_v2","is_write_index":true}}]}`,
+				`{"actions":[{"remove":{"alias":"devices_write",` +
+					`"indices":["devices_v1"]}}]}`,
+			},
+		},
+		"ok, partition the deployments": {
+			alias:   "deployments",
+			version: 1001,
+			responses: map[string][]aliasesTestResponse{
+				"GET /_cat/aliases/deployments": {{
+					body: `[{"alias":"deployments","index":"deployments_v1"}]`,
+				}, {
+					body: `[{"alias":"deployments","index":"deployments_v1"}]`,
+				}},
+				"HEAD /deployments_v1001":   {{status: http.StatusNotFound}},
+				"GET /_cat/aliases/*_write": {{body: `[]`}, {body: `[]`}},
+				"POST /_reindex":            {{body: reindexOK}},
+				"GET /_cat/indices/deployments_v1001-*": {{
+					body: `[{"index":"deployments_v1001-2023.10"}]`,
+				}},
+				"GET /_cat/aliases/deployments_write": {{
+					body: `[{"alias":"deployments_write","index":"deployments_v1"},` +
+						`{"alias":"deployments_write","index":"deployments_v1001"}]`,
+				}},
+			},
+			requests: []string{
+				"GET /_cat/aliases/deployments",
+				"HEAD /deployments_v1001",
+				"PUT /deployments_v1001",
+				"POST /_aliases",
+				"GET /_cat/aliases/*_write",
+				"POST /_reindex",
+				"GET /_cat/aliases/deployments",
+				"GET /_cat/indices/deployments_v1001-*",
+				"POST /_aliases",
+				"GET /_cat/aliases/deployments_write",
+				"POST /_aliases",
+				"GET /_cat/aliases/*_write",
+				"DELETE /deployments_v1",
+			},
+			aliases: []string{
+				`{"actions":[{"add":{"alias":"deployments_write",` +
+					`"indices":["deployments_v1001","deployments_v1"]}}]}`,
+				`{"actions":[{"remove":{"alias":"deployments",` +
+					`"indices":["deployments_v1"]}},` +
+					`{"add":{"alias":"deployments","index":"deployments_v1001",` +
+					`"is_write_index":true}},` +
+					`{"add":{"alias":"deployments",` +
+					`"indices":["deployments_v1001-2023.10"]}}]}`,
+				`{"actions":[{"remove":{"alias":"deployments_write",` +
+					`"indices":["deployments_v1"]}}]}`,
+			},
+		},
+		"ok, stop partitioning the deployments": {
+			alias:   "deployments",
+			version: 1,
+			responses: map[string][]aliasesTestResponse{
+				"GET /_cat/aliases/deployments": {{
+					body: `[{"alias":"deployments","index":"deployments_v1001"},` +
+						`{"alias":"deployments","index":"deployments_v1001-2023.10"}]`,
+				}, {
+					body: `[{"alias":"deployments","index":"deployments_v1001"},` +
+						`{"alias":"deployments","index":"deployments_v1001-2023.10"}]`,
+				}},
+				"HEAD /deployments_v1":      {{status: http.StatusNotFound}},
+				"GET /_cat/aliases/*_write": {{body: `[]`}, {body: `[]`}},
+				"POST /_reindex":            {{body: reindexOK}},
+				"GET /_cat/aliases/deployments_write": {{
+					body: `[{"alias":"deployments_write","index":"deployments_v1001"},` +
+						`{"alias":"deployments_write","index":"deployments_v1"}]`,
+				}},
+				"GET /_cat/indices/deployments_v1001-*": {{
+					body: `[{"index":"deployments_v1001-2023.10"}]`,
+				}},
+			},
+			requests: []string{
+				"GET /_cat/aliases/deployments",
+				"HEAD /deployments_v1",
+				"PUT /deployments_v1",
+				"POST /_aliases",
+				"GET /_cat/aliases/*_write",
+				"POST /_reindex",
+				"GET /_cat/aliases/deployments",
+				"POST /_aliases",
+				"GET /_cat/aliases/deployments_write",
+				"POST /_aliases",
+				"GET /_cat/aliases/*_write",
+				"GET /_cat/indices/deployments_v1001-*",
+				"DELETE /deployments_v1001,deployments_v1001-2023.10",
+			},
+			aliases: []string{
+				`{"actions":[{"add":{"alias":"deployments_write",` +
+					`"indices":["deployments_v1","deployments_v1001"]}}]}`,
+				`{"actions":[{"remove":{"alias":"deployments",` +
+					`"indices":["deployments_v1001","deployments_v1001-2023.10"]}},` +
+					`{"add":{"alias":"deployments","index":"deployments_v1",` +
+					`"is_write_index":true}}]}`,
+				`{"actions":[{"remove":{"alias":"deployments_write",` +
+					`"indices":["deployments_v1001"]}}]}`,
+			},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			if tc.alias == "" {
+				tc.alias = "devices"
+			}
+			var requests, aliases []string
+			calls := map[string]int{}
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					if r.URL.Path == "/" {
+						_, _ = w.Write([]byte(bulkTestInfo))
+						return
+					}
+					key := r.Method + " " + r.URL.Path
+					requests = append(requests, key)
+					if key == "POST /_aliases" {
+						body, _ := ioutil.ReadAll(r.Body)
+						aliases = append(aliases, string(body))
+					}
+					rsp := aliasesTestResponse{body: `{}`}
+					if responses := tc.responses[key]; len(responses) > calls[key] {
+						rsp = responses[calls[key]]
+					}
+					calls[key]++
+					if rsp.status != 0 {
+						w.WriteHeader(rsp.status)
+					}
+					_, _ = w.Write([]byte(rsp.body))
+				},
+			))
+			defer srv.Close()
+
+			s, err := NewStore(
+				WithServerAddresses([]string{srv.URL}),
+				WithDeploymentsIndexName("deployments"),
+				WithCutoverSettle(0),
+			)
+			assert.NoError(t, err)
+
+			err = s.(*opensearchStore).migrateIndex(context.Background(),
+				tc.alias, tc.version, 0, devicesCopyDest)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.requests, requests)
+			assert.Equal(t, tc.aliases, aliases)
+		})
+	}
+}
+
+func TestRefreshIndices(t *testing.T) {
+	var actions []string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/":
+				_, _ = w.Write([]byte(bulkTestInfo))
+			case "/_cat/aliases/*_write":
+				_, _ = w.Write([]byte(`[` +
+					`{"alias":"devices_write","index":"devices_v1"},` +
+					`{"alias":"devices_write","index":"devices_v2"}]`))
+			default:
+				var items []string
+				scanner := bufio.NewScanner(r.Body)
+				for scanner.Scan() {
+					if strings.Contains(scanner.Text(), `"_id"`) {
+						actions = append(actions, scanner.Text())
+						items = append(items, `{"index":{"status":200}}`)
+					}
+				}
+				_, _ = w.Write([]byte(`{"errors":false,"items":[` +
+					strings.Join(items, ",") + `]}`))
+			}
+		},
+	))
+	defer srv.Close()
+
+	s, err := NewStore(
+		WithServerAddresses([]string{srv.URL}),
+		WithDevicesIndexName("devices"),
+	)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	err = s.RefreshIndices(ctx)
+	assert.NoError(t, err)
+
+	_, err = s.BulkIndexDevices(ctx, []*model.Device{model.NewDevice("tenant", "1")}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`{"index":{"_id":"1","_index":"devices_v1","routing":"tenant"}}`,
+		`{"index":{"_id":"1","_index":"devices_v2","routing":"tenant"}}`,
+	}, actions)
+}
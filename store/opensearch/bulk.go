@@ -0,0 +1,389 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package opensearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/reporting/metrics"
+	"github.com/mendersoftware/reporting/store"
+)
+
+const (
+	defaultBulkMaxRetries  = 3
+	defaultBulkRetryDelay  = 500 * time.Millisecond
+	defaultBulkMaxItems    = 1000
+	defaultBulkMaxBytes    = 5 << 20
+	defaultBulkConcurrency = 2
+
+	versionTypeExternalGTE = "external_gte"
+
+	errTypeMarshalFailed = "marshal_failed"
+)
+
+type bulkResponse struct {
+	Errors bool                          `json:"errors"`
+	Items  []map[string]bulkResponseItem `json:"items"`
+}
+
+type bulkResponseItem struct {
+	ID     string               `json:"_id"`
+	Index  string               `json:"_index"`
+	Status int                  `json:"status"`
+	Error  *store.BulkItemError `json:"error,omitempty"`
+}
+
+// bulk sends the items to OpenSearch using the bulk API; the operations
+// which failed with a transient error, including the ones of the bulk
+// requests which failed as a whole, are retried with exponential backoff,
+// while the ones which failed permanently, or exhausted the retries, are
+// returned as a *store.BulkError. It returns the IDs of the documents
+// skipped because the index holds a newer version of them, even on error
+func (s *opensearchStore) bulk(ctx context.Context, items []BulkItem) ([]string, error) {
+	l := log.FromContext(ctx)
+
+	var failed, retried []store.BulkItemResult
+	var stale []string
+	skipped := map[string]bool{}
+	for attempt := 0; len(items) > 0; attempt++ {
+		if attempt > 0 {
+			delay := s.bulkRetryDelay << (attempt - 1)
+			l.Warnf("retrying %d bulk operations in %s", len(items), delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				// the operations not retried fail with their last result
+				return stale, &store.BulkError{Items: append(failed, retried...)}
+			}
+		}
+		results := s.doBulk(ctx, items)
+		var retry []BulkItem
+		retried = nil
+		for i := range results {
+			if results[i].Stale() {
+				l.Debugf("skipped, stale: %s", results[i].String())
+				metrics.StoreBulkItemsStale.Inc()
+				// the documents may be written to several indices
+				if !skipped[results[i].ID] {
+					skipped[results[i].ID] = true
+					stale = append(stale, results[i].ID)
+				}
+				continue
+			} else if !results[i].Failed() {
+				continue
+			} else if results[i].Retryable() && attempt < s.bulkMaxRetries {
+				retry = append(retry, items[i])
+				retried = append(retried, results[i])
+				continue
+			}
+			failed = append(failed, results[i])
+			errType := strconv.Itoa(results[i].Status)
+			if results[i].Error != nil {
+				errType = results[i].Error.Type
+			}
+			metrics.StoreBulkItemFailures.WithLabelValues(errType).Inc()
+		}
+		items = retry
+	}
+	if len(stale) > 0 {
+		l.Infof("skipped %d stale documents", len(stale))
+	}
+	if len(failed) > 0 {
+		return stale, &store.BulkError{Items: failed}
+	}
+	return stale, nil
+}
+
+// doBulk sends the items in bulk requests bounded in number of operations
+// and size, over up to bulkConcurrency concurrent lanes; the operations on
+// the same document always go through the same lane, preserving their order,
+// retries included (see doBulkLane). It returns the results of the
+// operations, in the same order as the items
+func (s *opensearchStore) doBulk(
+	ctx context.Context,
+	items []BulkItem,
+) []store.BulkItemResult {
+	results := make([]store.BulkItemResult, len(items))
+	lanes := s.bulkLanes(items)
+	if len(lanes) == 1 {
+		s.doBulkLane(ctx, items, lanes[0], results)
+		return results
+	}
+
+	var wg sync.WaitGroup
+	for _, lane := range lanes {
+		wg.Add(1)
+		go func(lane []int) {
+			defer wg.Done()
+			s.doBulkLane(ctx, items, lane, results)
+		}(lane)
+	}
+	wg.Wait()
+	return results
+}
+
+// bulkLanes splits the positions of the items in lanes, by document
+func (s *opensearchStore) bulkLanes(items []BulkItem) [][]int {
+	numLanes := s.bulkConcurrency
+	if numLanes > len(items) {
+		numLanes = len(items)
+	}
+	if numLanes <= 1 {
+		lane := make([]int, len(items))
+		for i := range items {
+			lane[i] = i
+		}
+		return [][]int{lane}
+	}
+	lanes := make([][]int, numLanes)
+	for i, item := range items {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(item.Action.Desc.ID))
+		lane := h.Sum32() % uint32(numLanes)
+		lanes[lane] = append(lanes[lane], i)
+	}
+	nonEmpty := lanes[:0]
+	for _, lane := range lanes {
+		if len(lane) > 0 {
+			nonEmpty = append(nonEmpty, lane)
+		}
+	}
+	return nonEmpty
+}
+
+// bulkChunk is the body of a bulk request, written while the items are
+// marshaled, and compressed on the fly if enabled. Streaming the body to
+// the request, rather than buffering it, is out of scope: the OpenSearch
+// client buffers the bodies anyway to retry the requests on another node,
+// so the memory is bounded by bulkMaxBytes instead
+type bulkChunk struct {
+	positions []int
+	size      int
+	buf       bytes.Buffer
+	zw        *gzip.Writer
+}
+
+func newBulkChunk(compress bool) *bulkChunk {
+	chunk := &bulkChunk{}
+	if compress {
+		chunk.zw = gzip.NewWriter(&chunk.buf)
+	}
+	return chunk
+}
+
+func (c *bulkChunk) add(position int, data []byte) error {
+	c.positions = append(c.positions, position)
+	c.size += len(data)
+	if c.zw != nil {
+		_, err := c.zw.Write(data)
+		return err
+	}
+	_, err := c.buf.Write(data)
+	return err
+}
+
+func (c *bulkChunk) body() (*bytes.Reader, error) {
+	if c.zw != nil {
+		if err := c.zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return bytes.NewReader(c.buf.Bytes()), nil
+}
+
+func (c *bulkChunk) reset() {
+	c.positions = c.positions[:0]
+	c.size = 0
+	c.buf.Reset()
+	if c.zw != nil {
+		c.zw.Reset(&c.buf)
+	}
+}
+
+// doBulkLane sends the items at the given positions, in order, cutting the
+// bulk requests at bulkMaxItems operations or bulkMaxBytes bytes; a single
+// operation larger than bulkMaxBytes is sent alone. To preserve the order of
+// the operations on the same document, the operations following one to be
+// retried on the same document are not sent, and fail as retryable, as do
+// the operations of a bulk request failing as a whole and the following ones
+func (s *opensearchStore) doBulkLane(
+	ctx context.Context,
+	items []BulkItem,
+	positions []int,
+	results []store.BulkItemResult,
+) {
+	// held holds the IDs of the documents with an operation to be retried
+	held := make(map[string]bool)
+	chunk := newBulkChunk(s.bulkCompression)
+	for n, i := range positions {
+		data, err := items[i].Marshal()
+		if err != nil {
+			results[i] = store.BulkItemResult{
+				Action: items[i].Action.Type,
+				ID:     items[i].Action.Desc.ID,
+				Index:  items[i].Action.Desc.Index,
+				Status: http.StatusBadRequest,
+				Error: &store.BulkItemError{
+					Type:   errTypeMarshalFailed,
+					Reason: err.Error(),
+				},
+			}
+			continue
+		}
+		if len(chunk.positions) > 0 && (len(chunk.positions) >= s.bulkMaxItems ||
+			chunk.size+len(data) > s.bulkMaxBytes) {
+			if err := s.doBulkRequest(ctx, items, chunk, results); err != nil {
+				failBulkRequest(ctx, items, append(chunk.positions, positions[n:]...),
+					results, err)
+				return
+			}
+			for _, j := range chunk.positions {
+				if results[j].Retryable() {
+					held[results[j].ID] = true
+				}
+			}
+			chunk.reset()
+		}
+		if held[items[i].Action.Desc.ID] {
+			results[i] = store.BulkItemResult{
+				Action: items[i].Action.Type,
+				ID:     items[i].Action.Desc.ID,
+				Index:  items[i].Action.Desc.Index,
+				Error: &store.BulkItemError{
+					Type:   store.ErrTypeRequestFailed,
+					Reason: "not sent: an earlier operation on the document is retried",
+				},
+			}
+			continue
+		}
+		if err := chunk.add(i, data); err != nil {
+			failBulkRequest(ctx, items, append(chunk.positions, positions[n+1:]...),
+				results, errors.Wrap(err, "failed to compress the bulk request"))
+			return
+		}
+	}
+	if len(chunk.positions) == 0 {
+		return
+	}
+	if err := s.doBulkRequest(ctx, items, chunk, results); err != nil {
+		failBulkRequest(ctx, items, chunk.positions, results, err)
+	}
+}
+
+// failBulkRequest fails the operations at the given positions as retryable,
+// keeping the status of the response if any
+func failBulkRequest(
+	ctx context.Context,
+	items []BulkItem,
+	positions []int,
+	results []store.BulkItemResult,
+	err error,
+) {
+	log.FromContext(ctx).Warnf("%d bulk operations failed: %s", len(positions), err)
+	for _, i := range positions {
+		results[i] = store.BulkItemResult{
+			Action: items[i].Action.Type,
+			ID:     items[i].Action.Desc.ID,
+			Index:  items[i].Action.Desc.Index,
+			Status: results[i].Status,
+			Error: &store.BulkItemError{
+				Type:   store.ErrTypeRequestFailed,
+				Reason: err.Error(),
+			},
+		}
+	}
+}
+
+// doBulkRequest sends a single bulk request, and stores the results of its
+// operations at their positions
+func (s *opensearchStore) doBulkRequest(
+	ctx context.Context,
+	items []BulkItem,
+	chunk *bulkChunk,
+	results []store.BulkItemResult,
+) error {
+	l := log.FromContext(ctx)
+	l.Debugf("opensearch bulk request: %d operations, %d bytes",
+		len(chunk.positions), chunk.size)
+
+	body, err := chunk.body()
+	if err != nil {
+		return errors.Wrap(err, "failed to compress the bulk request")
+	}
+	req := opensearchapi.BulkRequest{
+		Body: body,
+	}
+	if s.bulkCompression {
+		req.Header = http.Header{"Content-Encoding": []string{"gzip"}}
+	}
+	start := time.Now()
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		metrics.StoreBulkDuration.WithLabelValues(metrics.ResultError).
+			Observe(time.Since(start).Seconds())
+		return errors.Wrap(err, "failed to bulk index")
+	}
+	defer res.Body.Close()
+	metrics.StoreBulkDuration.WithLabelValues(strconv.Itoa(res.StatusCode)).
+		Observe(time.Since(start).Seconds())
+
+	for _, i := range chunk.positions {
+		results[i] = store.BulkItemResult{
+			Action: items[i].Action.Type,
+			ID:     items[i].Action.Desc.ID,
+			Index:  items[i].Action.Desc.Index,
+			Status: res.StatusCode,
+		}
+	}
+	if res.StatusCode == http.StatusTooManyRequests ||
+		res.StatusCode == http.StatusServiceUnavailable {
+		return nil
+	} else if res.IsError() {
+		body, _ := ioutil.ReadAll(res.Body)
+		return errors.Errorf("failed to bulk index: %s", string(body))
+	}
+
+	var bulkRes bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&bulkRes); err != nil {
+		return errors.Wrap(err, "failed to parse the bulk response")
+	} else if len(bulkRes.Items) != len(chunk.positions) {
+		return errors.Errorf(
+			"unexpected number of items in the bulk response: %d, expected %d",
+			len(bulkRes.Items), len(chunk.positions))
+	}
+	for j, item := range bulkRes.Items {
+		i := chunk.positions[j]
+		for action, itemRes := range item {
+			results[i].Action = action
+			results[i].Status = itemRes.Status
+			results[i].Error = itemRes.Error
+		}
+	}
+	return nil
+}
@@ -0,0 +1,549 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package opensearch
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+	"github.com/mendersoftware/reporting/store"
+)
+
+const bulkTestInfo = `{"version":{"number":"2.4.0","distribution":"opensearch"}}`
+
+type bulkTestResponse struct {
+	status int
+	body   string
+}
+
+func TestBulkIndexDeployments(t *testing.T) {
+	deployments := []*model.Deployment{
+		{ID: "1", TenantID: "tenant"},
+		{ID: "2", TenantID: "tenant"},
+	}
+	testCases := map[string]struct {
+		options   []StoreOption
+		responses []bulkTestResponse
+		requests  []int
+
+		err error
+	}{
+		"ok": {
+			responses: []bulkTestResponse{{
+				status: http.StatusOK,
+				body: `{"errors":false,"items":[` +
+					`{"index":{"_id":"1","_index":"deployments","status":201}},` +
+					`{"index":{"_id":"2","_index":"deployments","status":200}}]}`,
+			}},
+			requests: []int{2},
+		},
+		"ok, retry the rejected operations": {
+			responses: []bulkTestResponse{{
+				status: http.StatusOK,
+				body: `{"errors":true,"items":[` +
+					`{"index":{"_id":"1","_index":"deployments","status":201}},` +
+					`{"index":{"_id":"2","_index":"deployments","status":429,` +
+					`"error":{"type":"es_rejected_execution_exception","reason":"busy"}}}]}`,
+			}, {
+				status: http.StatusOK,
+				body: `{"errors":false,"items":[` +
+					`{"index":{"_id":"2","_index":"deployments","status":201}}]}`,
+			}},
+			requests: []int{2, 1},
+		},
+		"ok, retry the whole request": {
+			responses: []bulkTestResponse{{
+				status: http.StatusTooManyRequests,
+			}, {
+				status: http.StatusOK,
+				body: `{"errors":false,"items":[` +
+					`{"index":{"_id":"1","_index":"deployments","status":201}},` +
+					`{"index":{"_id":"2","_index":"deployments","status":200}}]}`,
+			}},
+			requests: []int{2, 2},
+		},
+		"ko, permanent failure": {
+			responses: []bulkTestResponse{{
+				status: http.StatusOK,
+				body: `{"errors":true,"items":[` +
+					`{"index":{"_id":"1","_index":"deployments","status":400,` +
+					`"error":{"type":"mapper_parsing_exception","reason":"bad"}}},` +
+					`{"index":{"_id":"2","_index":"deployments","status":201}}]}`,
+			}},
+			requests: []int{2},
+			err: &store.BulkError{Items: []store.BulkItemResult{{
+				Action: "index",
+				ID:     "1",
+				Index:  "deployments",
+				Status: http.StatusBadRequest,
+				Error: &store.BulkItemError{
+					Type:   "mapper_parsing_exception",
+					Reason: "bad",
+				},
+			}}},
+		},
+		"ko, retries exhausted": {
+			responses: []bulkTestResponse{{
+				status: http.StatusTooManyRequests,
+			}, {
+				status: http.StatusTooManyRequests,
+			}},
+			requests: []int{2, 2},
+			err: &store.BulkError{Items: []store.BulkItemResult{{
+				Action: "index",
+				ID:     "1",
+				Index:  "deployments",
+				Status: http.StatusTooManyRequests,
+			}, {
+				Action: "index",
+				ID:     "2",
+				Index:  "deployments",
+				Status: http.StatusTooManyRequests,
+			}}},
+		},
+		"ko, bad request": {
+			responses: []bulkTestResponse{{
+				status: http.StatusBadRequest,
+				body:   `{"error":"bad request"}`,
+			}},
+			requests: []int{2},
+			err: &store.BulkError{Items: []store.BulkItemResult{{
+				Action: "index",
+				ID:     "1",
+				Index:  "deployments",
+				Status: http.StatusBadRequest,
+				Error: &store.BulkItemError{
+					Type:   store.ErrTypeRequestFailed,
+					Reason: `failed to bulk index: {"error":"bad request"}`,
+				},
+			}, {
+				Action: "index",
+				ID:     "2",
+				Index:  "deployments",
+				Status: http.StatusBadRequest,
+				Error: &store.BulkItemError{
+					Type:   store.ErrTypeRequestFailed,
+					Reason: `failed to bulk index: {"error":"bad request"}`,
+				},
+			}}},
+		},
+		"ko, unexpected number of items": {
+			responses: []bulkTestResponse{{
+				status: http.StatusOK,
+				body:   `{"errors":false,"items":[]}`,
+			}},
+			requests: []int{2},
+			err: &store.BulkError{Items: []store.BulkItemResult{{
+				Action: "index",
+				ID:     "1",
+				Index:  "deployments",
+				Status: http.StatusOK,
+				Error: &store.BulkItemError{
+					Type: store.ErrTypeRequestFailed,
+					Reason: "unexpected number of items in the bulk response: " +
+						"0, expected 2",
+				},
+			}, {
+				Action: "index",
+				ID:     "2",
+				Index:  "deployments",
+				Status: http.StatusOK,
+				Error: &store.BulkItemError{
+					Type: store.ErrTypeRequestFailed,
+					Reason: "unexpected number of items in the bulk response: " +
+						"0, expected 2",
+				},
+			}}},
+		},
+		"ok, retry the failed request": {
+			options: []StoreOption{
+				WithBulkLimits(1, defaultBulkMaxBytes),
+			},
+			responses: []bulkTestResponse{{
+				status: http.StatusOK,
+				body: `{"errors":false,"items":[` +
+					`{"index":{"_id":"1","_index":"deployments","status":201}}]}`,
+			}, {
+				status: http.StatusBadGateway,
+			}, {
+				status: http.StatusOK,
+				body: `{"errors":false,"items":[` +
+					`{"index":{"_id":"2","_index":"deployments","status":201}}]}`,
+			}},
+			requests: []int{1, 1, 1},
+		},
+		"ko, later request failed": {
+			options: []StoreOption{
+				WithBulkLimits(1, defaultBulkMaxBytes),
+				WithBulkRetries(0, time.Millisecond),
+			},
+			responses: []bulkTestResponse{{
+				status: http.StatusOK,
+				body: `{"errors":false,"items":[` +
+					`{"index":{"_id":"1","_index":"deployments","status":201}}]}`,
+			}, {
+				status: http.StatusBadRequest,
+				body:   `{"error":"bad request"}`,
+			}},
+			requests: []int{1, 1},
+			err: &store.BulkError{Items: []store.BulkItemResult{{
+				Action: "index",
+				ID:     "2",
+				Index:  "deployments",
+				Status: http.StatusBadRequest,
+				Error: &store.BulkItemError{
+					Type:   store.ErrTypeRequestFailed,
+					Reason: `failed to bulk index: {"error":"bad request"}`,
+				},
+			}}},
+		},
+		"ko, request failed, following operations not sent": {
+			options: []StoreOption{
+				WithBulkLimits(1, defaultBulkMaxBytes),
+			},
+			responses: []bulkTestResponse{{
+				status: http.StatusBadRequest,
+				body:   `{"error":"bad request"}`,
+			}},
+			requests: []int{1},
+			err: &store.BulkError{Items: []store.BulkItemResult{{
+				Action: "index",
+				ID:     "1",
+				Index:  "deployments",
+				Status: http.StatusBadRequest,
+				Error: &store.BulkItemError{
+					Type:   store.ErrTypeRequestFailed,
+					Reason: `failed to bulk index: {"error":"bad request"}`,
+				},
+			}, {
+				Action: "index",
+				ID:     "2",
+				Index:  "deployments",
+				Error: &store.BulkItemError{
+					Type:   store.ErrTypeRequestFailed,
+					Reason: `failed to bulk index: {"error":"bad request"}`,
+				},
+			}}},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var requests []int
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					if r.URL.Path == "/" {
+						_, _ = w.Write([]byte(bulkTestInfo))
+						return
+					}
+					lines := 0
+					scanner := bufio.NewScanner(r.Body)
+					for scanner.Scan() {
+						lines++
+					}
+					requests = append(requests, lines/2)
+					rsp := tc.responses[len(requests)-1]
+					w.WriteHeader(rsp.status)
+					_, _ = w.Write([]byte(rsp.body))
+				},
+			))
+			defer srv.Close()
+
+			options := append([]StoreOption{
+				WithServerAddresses([]string{srv.URL}),
+				WithDeploymentsIndexName("deployments"),
+				WithBulkRetries(len(tc.responses)-1, time.Millisecond),
+				WithBulkConcurrency(1),
+			}, tc.options...)
+			s, err := NewStore(options...)
+			assert.NoError(t, err)
+
+			err = s.BulkIndexDeployments(context.Background(), deployments)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				if bulkErr, ok := tc.err.(*store.BulkError); ok {
+					assert.Equal(t, bulkErr, err)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.requests, requests)
+		})
+	}
+}
+
+func TestBulkIndexDevicesVersioning(t *testing.T) {
+	updatedAt := time.Date(2023, 1, 2, 3, 4, 5, 6, time.UTC)
+	devices := []*model.Device{
+		model.NewDevice("tenant", "1").SetUpdatedAt(updatedAt),
+		model.NewDevice("tenant", "2"),
+	}
+	removedDevices := []*model.Device{
+		model.NewDevice("tenant", "3"),
+	}
+
+	var actions []string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Path == "/" {
+				_, _ = w.Write([]byte(bulkTestInfo))
+				return
+			}
+			scanner := bufio.NewScanner(r.Body)
+			for scanner.Scan() {
+				if strings.Contains(scanner.Text(), `"_id"`) {
+					actions = append(actions, scanner.Text())
+				}
+			}
+			_, _ = w.Write([]byte(`{"errors":true,"items":[` +
+				`{"index":{"_id":"1","_index":"devices","status":409,` +
+				`"error":{"type":"version_conflict_engine_exception","reason":"stale"}}},` +
+				`{"index":{"_id":"2","_index":"devices","status":201}},` +
+				`{"delete":{"_id":"3","_index":"devices","status":404}}]}`))
+		},
+	))
+	defer srv.Close()
+
+	s, err := NewStore(
+		WithServerAddresses([]string{srv.URL}),
+		WithDevicesIndexName("devices"),
+		WithBulkConcurrency(1),
+	)
+	assert.NoError(t, err)
+
+	stale, err := s.BulkIndexDevices(context.Background(), devices, removedDevices)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, stale)
+	assert.Equal(t, []string{
+		`{"index":{"_id":"1","_index":"devices","routing":"tenant",` +
+			`"version":1672628645000000006,"version_type":"external_gte"}}`,
+		`{"index":{"_id":"2","_index":"devices","routing":"tenant"}}`,
+		`{"delete":{"_id":"3","_index":"devices","routing":"tenant"}}`,
+	}, actions)
+}
+
+func TestBulkOrder(t *testing.T) {
+	// two operations on the document 1, around one on the document 2
+	items := []BulkItem{{
+		Action: &BulkAction{Type: "index", Desc: &BulkActionDesc{ID: "1", Index: "a"}},
+		Doc:    map[string]string{"id": "1"},
+	}, {
+		Action: &BulkAction{Type: "index", Desc: &BulkActionDesc{ID: "2", Index: "a"}},
+		Doc:    map[string]string{"id": "2"},
+	}, {
+		Action: &BulkAction{Type: "index", Desc: &BulkActionDesc{ID: "1", Index: "b"}},
+		Doc:    map[string]string{"id": "1"},
+	}}
+
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Path == "/" {
+				_, _ = w.Write([]byte(bulkTestInfo))
+				return
+			}
+			scanner := bufio.NewScanner(r.Body)
+			scanner.Scan()
+			var action map[string]BulkActionDesc
+			_ = json.Unmarshal(scanner.Bytes(), &action)
+			desc := action["index"]
+			requests = append(requests, desc.Index+"/"+desc.ID)
+			// the first request is rejected as a whole
+			if len(requests) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, _ = w.Write([]byte(`{"errors":false,"items":[` +
+				`{"index":{"_id":"` + desc.ID + `","status":201}}]}`))
+		},
+	))
+	defer srv.Close()
+
+	s, err := NewStore(
+		WithServerAddresses([]string{srv.URL}),
+		WithBulkLimits(1, defaultBulkMaxBytes),
+		WithBulkConcurrency(1),
+		WithBulkRetries(1, time.Millisecond),
+	)
+	assert.NoError(t, err)
+
+	_, err = s.(*opensearchStore).bulk(context.Background(), items)
+	assert.NoError(t, err)
+	// the second operation on the document 1 waits for the first one
+	assert.Equal(t, []string{"a/1", "a/2", "a/1", "b/1"}, requests)
+}
+
+func TestBulkIndexDevicesChunks(t *testing.T) {
+	devices := []*model.Device{
+		model.NewDevice("tenant", "1"),
+		model.NewDevice("tenant", "2"),
+		model.NewDevice("tenant", "3"),
+		model.NewDevice("tenant", "4"),
+		model.NewDevice("tenant", "5"),
+	}
+
+	testCases := map[string]struct {
+		options []StoreOption
+
+		requests [][]string
+		sorted   bool
+	}{
+		"ok, single request": {
+			requests: [][]string{{"1", "2", "3", "4", "5"}},
+		},
+		"ok, split by number of operations": {
+			options: []StoreOption{
+				WithBulkLimits(2, defaultBulkMaxBytes),
+			},
+			requests: [][]string{{"1", "2"}, {"3", "4"}, {"5"}},
+		},
+		"ok, split by size, operations larger than the limit sent alone": {
+			options: []StoreOption{
+				WithBulkLimits(defaultBulkMaxItems, 1),
+			},
+			requests: [][]string{{"1"}, {"2"}, {"3"}, {"4"}, {"5"}},
+		},
+		"ok, compressed": {
+			options: []StoreOption{
+				WithBulkLimits(2, defaultBulkMaxBytes),
+				WithBulkCompression(true),
+			},
+			requests: [][]string{{"1", "2"}, {"3", "4"}, {"5"}},
+		},
+		"ok, concurrent": {
+			options: []StoreOption{
+				WithBulkLimits(1, defaultBulkMaxBytes),
+				WithBulkConcurrency(3),
+				WithBulkCompression(true),
+			},
+			requests: [][]string{{"1"}, {"2"}, {"3"}, {"4"}, {"5"}},
+			sorted:   true,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			compressed := false
+			var mutex sync.Mutex
+			var requests [][]string
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					if r.URL.Path == "/" {
+						_, _ = w.Write([]byte(bulkTestInfo))
+						return
+					}
+					var body io.Reader = r.Body
+					if r.Header.Get("Content-Encoding") == "gzip" {
+						zr, err := gzip.NewReader(r.Body)
+						if !assert.NoError(t, err) {
+							w.WriteHeader(http.StatusBadRequest)
+							return
+						}
+						body = zr
+						compressed = true
+					}
+					var ids, items []string
+					scanner := bufio.NewScanner(body)
+					for scanner.Scan() {
+						var action map[string]BulkActionDesc
+						err := json.Unmarshal(scanner.Bytes(), &action)
+						if err != nil || action["index"].ID == "" {
+							continue
+						}
+						ids = append(ids, action["index"].ID)
+						items = append(items, `{"index":{"_id":"`+
+							action["index"].ID+`","status":201}}`)
+					}
+					mutex.Lock()
+					requests = append(requests, ids)
+					mutex.Unlock()
+					_, _ = w.Write([]byte(`{"errors":false,"items":[` +
+						strings.Join(items, ",") + `]}`))
+				},
+			))
+			defer srv.Close()
+
+			options := append([]StoreOption{
+				WithServerAddresses([]string{srv.URL}),
+				WithDevicesIndexName("devices"),
+				WithBulkConcurrency(1),
+			}, tc.options...)
+			s, err := NewStore(options...)
+			assert.NoError(t, err)
+
+			_, err = s.BulkIndexDevices(context.Background(), devices, nil)
+			assert.NoError(t, err)
+			if tc.sorted {
+				sort.Slice(requests, func(i, j int) bool {
+					return requests[i][0] < requests[j][0]
+				})
+			}
+			assert.Equal(t, tc.requests, requests)
+			assert.Equal(t, s.(*opensearchStore).bulkCompression, compressed)
+		})
+	}
+}
+
+func TestNewStoreBulkLimits(t *testing.T) {
+	testCases := map[string]struct {
+		maxItems int
+		maxBytes int
+
+		err string
+	}{
+		"ok": {
+			maxItems: 1,
+			maxBytes: 1,
+		},
+		"ko, no operations": {
+			maxItems: 0,
+			maxBytes: defaultBulkMaxBytes,
+			err:      "invalid bulk limits: 0 operations, 5242880 bytes",
+		},
+		"ko, negative size": {
+			maxItems: defaultBulkMaxItems,
+			maxBytes: -1,
+			err:      "invalid bulk limits: 1000 operations, -1 bytes",
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			_, err := NewStore(WithBulkLimits(tc.maxItems, tc.maxBytes))
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package opensearch
+
+// indexDeploymentSummariesVersion is the version of the index template; bump it whenever the
+// template changes, to migrate the existing indices to a new physical index
+const indexDeploymentSummariesVersion = 1
+
+const indexDeploymentSummariesTemplate = `{
+	"index_patterns": ["%s*"],
+	"priority": 1,
+	"template": {
+		"settings": {
+			"number_of_shards": %d,
+			"number_of_replicas": %d
+		},
+		"mappings": {
+			"dynamic": false,
+			"date_detection": false,
+			"numeric_detection": false,
+			"_source": {
+				"enabled": true
+			},
+			"dynamic_templates": [
+				{
+					"device_counts": {
+						"path_match": "device_counts.*",
+						"mapping": {
+							"type": "integer"
+						}
+					}
+				}
+			],
+			"properties": {
+				"id": {
+					"type": "keyword"
+				},
+				"tenant_id": {
+					"type": "keyword"
+				},
+				"deployment_id": {
+					"type": "keyword"
+				},
+				"deployment_name": {
+					"type": "keyword"
+				},
+				"deployment_artifact_name": {
+					"type": "keyword"
+				},
+				"deployment_type": {
+					"type": "keyword"
+				},
+				"deployment_status": {
+					"type": "keyword"
+				},
+				"deployment_created": {
+					"type": "date"
+				},
+				"deployment_finished": {
+					"type": "date"
+				},
+				"deployment_filter_id": {
+					"type": "keyword"
+				},
+				"deployment_all_devices": {
+					"type": "boolean"
+				},
+				"deployment_groups": {
+					"type": "keyword"
+				},
+				"deployment_phased": {
+					"type": "boolean"
+				},
+				"deployment_phases": {
+					"properties": {
+						"id": {
+							"type": "keyword"
+						},
+						"batch_size": {
+							"type": "integer"
+						},
+						"start_ts": {
+							"type": "date"
+						},
+						"device_count": {
+							"type": "integer"
+						}
+					}
+				},
+				"initial_device_count": {
+					"type": "integer"
+				},
+				"device_count": {
+					"type": "integer"
+				},
+				"device_counts": {
+					"type": "object",
+					"dynamic": true
+				},
+				"success_ratio": {
+					"type": "double"
+				}
+			}
+		}
+	}
+}`
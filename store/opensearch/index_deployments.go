@@ -14,6 +14,10 @@
 
 package opensearch
 
+// indexDeploymentsVersion is the version of the index template; bump it whenever the
+// template changes, to migrate the existing indices to a new physical index
+const indexDeploymentsVersion = 1
+
 const indexDeploymentsTemplate = `{
 	"index_patterns": ["%s*"],
 	"priority": 1,
@@ -29,6 +33,32 @@ const indexDeploymentsTemplate = `{
 			"_source": {
 				"enabled": true
 			},
+			"dynamic_templates": [
+				{
+					"device_attributes_nums": {
+						"path_match": "device_attributes.*_num",
+						"mapping": {
+							"type": "double"
+						}
+					}
+				},
+				{
+					"device_attributes_strings": {
+						"path_match": "device_attributes.*_str",
+						"mapping": {
+							"type": "keyword"
+						}
+					}
+				},
+				{
+					"device_attributes_bools": {
+						"path_match": "device_attributes.*_bool",
+						"mapping": {
+							"type": "boolean"
+						}
+					}
+				}
+			],
 			"properties": {
 				"id": {
 					"type": "keyword"
@@ -134,8 +164,49 @@ const indexDeploymentsTemplate = `{
 				},
 				"image_size": {
 					"type": "integer"
+				},
+				"device_attributes": {
+					"type": "object",
+					"dynamic": true
+				}
+			}
+		}
+	}
+}`
+
+// deploymentsDeviceAttributesMapping adds the device attributes snapshot
+// to the mapping of the deployments indices created before it existed
+const deploymentsDeviceAttributesMapping = `{
+	"dynamic_templates": [
+		{
+			"device_attributes_nums": {
+				"path_match": "device_attributes.*_num",
+				"mapping": {
+					"type": "double"
 				}
 			}
+		},
+		{
+			"device_attributes_strings": {
+				"path_match": "device_attributes.*_str",
+				"mapping": {
+					"type": "keyword"
+				}
+			}
+		},
+		{
+			"device_attributes_bools": {
+				"path_match": "device_attributes.*_bool",
+				"mapping": {
+					"type": "boolean"
+				}
+			}
+		}
+	],
+	"properties": {
+		"device_attributes": {
+			"type": "object",
+			"dynamic": true
 		}
 	}
 }`
@@ -14,6 +14,10 @@
 
 package opensearch
 
+// indexDevicesVersion is the version of the index template; bump it whenever the
+// template changes, to migrate the existing indices to a new physical index
+const indexDevicesVersion = 1
+
 const indexDevicesTemplate = `{
 	"index_patterns": ["%s*"],
 	"priority": 1,
@@ -0,0 +1,158 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+const errTypeIndexNotFound = "index_not_found_exception"
+
+type mgetDoc struct {
+	Index   string `json:"_index"`
+	ID      string `json:"_id"`
+	Routing string `json:"routing,omitempty"`
+}
+
+type mgetResponse struct {
+	Docs []struct {
+		ID     string                 `json:"_id"`
+		Found  bool                   `json:"found"`
+		Source map[string]interface{} `json:"_source"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"docs"`
+}
+
+// GetDevices returns the indexed devices of the tenant, by ID; unlike the
+// searches, the get requests are realtime and return the documents written
+// by the previous bulk requests even if the index was not refreshed yet
+func (s *opensearchStore) GetDevices(ctx context.Context, tenantID string,
+	ids []string) (map[string]map[string]interface{}, error) {
+	index := s.readIndex(s.GetDevicesIndex(tenantID), "")
+	routing := s.GetDevicesRoutingKey(tenantID)
+	docs := make([]mgetDoc, 0, len(ids))
+	for _, id := range ids {
+		docs = append(docs, mgetDoc{Index: index, ID: id, Routing: routing})
+	}
+	return s.mget(ctx, tenantID, docs)
+}
+
+// GetDeployments returns the indexed device deployments, by ID, looking
+// them up in the monthly partitions of their creation date
+func (s *opensearchStore) GetDeployments(ctx context.Context, tenantID string,
+	deployments []*model.Deployment) (map[string]map[string]interface{}, error) {
+	alias := s.GetDeploymentsIndex(tenantID)
+	routing := s.GetDeploymentsRoutingKey(tenantID)
+	docs := make([]mgetDoc, 0, len(deployments))
+	for _, deployment := range deployments {
+		docs = append(docs, mgetDoc{
+			Index:   s.readIndex(alias, s.deploymentPartition(deployment)),
+			ID:      deployment.ID,
+			Routing: routing,
+		})
+	}
+	return s.mget(ctx, tenantID, docs)
+}
+
+// readIndex returns the physical index, or its monthly partition if it is
+// partitioned, holding the documents behind the alias, as the get requests
+// cannot target aliases pointing to several indices; during a cutover, the
+// old version of the index is the only one holding all the documents
+func (s *opensearchStore) readIndex(alias, partition string) string {
+	s.indicesMutex.RLock()
+	indices := s.writeIndices[alias]
+	s.indicesMutex.RUnlock()
+	if len(indices) == 0 {
+		return alias
+	}
+	index := indices[0]
+	target := versionedIndexName(alias, s.targetVersion(alias))
+	for _, other := range indices {
+		if other != target {
+			index = other
+			break
+		}
+	}
+	if !partitioned(index) {
+		return index
+	}
+	return partitionIndexName(index, partition)
+}
+
+// targetVersion returns the version of the index template the physical
+// indices behind the alias are migrated to
+func (s *opensearchStore) targetVersion(alias string) int {
+	switch {
+	case alias == s.deploymentsIndexName ||
+		strings.HasPrefix(alias, s.deploymentsIndexName+"-"):
+		return s.deploymentsVersion()
+	case alias == s.summariesIndexName:
+		return indexDeploymentSummariesVersion
+	default:
+		return indexDevicesVersion
+	}
+}
+
+func (s *opensearchStore) mget(ctx context.Context, tenantID string,
+	docs []mgetDoc) (map[string]map[string]interface{}, error) {
+	ret := make(map[string]map[string]interface{}, len(docs))
+	if len(docs) == 0 {
+		return ret, nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(model.M{"docs": docs}); err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Mget(&buf, s.client.Mget.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the documents")
+	}
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		return nil, errors.New(resp.String())
+	}
+
+	var res mgetResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the response")
+	}
+	for _, doc := range res.Docs {
+		if doc.Error != nil {
+			// the monthly partitions are created on the first write
+			if doc.Error.Type == errTypeIndexNotFound {
+				continue
+			}
+			return nil, errors.Errorf("failed to get the document %s: %s: %s",
+				doc.ID, doc.Error.Type, doc.Error.Reason)
+		}
+		tid, _ := doc.Source[model.FieldNameTenantID].(string)
+		if doc.Found && tid == tenantID {
+			ret[doc.ID] = doc.Source
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package opensearch
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestGetDevices(t *testing.T) {
+	testCases := map[string]struct {
+		status   int
+		response string
+
+		docs map[string]map[string]interface{}
+		err  string
+	}{
+		"ok": {
+			response: `{"docs":[` +
+				`{"_id":"1","found":true,"_source":{"id":"1","tenant_id":"tenant"}},` +
+				`{"_id":"2","found":false},` +
+				`{"_id":"3","found":true,"_source":{"id":"3","tenant_id":"other"}}]}`,
+			docs: map[string]map[string]interface{}{
+				"1": {"id": "1", "tenant_id": "tenant"},
+			},
+		},
+		"ko, document error": {
+			response: `{"docs":[{"_id":"1","error":` +
+				`{"type":"shard_not_available_exception","reason":"no shard"}}]}`,
+			err: "failed to get the document 1: shard_not_available_exception: no shard",
+		},
+		"ko, request error": {
+			status:   http.StatusBadRequest,
+			response: `{"error":"bad request"}`,
+			err:      `[400 Bad Request] {"error":"bad request"}`,
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var body string
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					switch r.URL.Path {
+					case "/":
+						_, _ = w.Write([]byte(bulkTestInfo))
+					case "/_cat/aliases/*_write":
+						_, _ = w.Write([]byte(`[` +
+							`{"alias":"devices_write","index":"devices_v1"},` +
+							`{"alias":"devices_write","index":"devices"}]`))
+					case "/_mget":
+						data, _ := ioutil.ReadAll(r.Body)
+						body = string(data)
+						if tc.status != 0 {
+							w.WriteHeader(tc.status)
+						}
+						_, _ = w.Write([]byte(tc.response))
+					default:
+						w.WriteHeader(http.StatusNotFound)
+					}
+				},
+			))
+			defer srv.Close()
+
+			s, err := NewStore(
+				WithServerAddresses([]string{srv.URL}),
+				WithDevicesIndexName("devices"),
+			)
+			assert.NoError(t, err)
+
+			ctx := context.Background()
+			err = s.RefreshIndices(ctx)
+			assert.NoError(t, err)
+
+			docs, err := s.GetDevices(ctx, "tenant", []string{"1", "2", "3"})
+			// during a cutover, the documents are read from the old index
+			assert.JSONEq(t, `{"docs":[`+
+				`{"_index":"devices","_id":"1","routing":"tenant"},`+
+				`{"_index":"devices","_id":"2","routing":"tenant"},`+
+				`{"_index":"devices","_id":"3","routing":"tenant"}]}`, body)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.docs, docs)
+			}
+		})
+	}
+}
+
+func TestGetDeploymentsPartitions(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/":
+				_, _ = w.Write([]byte(bulkTestInfo))
+			case "/_cat/aliases/*_write":
+				// turning the monthly partitions off
+				_, _ = w.Write([]byte(`[` +
+					`{"alias":"deployments_write","index":"deployments_v1"},` +
+					`{"alias":"deployments_write","index":"deployments_v1001"}]`))
+			case "/_mget":
+				data, _ := ioutil.ReadAll(r.Body)
+				body = string(data)
+				_, _ = w.Write([]byte(`{"docs":[` +
+					`{"_id":"1","found":true,` +
+					`"_source":{"id":"1","tenant_id":"tenant"}},` +
+					`{"_index":"deployments_v1001-2023.02","_id":"2","error":` +
+					`{"type":"index_not_found_exception","reason":"no such index"}}]}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		},
+	))
+	defer srv.Close()
+
+	s, err := NewStore(
+		WithServerAddresses([]string{srv.URL}),
+		WithDeploymentsIndexName("deployments"),
+	)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	err = s.RefreshIndices(ctx)
+	assert.NoError(t, err)
+
+	jan := time.Date(2023, time.January, 31, 23, 0, 0, 0, time.UTC)
+	feb := time.Date(2023, time.February, 1, 1, 0, 0, 0, time.UTC)
+	docs, err := s.GetDeployments(ctx, "tenant", []*model.Deployment{
+		{ID: "1", TenantID: "tenant", DeploymentCreated: &jan},
+		{ID: "2", TenantID: "tenant", DeploymentCreated: &feb},
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"docs":[`+
+		`{"_index":"deployments_v1001-2023.01","_id":"1","routing":"tenant"},`+
+		`{"_index":"deployments_v1001-2023.02","_id":"2","routing":"tenant"}]}`, body)
+	assert.Equal(t, map[string]map[string]interface{}{
+		"1": {"id": "1", "tenant_id": "tenant"},
+	}, docs)
+}
@@ -0,0 +1,353 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	// partitionLayout is the layout of the monthly partition suffix
+	partitionLayout = "2006.01"
+
+	errTypeResourceAlreadyExists = "resource_already_exists_exception"
+)
+
+// partitionRegexp matches the monthly partitions of a physical index,
+// capturing the physical index and the month
+var partitionRegexp = regexp.MustCompile(`^(.+_v[0-9]+)-([0-9]{4}\.[0-9]{2})$`)
+
+// partitionScript moves the copied deployments to the monthly partition of
+// their creation date, like deploymentPartition does
+const partitionScript = `if (ctx._source.deployment_created != null) {
+	ZonedDateTime t = ZonedDateTime.parse(ctx._source.deployment_created);
+	ctx._index = params.index + '-' + t.withZoneSameInstant(ZoneOffset.UTC)
+		.format(DateTimeFormatter.ofPattern('yyyy.MM'));
+}`
+
+// monthlyVersionOffset is added to the version of the deployments index
+// template when the deployments are partitioned: turning the monthly
+// partitions on, or off, migrates the deployments to a new physical index,
+// like a new version of the template does
+const monthlyVersionOffset = 1000
+
+// versionRegexp captures the version of a physical index
+var versionRegexp = regexp.MustCompile(`_v([0-9]+)$`)
+
+// WithDeploymentsMonthlyIndices partitions the device deployments in monthly
+// indices, by the creation date of the deployment, which can be deleted
+// once older than the retention period
+func WithDeploymentsMonthlyIndices(monthly bool) StoreOption {
+	return func(s *opensearchStore) {
+		s.deploymentsMonthly = monthly
+	}
+}
+
+// deploymentsVersion returns the version of the physical indices holding the
+// device deployments
+func (s *opensearchStore) deploymentsVersion() int {
+	if s.deploymentsMonthly {
+		return indexDeploymentsVersion + monthlyVersionOffset
+	}
+	return indexDeploymentsVersion
+}
+
+// deploymentPartition returns the monthly partition of the deployment, used
+// if its physical index is partitioned, whatever the current setting, so that
+// the old version of the index is still written during a migration
+func (s *opensearchStore) deploymentPartition(deployment *model.Deployment) string {
+	if deployment.DeploymentCreated == nil {
+		return ""
+	}
+	return deployment.DeploymentCreated.UTC().Format(partitionLayout)
+}
+
+func partitionIndexName(indexName, partition string) string {
+	if partition == "" {
+		return indexName
+	}
+	return indexName + "-" + partition
+}
+
+// partitioned returns true if the documents of the physical index are split
+// in monthly partitions, as told by its version
+func partitioned(indexName string) bool {
+	m := versionRegexp.FindStringSubmatch(indexName)
+	if m == nil {
+		return false
+	}
+	version, _ := strconv.Atoi(m[1])
+	return version >= monthlyVersionOffset
+}
+
+// partitionCopyDest returns the reindex options copying the documents to the
+// monthly partitions of the physical index, if it is partitioned
+func partitionCopyDest(indexName string) model.M {
+	if !partitioned(indexName) {
+		return nil
+	}
+	return model.M{
+		"script": model.M{
+			"lang":   "painless",
+			"source": partitionScript,
+			"params": model.M{"index": indexName},
+		},
+	}
+}
+
+// getPartitions returns the monthly partitions of the physical index
+func (s *opensearchStore) getPartitions(ctx context.Context,
+	indexName string) ([]string, error) {
+	indices, err := s.catIndices(ctx, indexName+"-*")
+	if err != nil {
+		return nil, err
+	}
+	partitions := make([]string, 0, len(indices))
+	for _, index := range indices {
+		m := partitionRegexp.FindStringSubmatch(index)
+		if m != nil && m[1] == indexName {
+			partitions = append(partitions, index)
+		}
+	}
+	return partitions, nil
+}
+
+// aliasPartitions adds the alias to the monthly partitions of the physical
+// index, created by copying the documents
+func (s *opensearchStore) aliasPartitions(ctx context.Context,
+	alias, indexName string) error {
+	partitions, err := s.getPartitions(ctx, indexName)
+	if err != nil || len(partitions) == 0 {
+		return err
+	}
+	return s.updateAliases(ctx, model.M{"add": model.M{"indices": partitions, "alias": alias}})
+}
+
+// ensurePartitions creates the monthly partitions receiving the writes, with
+// the read alias of their physical index, so that they are searched
+func (s *opensearchStore) ensurePartitions(ctx context.Context, items []BulkItem) error {
+	for _, item := range items {
+		if item.Action.Desc.Partition == "" {
+			continue
+		}
+		index := item.Action.Desc.Index
+		s.indicesMutex.RLock()
+		known := s.partitions[index]
+		s.indicesMutex.RUnlock()
+		if known {
+			continue
+		}
+		if err := s.createPartition(ctx, index); err != nil {
+			return err
+		}
+		s.indicesMutex.Lock()
+		if s.partitions == nil {
+			s.partitions = make(map[string]bool)
+		}
+		s.partitions[index] = true
+		s.indicesMutex.Unlock()
+	}
+	return nil
+}
+
+func (s *opensearchStore) createPartition(ctx context.Context, indexName string) error {
+	l := log.FromContext(ctx)
+	m := partitionRegexp.FindStringSubmatch(indexName)
+	if m == nil {
+		return errors.Errorf("invalid partition name: %s", indexName)
+	}
+	aliases, err := s.getIndexAliases(ctx, m[1])
+	if err != nil {
+		return err
+	}
+	// the partitions of the new version of an index are searched once the
+	// read alias is swapped; they never receive the write alias
+	readAliases := model.M{}
+	for _, alias := range aliases {
+		if !strings.HasSuffix(alias, writeAliasSuffix) {
+			readAliases[alias] = model.M{}
+		}
+	}
+	body, err := json.Marshal(model.M{"aliases": readAliases})
+	if err != nil {
+		return err
+	}
+
+	l.Infof("create the partition %s", indexName)
+	req := opensearchapi.IndicesCreateRequest{
+		Index: indexName,
+		Body:  bytes.NewReader(body),
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the partition")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	var errRes struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	_ = json.Unmarshal(data, &errRes)
+	if errRes.Error.Type != errTypeResourceAlreadyExists {
+		return errors.Errorf("failed to create the partition: %s", string(data))
+	}
+	// the partition may have been created by a copy, without the aliases
+	for alias := range readAliases {
+		err = s.updateAliases(ctx,
+			model.M{"add": model.M{"index": indexName, "alias": alias}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneDeployments deletes the monthly partitions of the device deployments
+// ended before the given time, and returns their names
+func (s *opensearchStore) PruneDeployments(ctx context.Context,
+	before time.Time) ([]string, error) {
+	l := log.FromContext(ctx)
+	indices, err := s.catIndices(ctx, s.deploymentsIndexName+"*")
+	if err != nil {
+		return nil, err
+	}
+	var pruned []string
+	for _, index := range indices {
+		m := partitionRegexp.FindStringSubmatch(index)
+		if m == nil || !strings.HasPrefix(index, s.deploymentsIndexName) {
+			continue
+		}
+		start, err := time.Parse(partitionLayout, m[2])
+		if err != nil {
+			continue
+		}
+		if !start.AddDate(0, 1, 0).After(before) {
+			pruned = append(pruned, index)
+		}
+	}
+	if len(pruned) == 0 {
+		return nil, nil
+	}
+	sort.Strings(pruned)
+	l.Infof("delete the partitions %s", strings.Join(pruned, ", "))
+	err = s.deleteIndices(ctx, pruned)
+	if err != nil {
+		return nil, err
+	}
+	s.indicesMutex.Lock()
+	for _, index := range pruned {
+		delete(s.partitions, index)
+	}
+	s.indicesMutex.Unlock()
+	return pruned, nil
+}
+
+func (s *opensearchStore) catIndices(ctx context.Context, pattern string) ([]string, error) {
+	req := opensearchapi.CatIndicesRequest{
+		Index:  []string{pattern},
+		Format: "json",
+		H:      []string{"index"},
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the indices")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		body, _ := ioutil.ReadAll(res.Body)
+		return nil, errors.Errorf("failed to get the indices: %s", string(body))
+	}
+	var rows []struct {
+		Index string `json:"index"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&rows); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the indices")
+	}
+	indices := make([]string, 0, len(rows))
+	for _, row := range rows {
+		indices = append(indices, row.Index)
+	}
+	return indices, nil
+}
+
+// getIndexAliases returns the aliases of the physical index
+func (s *opensearchStore) getIndexAliases(ctx context.Context,
+	indexName string) ([]string, error) {
+	req := opensearchapi.IndicesGetAliasRequest{
+		Index: []string{indexName},
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the aliases")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		body, _ := ioutil.ReadAll(res.Body)
+		return nil, errors.Errorf("failed to get the aliases: %s", string(body))
+	}
+	var indexAliases map[string]struct {
+		Aliases map[string]interface{} `json:"aliases"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&indexAliases); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the aliases")
+	}
+	var aliases []string
+	for alias := range indexAliases[indexName].Aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases, nil
+}
+
+func (s *opensearchStore) deleteIndices(ctx context.Context, indices []string) error {
+	req := opensearchapi.IndicesDeleteRequest{
+		Index: indices,
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete the indices")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		body, _ := ioutil.ReadAll(res.Body)
+		return errors.Errorf("failed to delete the indices: %s", string(body))
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package opensearch
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestBulkIndexDeploymentsPartitions(t *testing.T) {
+	created := time.Date(2023, 10, 31, 23, 0, 0, 0, time.FixedZone("CET", -3600))
+	deployments := []*model.Deployment{
+		{ID: "1", TenantID: "tenant", DeploymentCreated: &created},
+		{ID: "2", TenantID: "tenant"},
+	}
+
+	var requests, actions []string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Path == "/" {
+				_, _ = w.Write([]byte(bulkTestInfo))
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, r.Method+" "+r.URL.Path+" "+string(body))
+			switch r.URL.Path {
+			case "/_cat/aliases/*_write":
+				// turning the monthly partitions on
+				_, _ = w.Write([]byte(`[` +
+					`{"alias":"deployments_write","index":"deployments_v1"},` +
+					`{"alias":"deployments_write","index":"deployments_v1001"}]`))
+			case "/deployments_v1001/_alias":
+				_, _ = w.Write([]byte(`{"deployments_v1001":{"aliases":` +
+					`{"deployments_write":{}}}}`))
+			case "/_bulk":
+				var items []string
+				scanner := bufio.NewScanner(strings.NewReader(string(body)))
+				for scanner.Scan() {
+					if strings.Contains(scanner.Text(), `"_id"`) {
+						actions = append(actions, scanner.Text())
+						items = append(items, `{"index":{"status":200}}`)
+					}
+				}
+				_, _ = w.Write([]byte(`{"errors":false,"items":[` +
+					strings.Join(items, ",") + `]}`))
+			default:
+				_, _ = w.Write([]byte(`{}`))
+			}
+		},
+	))
+	defer srv.Close()
+
+	s, err := NewStore(
+		WithServerAddresses([]string{srv.URL}),
+		WithDeploymentsIndexName("deployments"),
+		WithDeploymentsMonthlyIndices(true),
+		WithBulkConcurrency(1),
+	)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	err = s.RefreshIndices(ctx)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		err = s.BulkIndexDeployments(ctx, deployments)
+		assert.NoError(t, err)
+	}
+
+	// the partition of the new version is created once, without the read
+	// alias until the cutover; the old version is not partitioned
+	assert.Equal(t, []string{
+		"GET /_cat/aliases/*_write ",
+		"GET /deployments_v1001/_alias ",
+		`PUT /deployments_v1001-2023.11 {"aliases":{}}`,
+	}, requests[:3])
+	assert.Len(t, requests, 5)
+	written := []string{
+		`{"index":{"_id":"1","_index":"deployments_v1","routing":"tenant"}}`,
+		`{"index":{"_id":"1","_index":"deployments_v1001-2023.11","routing":"tenant"}}`,
+		`{"index":{"_id":"2","_index":"deployments_v1","routing":"tenant"}}`,
+		`{"index":{"_id":"2","_index":"deployments_v1001","routing":"tenant"}}`,
+	}
+	assert.Equal(t, append(written, written...), actions)
+}
+
+func TestBulkIndexDeploymentsUnresolved(t *testing.T) {
+	created := time.Date(2023, 10, 31, 23, 0, 0, 0, time.UTC)
+	deployments := []*model.Deployment{
+		{ID: "1", TenantID: "tenant", DeploymentCreated: &created},
+	}
+	testCases := map[string]struct {
+		monthly bool
+
+		actions []string
+		err     string
+	}{
+		"ok": {
+			actions: []string{
+				`{"index":{"_id":"1","_index":"deployments","routing":"tenant"}}`,
+			},
+		},
+		"ko, partitioned": {
+			monthly: true,
+			err: "failed to resolve the write indices of deployments: " +
+				"cannot write to the partition 2023.10",
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var actions []string
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					switch r.URL.Path {
+					case "/":
+						_, _ = w.Write([]byte(bulkTestInfo))
+					case "/_bulk":
+						body, _ := ioutil.ReadAll(r.Body)
+						actions = append(actions, strings.Split(string(body), "\n")[0])
+						_, _ = w.Write([]byte(
+							`{"errors":false,"items":[{"index":{"status":200}}]}`))
+					default:
+						w.WriteHeader(http.StatusBadRequest)
+					}
+				},
+			))
+			defer srv.Close()
+
+			// the write indices are not loaded
+			s, err := NewStore(
+				WithServerAddresses([]string{srv.URL}),
+				WithDeploymentsIndexName("deployments"),
+				WithDeploymentsMonthlyIndices(tc.monthly),
+			)
+			assert.NoError(t, err)
+
+			err = s.BulkIndexDeployments(context.Background(), deployments)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.actions, actions)
+		})
+	}
+}
+
+func TestPruneDeployments(t *testing.T) {
+	testCases := map[string]struct {
+		before  time.Time
+		indices string
+
+		pruned []string
+	}{
+		"ok": {
+			before: time.Date(2023, 11, 15, 0, 0, 0, 0, time.UTC),
+			indices: `[{"index":"deployments_v1"},` +
+				`{"index":"deployments_v1-2023.09"},` +
+				`{"index":"deployments_v1-2023.10"},` +
+				`{"index":"deployments_v1-2023.11"},` +
+				`{"index":"deployments-63f4c7a8e4b0d5a1c2b3e4f5_v1-2023.10"},` +
+				`{"index":"deployments-63f4c7a8e4b0d5a1c2b3e4f5_v1-2023.11"}]`,
+			pruned: []string{
+				"deployments-63f4c7a8e4b0d5a1c2b3e4f5_v1-2023.10",
+				"deployments_v1-2023.09",
+				"deployments_v1-2023.10",
+			},
+		},
+		"ok, nothing to prune": {
+			before: time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC),
+			indices: `[{"index":"deployments_v1"},` +
+				`{"index":"deployments_v1-2023.10"}]`,
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var deleted []string
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					switch {
+					case r.URL.Path == "/":
+						_, _ = w.Write([]byte(bulkTestInfo))
+					case r.URL.Path == "/_cat/indices/deployments*":
+						_, _ = w.Write([]byte(tc.indices))
+					case r.Method == http.MethodDelete:
+						deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/"))
+						_, _ = w.Write([]byte(`{"acknowledged":true}`))
+					default:
+						w.WriteHeader(http.StatusBadRequest)
+					}
+				},
+			))
+			defer srv.Close()
+
+			s, err := NewStore(
+				WithServerAddresses([]string{srv.URL}),
+				WithDeploymentsIndexName("deployments"),
+				WithDeploymentsMonthlyIndices(true),
+			)
+			assert.NoError(t, err)
+
+			pruned, err := s.PruneDeployments(context.Background(), tc.before)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.pruned, pruned)
+			if tc.pruned != nil {
+				assert.Equal(t, []string{strings.Join(tc.pruned, ",")}, deleted)
+			} else {
+				assert.Empty(t, deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package opensearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+// discardRouting drops the routing of the copied documents, as the documents
+// are routed by tenant in the shared indices only
+var discardRouting = model.M{"routing": "discard"}
+
+type reindexResponse struct {
+	Total            int               `json:"total"`
+	Created          int               `json:"created"`
+	VersionConflicts int               `json:"version_conflicts"`
+	Failures         []json.RawMessage `json:"failures"`
+}
+
+type deleteByQueryResponse struct {
+	Deleted  int               `json:"deleted"`
+	Failures []json.RawMessage `json:"failures"`
+}
+
+// ErrPlacementsOutdated is returned by the writes while the tenant
+// placements were not reloaded within the max age
+var ErrPlacementsOutdated = errors.New(
+	"the tenant placements were not reloaded recently: refusing to write")
+
+// WithPlacementsMaxAge makes the writes fail while the tenant placements
+// were loaded longer than maxAge ago, so that a process failing to reload
+// them never writes to the indices a tenant is leaving; it must be shorter
+// than the settle delay of the placement changes (0 disables the check)
+func WithPlacementsMaxAge(maxAge time.Duration) StoreOption {
+	return func(s *opensearchStore) {
+		s.placementsMaxAge = maxAge
+	}
+}
+
+// SetTenantPlacements replaces the placements of the tenants on dedicated
+// indices; the tenants without a placement are on the shared indices
+func (s *opensearchStore) SetTenantPlacements(placements []model.TenantPlacement) {
+	byTenant := make(map[string]model.TenantPlacement, len(placements))
+	for _, placement := range placements {
+		byTenant[placement.TenantID] = placement
+	}
+	s.placementsMutex.Lock()
+	defer s.placementsMutex.Unlock()
+	s.placements = byTenant
+	s.placementsLoadedAt = time.Now()
+}
+
+// checkPlacements returns ErrPlacementsOutdated if the tenant placements
+// are older than the max age
+func (s *opensearchStore) checkPlacements() error {
+	if s.placementsMaxAge <= 0 {
+		return nil
+	}
+	s.placementsMutex.RLock()
+	loadedAt := s.placementsLoadedAt
+	s.placementsMutex.RUnlock()
+	if time.Since(loadedAt) > s.placementsMaxAge {
+		return ErrPlacementsOutdated
+	}
+	return nil
+}
+
+func (s *opensearchStore) tenantPlacementState(tid string) string {
+	s.placementsMutex.RLock()
+	defer s.placementsMutex.RUnlock()
+	return s.placements[tid].State
+}
+
+func (s *opensearchStore) isDedicated(tid string) bool {
+	return tid != "" && s.tenantPlacementState(tid) == model.TenantPlacementDedicated
+}
+
+// dedicatedIndexName returns the name of the dedicated index of the tenant;
+// it matches the index patterns of the shared index templates
+func dedicatedIndexName(indexName, tid string) string {
+	return indexName + "-" + strings.ToLower(tid)
+}
+
+// migratingIndex returns the dedicated index a tenant is being migrated
+// to, which receives a copy of the writes to the shared index
+func (s *opensearchStore) migratingIndex(indexName, tid string) string {
+	if tid != "" && s.tenantPlacementState(tid) == model.TenantPlacementMigrating {
+		return dedicatedIndexName(indexName, tid)
+	}
+	return ""
+}
+
+// mirrorItem returns a copy of the bulk item targeting the dedicated index,
+// which is not routed, as the index holds the documents of a single tenant
+func mirrorItem(item BulkItem, indexName string) BulkItem {
+	desc := *item.Action.Desc
+	desc.Index = indexName
+	desc.Routing = ""
+	return BulkItem{
+		Action: &BulkAction{
+			Type: item.Action.Type,
+			Desc: &desc,
+		},
+		Doc: item.Doc,
+	}
+}
+
+// CreateTenantIndices creates the dedicated indices of the tenant, or
+// migrates them to the current version of the index templates
+func (s *opensearchStore) CreateTenantIndices(ctx context.Context,
+	placement *model.TenantPlacement) error {
+	tid := placement.TenantID
+	err := s.migrateIndex(ctx, dedicatedIndexName(s.devicesIndexName, tid),
+		indexDevicesVersion, placement.DevicesShards, devicesCopyDest)
+	if err == nil {
+		err = s.migrateIndex(ctx, dedicatedIndexName(s.deploymentsIndexName, tid),
+			s.deploymentsVersion(), placement.DeploymentsShards, documentsCopyDest)
+	}
+	return err
+}
+
+// migrateTenantIndices migrates the dedicated indices of the tenants to the
+// current version of the index templates
+func (s *opensearchStore) migrateTenantIndices(ctx context.Context) error {
+	s.placementsMutex.RLock()
+	placements := make([]model.TenantPlacement, 0, len(s.placements))
+	for _, placement := range s.placements {
+		placements = append(placements, placement)
+	}
+	s.placementsMutex.RUnlock()
+
+	for i := range placements {
+		err := s.CreateTenantIndices(ctx, &placements[i])
+		if err != nil {
+			return errors.Wrapf(err, "failed to migrate the indices of tenant %q",
+				placements[i].TenantID)
+		}
+	}
+	return nil
+}
+
+// CopyTenantDocuments copies the devices and device deployments of the
+// tenant from the shared indices to the dedicated ones; the documents
+// already written to the dedicated indices are never replaced
+func (s *opensearchStore) CopyTenantDocuments(ctx context.Context, tid string) error {
+	err := s.reindex(ctx, tenantSource(s.devicesIndexName, tid),
+		dedicatedIndexName(s.devicesIndexName, tid), devicesCopyDest, discardRouting)
+	if err != nil {
+		return err
+	}
+	alias := dedicatedIndexName(s.deploymentsIndexName, tid)
+	indexName := versionedIndexName(alias, s.deploymentsVersion())
+	err = s.reindex(ctx, tenantSource(s.deploymentsIndexName, tid), alias,
+		documentsCopyDest, discardRouting, partitionCopyDest(indexName))
+	if err == nil && partitioned(indexName) {
+		err = s.aliasPartitions(ctx, alias, indexName)
+	}
+	return err
+}
+
+func tenantSource(indexName, tid string) model.M {
+	return model.M{
+		"index": indexName,
+		"query": model.M{
+			"term": model.M{model.FieldNameTenantID: tid},
+		},
+	}
+}
+
+// DeleteSharedTenantDocuments deletes the devices and device deployments of
+// the tenant from the shared indices
+func (s *opensearchStore) DeleteSharedTenantDocuments(ctx context.Context, tid string) error {
+	err := s.deleteTenantDocuments(ctx, tid, s.devicesIndexName)
+	if err == nil {
+		err = s.deleteTenantDocuments(ctx, tid, s.deploymentsIndexName)
+	}
+	return err
+}
+
+func (s *opensearchStore) deleteTenantDocuments(ctx context.Context,
+	tid, indexName string) error {
+	l := log.FromContext(ctx)
+	l.Infof("delete the documents of tenant %q from %s", tid, indexName)
+
+	query := fmt.Sprintf(`{"query":{"term":{%q:%q}}}`, model.FieldNameTenantID, tid)
+	req := opensearchapi.DeleteByQueryRequest{
+		Index:     []string{indexName},
+		Body:      strings.NewReader(query),
+		Routing:   []string{tid},
+		Conflicts: "proceed",
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete the documents")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return errors.Errorf("failed to delete the documents: %s", string(body))
+	}
+	var deleteRes deleteByQueryResponse
+	if err := json.NewDecoder(res.Body).Decode(&deleteRes); err != nil {
+		return errors.Wrap(err, "failed to parse the delete by query response")
+	} else if len(deleteRes.Failures) > 0 {
+		return errors.Errorf("failed to delete %d documents: %s",
+			len(deleteRes.Failures), deleteRes.Failures[0])
+	}
+	l.Infof("deleted %d documents", deleteRes.Deleted)
+	return nil
+}
@@ -0,0 +1,232 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package opensearch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestBulkIndexDevicesPlacement(t *testing.T) {
+	devices := []*model.Device{
+		model.NewDevice("tenant", "1"),
+	}
+	removedDevices := []*model.Device{
+		model.NewDevice("tenant", "2"),
+	}
+	testCases := map[string]struct {
+		placements []model.TenantPlacement
+
+		actions []string
+		index   string
+		routing string
+	}{
+		"shared": {
+			placements: []model.TenantPlacement{{
+				TenantID: "other",
+				State:    model.TenantPlacementDedicated,
+			}},
+			actions: []string{
+				`{"index":{"_id":"1","_index":"devices","routing":"tenant"}}`,
+				`{"delete":{"_id":"2","_index":"devices","routing":"tenant"}}`,
+			},
+			index:   "devices",
+			routing: "tenant",
+		},
+		"migrating": {
+			placements: []model.TenantPlacement{{
+				TenantID: "tenant",
+				State:    model.TenantPlacementMigrating,
+			}},
+			actions: []string{
+				`{"index":{"_id":"1","_index":"devices","routing":"tenant"}}`,
+				`{"index":{"_id":"1","_index":"devices-tenant"}}`,
+				`{"delete":{"_id":"2","_index":"devices","routing":"tenant"}}`,
+				`{"delete":{"_id":"2","_index":"devices-tenant"}}`,
+			},
+			index:   "devices",
+			routing: "tenant",
+		},
+		"dedicated": {
+			placements: []model.TenantPlacement{{
+				TenantID: "tenant",
+				State:    model.TenantPlacementDedicated,
+			}},
+			actions: []string{
+				`{"index":{"_id":"1","_index":"devices-tenant"}}`,
+				`{"delete":{"_id":"2","_index":"devices-tenant"}}`,
+			},
+			index: "devices-tenant",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var actions []string
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					if r.URL.Path == "/" {
+						_, _ = w.Write([]byte(bulkTestInfo))
+						return
+					}
+					var items []string
+					scanner := bufio.NewScanner(r.Body)
+					for scanner.Scan() {
+						if strings.Contains(scanner.Text(), `"_id"`) {
+							actions = append(actions, scanner.Text())
+							items = append(items, `{"index":{"status":200}}`)
+						}
+					}
+					_, _ = w.Write([]byte(`{"errors":false,"items":[` +
+						strings.Join(items, ",") + `]}`))
+				},
+			))
+			defer srv.Close()
+
+			s, err := NewStore(
+				WithServerAddresses([]string{srv.URL}),
+				WithDevicesIndexName("devices"),
+				WithBulkConcurrency(1),
+			)
+			assert.NoError(t, err)
+			s.SetTenantPlacements(tc.placements)
+
+			_, err = s.BulkIndexDevices(context.Background(), devices, removedDevices)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.actions, actions)
+			assert.Equal(t, tc.index, s.GetDevicesIndex("tenant"))
+			assert.Equal(t, tc.routing, s.GetDevicesRoutingKey("tenant"))
+		})
+	}
+}
+
+func TestCopyTenantDocuments(t *testing.T) {
+	testCases := map[string]struct {
+		status int
+		body   string
+
+		requests []string
+		err      error
+	}{
+		"ok": {
+			status: http.StatusOK,
+			body:   `{"total":2,"created":1,"version_conflicts":1,"failures":[]}`,
+			requests: []string{
+				`{"conflicts":"proceed",` +
+					`"dest":{"index":"devices-tenant","routing":"discard",` +
+					`"version_type":"external"},` +
+					`"source":{"index":"devices","query":{"term":{"tenant_id":"tenant"}}}}`,
+				`{"conflicts":"proceed",` +
+					`"dest":{"index":"deployments-tenant","op_type":"create",` +
+					`"routing":"discard"},` +
+					`"source":{"index":"deployments",` +
+					`"query":{"term":{"tenant_id":"tenant"}}}}`,
+			},
+		},
+		"ko, failures": {
+			status: http.StatusOK,
+			body:   `{"total":1,"failures":[{"id":"1"}]}`,
+			requests: []string{
+				`{"conflicts":"proceed",` +
+					`"dest":{"index":"devices-tenant","routing":"discard",` +
+					`"version_type":"external"},` +
+					`"source":{"index":"devices","query":{"term":{"tenant_id":"tenant"}}}}`,
+			},
+			err: errors.New(`failed to copy 1 documents: {"id":"1"}`),
+		},
+		"ko, error": {
+			status: http.StatusBadRequest,
+			body:   `{"error":"bad request"}`,
+			requests: []string{
+				`{"conflicts":"proceed",` +
+					`"dest":{"index":"devices-tenant","routing":"discard",` +
+					`"version_type":"external"},` +
+					`"source":{"index":"devices","query":{"term":{"tenant_id":"tenant"}}}}`,
+			},
+			err: errors.New(`failed to copy the documents: {"error":"bad request"}`),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var requests []string
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					if r.URL.Path == "/" {
+						_, _ = w.Write([]byte(bulkTestInfo))
+						return
+					}
+					assert.Equal(t, "/_reindex", r.URL.Path)
+					body, _ := ioutil.ReadAll(r.Body)
+					requests = append(requests, string(body))
+					w.WriteHeader(tc.status)
+					_, _ = fmt.Fprint(w, tc.body)
+				},
+			))
+			defer srv.Close()
+
+			s, err := NewStore(
+				WithServerAddresses([]string{srv.URL}),
+				WithDevicesIndexName("devices"),
+				WithDeploymentsIndexName("deployments"),
+			)
+			assert.NoError(t, err)
+
+			err = s.CopyTenantDocuments(context.Background(), "tenant")
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.requests, requests)
+		})
+	}
+}
+
+func TestPlacementsMaxAge(t *testing.T) {
+	s, err := NewStore(WithPlacementsMaxAge(time.Minute))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	devices := []*model.Device{model.NewDevice("tenant", "1")}
+
+	// never loaded
+	_, err = s.BulkIndexDevices(ctx, devices, nil)
+	assert.ErrorIs(t, err, ErrPlacementsOutdated)
+
+	s.SetTenantPlacements(nil)
+	assert.NoError(t, s.(*opensearchStore).checkPlacements())
+
+	// not reloaded within the max age
+	s.(*opensearchStore).placementsLoadedAt = time.Now().Add(-2 * time.Minute)
+	err = s.BulkIndexDeployments(ctx, []*model.Deployment{{ID: "1", TenantID: "tenant"}})
+	assert.ErrorIs(t, err, ErrPlacementsOutdated)
+
+	// disabled
+	s, err = NewStore()
+	assert.NoError(t, err)
+	assert.NoError(t, s.(*opensearchStore).checkPlacements())
+}
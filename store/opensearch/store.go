@@ -21,10 +21,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/opensearch-project/opensearch-go"
 	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/opensearch-project/opensearch-go/signer"
 	"github.com/pkg/errors"
 
 	"github.com/mendersoftware/go-lib-micro/identity"
@@ -39,23 +43,67 @@ type StoreOption func(*opensearchStore)
 
 type opensearchStore struct {
 	addresses                []string
+	username                 string
+	password                 string
+	caCertFile               string
+	clientCertFile           string
+	clientKeyFile            string
+	tlsSkipVerify            bool
+	signer                   signer.Signer
 	devicesIndexName         string
 	devicesIndexShards       int
 	devicesIndexReplicas     int
 	deploymentsIndexName     string
 	deploymentsIndexShards   int
 	deploymentsIndexReplicas int
+	summariesIndexName       string
+	summariesIndexShards     int
+	summariesIndexReplicas   int
+	bulkMaxRetries           int
+	bulkRetryDelay           time.Duration
+	bulkMaxItems             int
+	bulkMaxBytes             int
+	bulkConcurrency          int
+	bulkCompression          bool
 	client                   *opensearch.Client
+	placementsMutex          sync.RWMutex
+	placements               map[string]model.TenantPlacement
+	placementsLoadedAt       time.Time
+	placementsMaxAge         time.Duration
+	indicesMutex             sync.RWMutex
+	writeIndices             map[string][]string
+	partitions               map[string]bool
+	deploymentsMonthly       bool
+	cutoverSettle            time.Duration
 }
 
 func NewStore(opts ...StoreOption) (store.Store, error) {
-	store := &opensearchStore{}
+	store := &opensearchStore{
+		bulkMaxRetries:  defaultBulkMaxRetries,
+		bulkRetryDelay:  defaultBulkRetryDelay,
+		bulkMaxItems:    defaultBulkMaxItems,
+		bulkMaxBytes:    defaultBulkMaxBytes,
+		bulkConcurrency: defaultBulkConcurrency,
+		cutoverSettle:   defaultCutoverSettle,
+	}
 	for _, opt := range opts {
 		opt(store)
 	}
+	if store.bulkMaxItems <= 0 || store.bulkMaxBytes <= 0 {
+		return nil, errors.Errorf("invalid bulk limits: %d operations, %d bytes",
+			store.bulkMaxItems, store.bulkMaxBytes)
+	}
 
+	transport, err := store.transport()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid OpenSearch TLS configuration")
+	}
 	cfg := opensearch.Config{
 		Addresses: store.addresses,
+		Username:  store.username,
+		Password:  store.password,
+		Signer:    store.signer,
+		Transport: transport,
 	}
 	osClient, err := opensearch.NewClient(cfg)
 	if err != nil {
@@ -108,6 +156,67 @@ func WithDeploymentsIndexReplicas(indexReplicas int) StoreOption {
 	}
 }
 
+func WithDeploymentSummariesIndexName(indexName string) StoreOption {
+	return func(s *opensearchStore) {
+		s.summariesIndexName = indexName
+	}
+}
+
+func WithDeploymentSummariesIndexShards(indexShards int) StoreOption {
+	return func(s *opensearchStore) {
+		s.summariesIndexShards = indexShards
+	}
+}
+
+func WithDeploymentSummariesIndexReplicas(indexReplicas int) StoreOption {
+	return func(s *opensearchStore) {
+		s.summariesIndexReplicas = indexReplicas
+	}
+}
+
+// WithBulkRetries sets the number of retries and the initial backoff delay
+// for bulk operations failing with a transient error
+func WithBulkRetries(maxRetries int, retryDelay time.Duration) StoreOption {
+	return func(s *opensearchStore) {
+		s.bulkMaxRetries = maxRetries
+		s.bulkRetryDelay = retryDelay
+	}
+}
+
+// WithBulkLimits sets the maximum number of operations and size, in bytes,
+// of the bulk requests, which must be positive; the bulk operations are split
+// in as many requests
+func WithBulkLimits(maxItems, maxBytes int) StoreOption {
+	return func(s *opensearchStore) {
+		s.bulkMaxItems = maxItems
+		s.bulkMaxBytes = maxBytes
+	}
+}
+
+// WithBulkConcurrency sets the maximum number of bulk requests sent
+// concurrently for the same bulk operations
+func WithBulkConcurrency(concurrency int) StoreOption {
+	return func(s *opensearchStore) {
+		s.bulkConcurrency = concurrency
+	}
+}
+
+// WithBulkCompression enables the gzip compression of the bulk requests
+func WithBulkCompression(compress bool) StoreOption {
+	return func(s *opensearchStore) {
+		s.bulkCompression = compress
+	}
+}
+
+// WithCutoverSettle sets the delay given to all the processes to reload the
+// aliases at each step of an index migration; it must be longer than the
+// interval between the calls to RefreshIndices
+func WithCutoverSettle(settle time.Duration) StoreOption {
+	return func(s *opensearchStore) {
+		s.cutoverSettle = settle
+	}
+}
+
 type BulkAction struct {
 	Type string
 	Desc *BulkActionDesc
@@ -119,7 +228,11 @@ type BulkActionDesc struct {
 	IfSeqNo       int64  `json:"_if_seq_no"`
 	IfPrimaryTerm int64  `json:"_if_primary_term"`
 	Routing       string `json:"routing"`
+	Version       int64  `json:"version"`
+	VersionType   string `json:"version_type"`
 	Tenant        string
+	// Partition is the monthly partition of the index holding the document
+	Partition string
 }
 
 type BulkItem struct {
@@ -128,15 +241,29 @@ type BulkItem struct {
 }
 
 func (bad BulkActionDesc) MarshalJSON() ([]byte, error) {
-	return json.Marshal(struct {
-		ID      string `json:"_id"`
-		Index   string `json:"_index"`
-		Routing string `json:"routing"`
+	desc := struct {
+		ID            string `json:"_id"`
+		Index         string `json:"_index"`
+		IfSeqNo       *int64 `json:"if_seq_no,omitempty"`
+		IfPrimaryTerm *int64 `json:"if_primary_term,omitempty"`
+		Routing       string `json:"routing,omitempty"`
+		Version       *int64 `json:"version,omitempty"`
+		VersionType   string `json:"version_type,omitempty"`
 	}{
 		ID:      bad.ID,
 		Index:   bad.Index,
 		Routing: bad.Routing,
-	})
+	}
+	// sequence numbers start from zero, while primary terms from one
+	if bad.IfPrimaryTerm > 0 {
+		desc.IfSeqNo = &bad.IfSeqNo
+		desc.IfPrimaryTerm = &bad.IfPrimaryTerm
+	}
+	if bad.VersionType != "" {
+		desc.Version = &bad.Version
+		desc.VersionType = bad.VersionType
+	}
+	return json.Marshal(desc)
 }
 
 func (ba BulkAction) MarshalJSON() ([]byte, error) {
@@ -172,97 +299,143 @@ func (bi BulkItem) Marshal() ([]byte, error) {
 
 func (s *opensearchStore) BulkIndexDeployments(ctx context.Context,
 	deployments []*model.Deployment) error {
-	var data strings.Builder
-
+	if err := s.checkPlacements(); err != nil {
+		return err
+	}
+	items := make([]BulkItem, 0, len(deployments))
 	for _, deployment := range deployments {
-		actionJSON, err := json.Marshal(BulkAction{
-			Type: "index",
-			Desc: &BulkActionDesc{
-				ID:      deployment.ID,
-				Index:   s.GetDeploymentsIndex(deployment.TenantID),
-				Routing: s.GetDeploymentsRoutingKey(deployment.TenantID),
+		item := BulkItem{
+			Action: &BulkAction{
+				Type: "index",
+				Desc: &BulkActionDesc{
+					ID:        deployment.ID,
+					Index:     s.GetDeploymentsIndex(deployment.TenantID),
+					Routing:   s.GetDeploymentsRoutingKey(deployment.TenantID),
+					Partition: s.deploymentPartition(deployment),
+				},
 			},
-		})
-		if err != nil {
-			return err
+			Doc: deployment,
 		}
-		deploymentJSON, err := json.Marshal(deployment)
-		if err != nil {
-			return err
+		items = append(items, item)
+		if idx := s.migratingIndex(s.deploymentsIndexName, deployment.TenantID); idx != "" {
+			items = append(items, mirrorItem(item, idx))
 		}
-		data.WriteString(string(actionJSON) + "\n" + string(deploymentJSON) + "\n")
 	}
-	dataString := data.String()
-
-	l := log.FromContext(ctx)
-	l.Debugf("opensearch request: %s", dataString)
-
-	req := opensearchapi.BulkRequest{
-		Body: strings.NewReader(dataString),
+	items, err := s.resolveWriteIndices(items)
+	if err == nil {
+		err = s.ensurePartitions(ctx, items)
 	}
-	res, err := req.Do(ctx, s.client)
-	if err != nil {
-		return errors.Wrap(err, "failed to bulk index")
+	if err == nil {
+		// the deployments are not versioned, thus never stale
+		_, err = s.bulk(ctx, items)
 	}
-	defer res.Body.Close()
+	return err
+}
 
-	return nil
+func (s *opensearchStore) BulkIndexDeploymentSummaries(ctx context.Context,
+	summaries []*model.DeploymentSummary) error {
+	if err := s.checkPlacements(); err != nil {
+		return err
+	}
+	items := make([]BulkItem, 0, len(summaries))
+	for _, summary := range summaries {
+		items = append(items, BulkItem{
+			Action: &BulkAction{
+				Type: "index",
+				Desc: &BulkActionDesc{
+					ID:      summary.ID,
+					Index:   s.GetDeploymentSummariesIndex(summary.TenantID),
+					Routing: s.GetDeploymentSummariesRoutingKey(summary.TenantID),
+				},
+			},
+			Doc: summary,
+		})
+	}
+	items, err := s.resolveWriteIndices(items)
+	if err == nil {
+		_, err = s.bulk(ctx, items)
+	}
+	return err
 }
 
+// BulkIndexDevices indexes the devices and deletes the removed ones, and
+// returns the IDs of the devices skipped as stale.
+//
+// The device documents are versioned with the inventory update timestamp,
+// with the external_gte version type: a document built from an inventory
+// snapshot older than the indexed one is skipped as stale, so that a late or
+// redelivered job can't roll back the inventory attributes. The versioning
+// does not protect:
+//   - the attributes from the other services (deviceauth status, identity
+//     and check-in time, latest deployment, deviceconnect and devicemonitor):
+//     their updates don't bump the inventory timestamp, so between documents
+//     with the same version the last written one wins, even if its data was
+//     fetched first;
+//   - the devices without an inventory update timestamp, indexed unversioned;
+//   - the deletes, which are unversioned: an index request built before the
+//     device was removed and written after the delete indexes the device
+//     again, until the consistency check finds it stale.
+//
+// The jobs for the same device are processed in order within an indexer, so
+// these races only happen between indexers processing jobs for the same
+// device at the same time, or between the indexers and a reindex.
 func (s *opensearchStore) BulkIndexDevices(ctx context.Context, devices []*model.Device,
-	removedDevices []*model.Device) error {
-	var data strings.Builder
-
+	removedDevices []*model.Device) ([]string, error) {
+	if err := s.checkPlacements(); err != nil {
+		return nil, err
+	}
+	items := make([]BulkItem, 0, len(devices)+len(removedDevices))
 	for _, device := range devices {
-		actionJSON, err := json.Marshal(BulkAction{
-			Type: "index",
-			Desc: &BulkActionDesc{
-				ID:      device.GetID(),
-				Index:   s.GetDevicesIndex(device.GetTenantID()),
-				Routing: s.GetDevicesRoutingKey(device.GetTenantID()),
+		desc := &BulkActionDesc{
+			ID:      device.GetID(),
+			Index:   s.GetDevicesIndex(device.GetTenantID()),
+			Routing: s.GetDevicesRoutingKey(device.GetTenantID()),
+		}
+		// version the documents with the inventory update timestamp, so
+		// that a late reindex can never replace fresher inventory data;
+		// equal versions are accepted, as deviceauth and deployments
+		// updates don't bump the inventory update timestamp
+		if device.UpdatedAt != nil {
+			desc.Version = device.UpdatedAt.UnixNano()
+			desc.VersionType = versionTypeExternalGTE
+		}
+		item := BulkItem{
+			Action: &BulkAction{
+				Type: "index",
+				Desc: desc,
 			},
-		})
-		if err != nil {
-			return err
+			Doc: device,
 		}
-		deviceJSON, err := json.Marshal(device)
-		if err != nil {
-			return err
+		items = append(items, item)
+		if idx := s.migratingIndex(s.devicesIndexName, device.GetTenantID()); idx != "" {
+			items = append(items, mirrorItem(item, idx))
 		}
-		data.WriteString(string(actionJSON) + "\n" + string(deviceJSON) + "\n")
 	}
 	for _, device := range removedDevices {
-		actionJSON, err := json.Marshal(BulkAction{
-			Type: "delete",
-			Desc: &BulkActionDesc{
-				ID:      device.GetID(),
-				Index:   s.GetDevicesIndex(device.GetTenantID()),
-				Routing: s.GetDevicesRoutingKey(device.GetTenantID()),
+		item := BulkItem{
+			Action: &BulkAction{
+				Type: "delete",
+				Desc: &BulkActionDesc{
+					ID:      device.GetID(),
+					Index:   s.GetDevicesIndex(device.GetTenantID()),
+					Routing: s.GetDevicesRoutingKey(device.GetTenantID()),
+				},
 			},
-		})
-		if err != nil {
-			return err
 		}
-		data.WriteString(string(actionJSON) + "\n")
-	}
-
-	dataString := data.String()
-
-	l := log.FromContext(ctx)
-	l.Debugf("opensearch request: %s", dataString)
-
-	req := opensearchapi.BulkRequest{
-		Body: strings.NewReader(dataString),
+		items = append(items, item)
+		if idx := s.migratingIndex(s.devicesIndexName, device.GetTenantID()); idx != "" {
+			items = append(items, mirrorItem(item, idx))
+		}
 	}
-	res, err := req.Do(ctx, s.client)
+	items, err := s.resolveWriteIndices(items)
 	if err != nil {
-		return errors.Wrap(err, "failed to bulk index")
+		return nil, err
 	}
-	defer res.Body.Close()
-
-	return nil
+	return s.bulk(ctx, items)
 }
 
+// Migrate puts the index templates, and migrates the shared indices, and the
+// dedicated indices of the tenants, to the current version of the templates
 func (s *opensearchStore) Migrate(ctx context.Context) error {
 	indexName := s.GetDevicesIndex("")
 	template := fmt.Sprintf(indexDevicesTemplate,
@@ -272,7 +445,7 @@ func (s *opensearchStore) Migrate(ctx context.Context) error {
 	)
 	err := s.migratePutIndexTemplate(ctx, indexName, template)
 	if err == nil {
-		err = s.migrateCreateIndex(ctx, indexName)
+		err = s.migrateIndex(ctx, indexName, indexDevicesVersion, 0, devicesCopyDest)
 	}
 	if err == nil {
 		indexName = s.GetDeploymentsIndex("")
@@ -284,7 +457,26 @@ func (s *opensearchStore) Migrate(ctx context.Context) error {
 		err = s.migratePutIndexTemplate(ctx, indexName, template)
 	}
 	if err == nil {
-		err = s.migrateCreateIndex(ctx, indexName)
+		err = s.migrateIndex(ctx, indexName, s.deploymentsVersion(), 0, documentsCopyDest)
+	}
+	if err == nil {
+		err = s.migratePutMapping(ctx, indexName, deploymentsDeviceAttributesMapping)
+	}
+	if err == nil {
+		indexName = s.GetDeploymentSummariesIndex("")
+		template = fmt.Sprintf(indexDeploymentSummariesTemplate,
+			indexName,
+			s.summariesIndexShards,
+			s.summariesIndexReplicas,
+		)
+		err = s.migratePutIndexTemplate(ctx, indexName, template)
+	}
+	if err == nil {
+		err = s.migrateIndex(ctx, indexName, indexDeploymentSummariesVersion, 0,
+			documentsCopyDest)
+	}
+	if err == nil {
+		err = s.migrateTenantIndices(ctx)
 	}
 	return err
 }
@@ -312,7 +504,34 @@ func (s *opensearchStore) migratePutIndexTemplate(ctx context.Context,
 	return nil
 }
 
-func (s *opensearchStore) migrateCreateIndex(ctx context.Context, indexName string) error {
+// migratePutMapping updates the mapping of an existing index
+func (s *opensearchStore) migratePutMapping(ctx context.Context,
+	indexName, mapping string) error {
+	l := log.FromContext(ctx)
+	l.Infof("put the mapping for %s", indexName)
+
+	req := opensearchapi.IndicesPutMappingRequest{
+		Index: []string{indexName},
+		Body:  strings.NewReader(mapping),
+	}
+
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to put the mapping")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return errors.Errorf("failed to update the mapping: %s", string(body))
+	}
+	return nil
+}
+
+// migrateCreateIndex creates the index, if it doesn't exist, with the given
+// number of shards, or the one of the index template if zero
+func (s *opensearchStore) migrateCreateIndex(ctx context.Context, indexName string,
+	shards int) error {
 	l := log.FromContext(ctx)
 	l.Infof("verify if the index %s exists", indexName)
 
@@ -331,6 +550,10 @@ func (s *opensearchStore) migrateCreateIndex(ctx context.Context, indexName stri
 		req := opensearchapi.IndicesCreateRequest{
 			Index: indexName,
 		}
+		if shards > 0 {
+			req.Body = strings.NewReader(fmt.Sprintf(
+				`{"settings":{"number_of_shards":%d}}`, shards))
+		}
 		res, err := req.Do(ctx, s.client)
 		if err != nil {
 			return errors.Wrap(err, "failed to create the index")
@@ -369,6 +592,14 @@ func (s *opensearchStore) AggregateDeployments(ctx context.Context,
 	return s.aggregate(ctx, indexName, routingKey, query)
 }
 
+func (s *opensearchStore) AggregateDeploymentSummaries(ctx context.Context,
+	query model.Query) (model.M, error) {
+	id := identity.FromContext(ctx)
+	indexName := s.GetDeploymentSummariesIndex(id.Tenant)
+	routingKey := s.GetDeploymentSummariesRoutingKey(id.Tenant)
+	return s.aggregate(ctx, indexName, routingKey, query)
+}
+
 func (s *opensearchStore) aggregate(ctx context.Context, indexName, routingKey string,
 	query model.Query) (model.M, error) {
 	l := log.FromContext(ctx)
@@ -424,6 +655,14 @@ func (s *opensearchStore) SearchDeployments(ctx context.Context,
 	return s.search(ctx, indexName, routingKey, query)
 }
 
+func (s *opensearchStore) SearchDeploymentSummaries(ctx context.Context,
+	query model.Query) (model.M, error) {
+	id := identity.FromContext(ctx)
+	indexName := s.GetDeploymentSummariesIndex(id.Tenant)
+	routingKey := s.GetDeploymentSummariesRoutingKey(id.Tenant)
+	return s.search(ctx, indexName, routingKey, query)
+}
+
 func (s *opensearchStore) search(ctx context.Context, indexName, routingKey string,
 	query model.Query) (model.M, error) {
 	l := log.FromContext(ctx)
@@ -506,14 +745,11 @@ func (s *opensearchStore) getIndexMapping(ctx context.Context,
 		return nil, err
 	}
 
-	index, ok := indexRes[idx]
-	if !ok {
-		return nil, errors.New("can't parse index defintion response")
-	}
-
-	indexM, ok := index.(map[string]interface{})
-	if !ok {
-		return nil, errors.New("can't parse index defintion response")
+	// the index name is an alias, and the response is keyed by the
+	// physical indices behind it
+	indexM, err := mergeIndexMappings(indexRes)
+	if err != nil {
+		return nil, err
 	}
 
 	l.Debugf("index for tid %s\n%s\n", tid, indexM)
@@ -522,20 +758,80 @@ func (s *opensearchStore) getIndexMapping(ctx context.Context,
 
 // GetDevicesIndex returns the index name for the tenant tid
 func (s *opensearchStore) GetDevicesIndex(tid string) string {
+	if s.isDedicated(tid) {
+		return dedicatedIndexName(s.devicesIndexName, tid)
+	}
 	return s.devicesIndexName
 }
 
 // GetDeploymentsIndex returns the index name for the tenant tid
 func (s *opensearchStore) GetDeploymentsIndex(tid string) string {
+	if s.isDedicated(tid) {
+		return dedicatedIndexName(s.deploymentsIndexName, tid)
+	}
 	return s.deploymentsIndexName
 }
 
+// GetDeploymentSummariesIndex returns the index name for the tenant tid
+func (s *opensearchStore) GetDeploymentSummariesIndex(tid string) string {
+	return s.summariesIndexName
+}
+
 // GetDevicesRoutingKey returns the routing key for the tenant tid
 func (s *opensearchStore) GetDevicesRoutingKey(tid string) string {
+	if s.isDedicated(tid) {
+		return ""
+	}
 	return tid
 }
 
 // GetDeploymentsRoutingKey returns the routing key for the tenant tid
 func (s *opensearchStore) GetDeploymentsRoutingKey(tid string) string {
+	if s.isDedicated(tid) {
+		return ""
+	}
 	return tid
 }
+
+// GetDeploymentSummariesRoutingKey returns the routing key for the tenant tid
+func (s *opensearchStore) GetDeploymentSummariesRoutingKey(tid string) string {
+	return tid
+}
+
+// mergeIndexMappings merges the definitions of the physical indices behind
+// an alias, which differ in the fields added by the dynamic mappings
+func mergeIndexMappings(indexRes map[string]interface{}) (map[string]interface{}, error) {
+	errParse := errors.New("can't parse index defintion response")
+	names := make([]string, 0, len(indexRes))
+	for name := range indexRes {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, errParse
+	}
+	// the latest partition or version comes last, and takes precedence
+	sort.Strings(names)
+	merged, ok := indexRes[names[len(names)-1]].(map[string]interface{})
+	if !ok {
+		return nil, errParse
+	}
+	properties := indexProperties(merged)
+	for _, name := range names[:len(names)-1] {
+		indexM, ok := indexRes[name].(map[string]interface{})
+		if !ok {
+			return nil, errParse
+		}
+		for field, prop := range indexProperties(indexM) {
+			if _, ok := properties[field]; !ok && properties != nil {
+				properties[field] = prop
+			}
+		}
+	}
+	return merged, nil
+}
+
+func indexProperties(indexM map[string]interface{}) map[string]interface{} {
+	mappings, _ := indexM["mappings"].(map[string]interface{})
+	properties, _ := mappings["properties"].(map[string]interface{})
+	return properties
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package opensearch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/opensearch-project/opensearch-go/signer"
+	"github.com/pkg/errors"
+)
+
+// WithBasicAuth sets the username and password used to authenticate to
+// OpenSearch with HTTP basic authentication
+func WithBasicAuth(username, password string) StoreOption {
+	return func(s *opensearchStore) {
+		s.username = username
+		s.password = password
+	}
+}
+
+// WithCACertificate sets the path to a PEM bundle of certificate authorities
+// trusted to verify the server certificate, in addition to the system ones
+func WithCACertificate(caCertFile string) StoreOption {
+	return func(s *opensearchStore) {
+		s.caCertFile = caCertFile
+	}
+}
+
+// WithClientCertificate sets the paths to the PEM certificate and private key
+// presented to OpenSearch for mutual TLS authentication
+func WithClientCertificate(certFile, keyFile string) StoreOption {
+	return func(s *opensearchStore) {
+		s.clientCertFile = certFile
+		s.clientKeyFile = keyFile
+	}
+}
+
+// WithTLSSkipVerify disables the verification of the server certificate
+// chain and host name; it is meant for development only
+func WithTLSSkipVerify(skipVerify bool) StoreOption {
+	return func(s *opensearchStore) {
+		s.tlsSkipVerify = skipVerify
+	}
+}
+
+// WithSigner sets a hook signing every request sent to OpenSearch, e.g.
+// with the credentials of a managed service
+func WithSigner(signer signer.Signer) StoreOption {
+	return func(s *opensearchStore) {
+		s.signer = signer
+	}
+}
+
+// transport returns the HTTP transport for the TLS options, or nil if none
+// is set, to use the default transport
+func (s *opensearchStore) transport() (http.RoundTripper, error) {
+	if s.caCertFile == "" && s.clientCertFile == "" && !s.tlsSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: s.tlsSkipVerify,
+	}
+	if s.caCertFile != "" {
+		pem, err := ioutil.ReadFile(s.caCertFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the CA certificate")
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("failed to parse the CA certificate %s",
+				s.caCertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if s.clientCertFile != "" || s.clientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.clientCertFile, s.clientKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load the client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package opensearch
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSigner struct{}
+
+func (testSigner) SignRequest(r *http.Request) error {
+	r.Header.Set("X-Signature", "signed")
+	return nil
+}
+
+// writeTestCertificate writes a self-signed certificate and its key to the
+// directory, and returns the certificate and the paths to the files
+func writeTestCertificate(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "reporting"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	err = os.WriteFile(certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	assert.NoError(t, err)
+	err = os.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	assert.NoError(t, err)
+	return cert, certFile, keyFile
+}
+
+func TestNewStoreTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, clientCertFile, clientKeyFile := writeTestCertificate(t, dir)
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	err := os.WriteFile(invalidFile, []byte("invalid"), 0600)
+	assert.NoError(t, err)
+
+	testCases := map[string]struct {
+		requireClientCert bool
+		serverCA          bool
+		opts              []StoreOption
+
+		header    http.Header
+		storeErr  string
+		pingError bool
+	}{
+		"ok, custom CA": {
+			serverCA: true,
+		},
+		"ok, skip verify": {
+			opts: []StoreOption{WithTLSSkipVerify(true)},
+		},
+		"ok, client certificate": {
+			requireClientCert: true,
+			serverCA:          true,
+			opts: []StoreOption{
+				WithClientCertificate(clientCertFile, clientKeyFile),
+			},
+		},
+		"ok, basic auth and signer": {
+			serverCA: true,
+			opts: []StoreOption{
+				WithBasicAuth("user", "pass"),
+				WithSigner(testSigner{}),
+			},
+			header: http.Header{
+				"Authorization": {"Basic dXNlcjpwYXNz"},
+				"X-Signature":   {"signed"},
+			},
+		},
+		"ko, unknown authority": {
+			pingError: true,
+		},
+		"ko, missing client certificate": {
+			requireClientCert: true,
+			serverCA:          true,
+			pingError:         true,
+		},
+		"ko, missing CA certificate": {
+			opts:     []StoreOption{WithCACertificate(filepath.Join(dir, "missing.pem"))},
+			storeErr: "invalid OpenSearch TLS configuration: failed to read the CA certificate",
+		},
+		"ko, invalid CA certificate": {
+			opts: []StoreOption{WithCACertificate(invalidFile)},
+			storeErr: "invalid OpenSearch TLS configuration: " +
+				"failed to parse the CA certificate " + invalidFile,
+		},
+		"ko, invalid client certificate": {
+			opts: []StoreOption{WithClientCertificate(invalidFile, clientKeyFile)},
+			storeErr: "invalid OpenSearch TLS configuration: " +
+				"failed to load the client certificate",
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var header http.Header
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					header = r.Header
+					w.Header().Set("Content-Type", "application/json")
+					_, _ = w.Write([]byte(bulkTestInfo))
+				},
+			))
+			if tc.requireClientCert {
+				pool := x509.NewCertPool()
+				pool.AddCert(clientCert)
+				srv.TLS = &tls.Config{
+					ClientAuth: tls.RequireAndVerifyClientCert,
+					ClientCAs:  pool,
+				}
+			}
+			srv.StartTLS()
+			defer srv.Close()
+
+			opts := []StoreOption{WithServerAddresses([]string{srv.URL})}
+			if tc.serverCA {
+				caFile := filepath.Join(t.TempDir(), "ca.pem")
+				err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+					Type:  "CERTIFICATE",
+					Bytes: srv.Certificate().Raw,
+				}), 0600)
+				assert.NoError(t, err)
+				opts = append(opts, WithCACertificate(caFile))
+			}
+			s, err := NewStore(append(opts, tc.opts...)...)
+			if tc.storeErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.storeErr)
+				}
+				return
+			}
+			assert.NoError(t, err)
+
+			err = s.Ping(context.Background())
+			if tc.pingError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			for key := range tc.header {
+				assert.Equal(t, tc.header.Get(key), header.Get(key))
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/mendersoftware/reporting/model"
 )
@@ -23,17 +24,35 @@ import (
 //go:generate ../x/mockgen.sh
 type Store interface {
 	BulkIndexDeployments(ctx context.Context, deployments []*model.Deployment) error
-	BulkIndexDevices(ctx context.Context, devices, removedDevices []*model.Device) error
+	BulkIndexDeploymentSummaries(ctx context.Context,
+		summaries []*model.DeploymentSummary) error
+	// BulkIndexDevices returns the IDs of the devices skipped as stale
+	BulkIndexDevices(ctx context.Context, devices, removedDevices []*model.Device) ([]string,
+		error)
 	GetDevicesIndex(tid string) string
 	GetDevicesRoutingKey(tid string) string
 	GetDevicesIndexMapping(ctx context.Context, tid string) (map[string]interface{}, error)
 	GetDeploymentsIndex(tid string) string
 	GetDeploymentsRoutingKey(tid string) string
 	GetDeploymentsIndexMapping(ctx context.Context, tid string) (map[string]interface{}, error)
+	GetDeploymentSummariesIndex(tid string) string
+	GetDeploymentSummariesRoutingKey(tid string) string
 	Migrate(ctx context.Context) error
+	RefreshIndices(ctx context.Context) error
+	PruneDeployments(ctx context.Context, before time.Time) ([]string, error)
 	AggregateDevices(ctx context.Context, query model.Query) (model.M, error)
 	AggregateDeployments(ctx context.Context, query model.Query) (model.M, error)
+	AggregateDeploymentSummaries(ctx context.Context, query model.Query) (model.M, error)
 	SearchDevices(ctx context.Context, query model.Query) (model.M, error)
 	SearchDeployments(ctx context.Context, query model.Query) (model.M, error)
+	SearchDeploymentSummaries(ctx context.Context, query model.Query) (model.M, error)
+	GetDevices(ctx context.Context, tenantID string,
+		ids []string) (map[string]map[string]interface{}, error)
+	GetDeployments(ctx context.Context, tenantID string,
+		deployments []*model.Deployment) (map[string]map[string]interface{}, error)
 	Ping(ctx context.Context) error
+	SetTenantPlacements(placements []model.TenantPlacement)
+	CreateTenantIndices(ctx context.Context, placement *model.TenantPlacement) error
+	CopyTenantDocuments(ctx context.Context, tid string) error
+	DeleteSharedTenantDocuments(ctx context.Context, tid string) error
 }